@@ -5,6 +5,8 @@
 //  1. Position arg: orzkratos-add-proto demo.proto
 //  2. Flag: orzkratos-add-proto -name demo.proto
 //  3. No arg: uses current DIR name as proto filename
+//  4. Auto-confirm mode: orzkratos-add-proto -auto
+//  5. Show effective config: orzkratos-add-proto -print-config (defaults come from .orzkratos.yaml next to go.mod)
 //
 // orzkratos-add-proto: Kratos proto 文件添加命令行
 // 简化向 Kratos 项目添加新 proto 文件的流程
@@ -13,6 +15,8 @@
 //  1. 位置参数: orzkratos-add-proto demo.proto
 //  2. flag 参数: orzkratos-add-proto -name demo.proto
 //  3. 无参数: 使用当前 DIR 名作为 proto 文件名
+//  4. 自动确认模式: orzkratos-add-proto -auto
+//  5. 显示生效的配置: orzkratos-add-proto -print-config（默认值来自 go.mod 旁边的 .orzkratos.yaml）
 package main
 
 import (
@@ -23,6 +27,7 @@ import (
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/orzkratos/orzkratos/internal/utils"
+	"github.com/orzkratos/orzkratos/synckratos"
 	"github.com/yyle88/done"
 	"github.com/yyle88/must"
 	"github.com/yyle88/osexec"
@@ -54,12 +59,26 @@ func main() {
 	projectPath, shortMiddle := utils.GetProjectPath(currentPath)
 	zaplog.LOG.Debug("project path", zap.String("path", projectPath))
 
+	// Load project config, its values become flag defaults so flags override them
+	// 加载项目配置，其值作为参数默认值，使命令行参数可以覆盖它们
+	config := rese.P1(synckratos.LoadConfig(projectPath))
+
 	// Define command line parameters
 	// 定义命令行参数
 	var protoName string
 	flag.StringVar(&protoName, "name", "", "proto-file-name. example: demo.proto / demo")
+	var autoConfirm bool
+	flag.BoolVar(&autoConfirm, "auto", config.Auto, "auto-confirm")
+	var printConfig bool
+	flag.BoolVar(&printConfig, "print-config", false, "print effective config (file values overridden by flags) and exit")
 	flag.Parse()
 
+	config.Auto = autoConfirm
+	if printConfig {
+		must.Done(config.WriteYAML(os.Stdout))
+		return
+	}
+
 	// Handle position args: use the first arg from command line
 	// 处理位置参数：使用命令行的第一个参数
 	if args := flag.Args(); len(args) > 0 {
@@ -97,7 +116,7 @@ func main() {
 	zaplog.LOG.Debug("command to run", zap.String("root", projectPath), zap.String("cmd", "kratos proto add "+protoPath))
 	// Ask to confirm command execution
 	// 确认命令执行
-	if !chooseConfirm("execute kratos proto add?") {
+	if !autoConfirm && !chooseConfirm("execute kratos proto add?") {
 		return
 	}
 
@@ -9,6 +9,25 @@
 //  4. Auto-confirm mode: orzkratos-srv-proto -auto
 //  5. Mask mode (default): orzkratos-srv-proto -mask
 //  6. Disable mask mode: orzkratos-srv-proto -mask=false
+//  7. Dry-run mode: orzkratos-srv-proto -dry-run
+//  8. Unified diff: orzkratos-srv-proto -diff changes.patch (use "-" as stdout)
+//  9. Sync report: orzkratos-srv-proto -report json (or text)
+//  10. Rename method: orzkratos-srv-proto -rename SayHello=Greet (repeatable)
+//  11. Removed methods: orzkratos-srv-proto -removed comment-out (unexport / comment-out / move-to-file / delete / keep)
+//  12. Generate via kratos CLI: orzkratos-srv-proto -kratos-cli
+//  13. Watch mode: orzkratos-srv-proto -watch (sync each proto on save, Ctrl+C to stop)
+//  14. Undo last sync: orzkratos-srv-proto -undo
+//  15. Restore a backup: orzkratos-srv-proto -restore 20250101-120000
+//  16. List backups: orzkratos-srv-proto -list-backups
+//  17. Custom DIRs: orzkratos-srv-proto -proto-root proto -service-root app/user/service/internal/service
+//  18. Show effective config: orzkratos-srv-proto -print-config (defaults come from .orzkratos.yaml next to go.mod)
+//  19. Monorepo: orzkratos-srv-proto -all-apps, or one app: orzkratos-srv-proto -app user (config of the DIR running the command applies to each app)
+//  20. Shared protos: orzkratos-srv-proto -proto-include ../shared/api (DIR or Go module, repeatable)
+//  21. Sort structs sharing a file by proto: orzkratos-srv-proto -sort-structs
+//  22. Register new services in internal/server: orzkratos-srv-proto -register-servers
+//  23. Sync Wire ProviderSet and remove stale constructors: orzkratos-srv-proto -sync-providers -prune-providers
+//  24. Scaffold biz and data layers of new services: orzkratos-srv-proto -layers
+//  25. Generate test skeletons of added methods: orzkratos-srv-proto -tests
 //
 // orzkratos-srv-proto: Kratos 服务-proto 同步命令行
 // 自动同步服务代码与 proto 变更：添加缺失方法、非导出已删除方法、排序方法
@@ -21,19 +40,45 @@
 //  4. 自动确认模式: orzkratos-srv-proto -auto
 //  5. Mask 模式（默认）: orzkratos-srv-proto -mask
 //  6. 禁用 mask 模式: orzkratos-srv-proto -mask=false
+//  7. Dry-run 模式: orzkratos-srv-proto -dry-run
+//  8. 统一 diff: orzkratos-srv-proto -diff changes.patch（"-" 表示 stdout）
+//  9. 同步报告: orzkratos-srv-proto -report json（或 text）
+//  10. 方法改名: orzkratos-srv-proto -rename SayHello=Greet（可重复）
+//  11. 已删除方法: orzkratos-srv-proto -removed comment-out（unexport / comment-out / move-to-file / delete / keep）
+//  12. 使用 kratos 命令行生成: orzkratos-srv-proto -kratos-cli
+//  13. 监听模式: orzkratos-srv-proto -watch（保存时同步对应 proto，Ctrl+C 停止）
+//  14. 撤销最近一次同步: orzkratos-srv-proto -undo
+//  15. 恢复指定备份: orzkratos-srv-proto -restore 20250101-120000
+//  16. 列出备份: orzkratos-srv-proto -list-backups
+//  17. 自定义 DIR: orzkratos-srv-proto -proto-root proto -service-root app/user/service/internal/service
+//  18. 显示生效的配置: orzkratos-srv-proto -print-config（默认值来自 go.mod 旁边的 .orzkratos.yaml）
+//  19. Monorepo: orzkratos-srv-proto -all-apps，或单个应用: orzkratos-srv-proto -app user（运行命令所在 DIR 的配置应用于每个应用）
+//  20. 共享的 proto: orzkratos-srv-proto -proto-include ../shared/api（DIR 或 Go 模块，可重复）
+//  21. 按 proto 排序共用文件的 struct: orzkratos-srv-proto -sort-structs
+//  22. 在 internal/server 中注册新服务: orzkratos-srv-proto -register-servers
+//  23. 同步 Wire ProviderSet 并删除过时的构造函数: orzkratos-srv-proto -sync-providers -prune-providers
+//  24. 为新服务生成 biz 和 data 分层代码: orzkratos-srv-proto -layers
+//  25. 为新增方法生成测试骨架: orzkratos-srv-proto -tests
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/orzkratos/orzkratos/internal/utils"
 	"github.com/orzkratos/orzkratos/synckratos"
 	"github.com/yyle88/done"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/eroticgo"
 	"github.com/yyle88/must"
+	"github.com/yyle88/osexistpath/ossoftexist"
 	"github.com/yyle88/rese"
 	"github.com/yyle88/tern"
 	"github.com/yyle88/tern/zerotern"
@@ -45,33 +90,239 @@ func main() {
 	// Get current working DIR to analyze project structure
 	// 获取当前工作 DIR，用于分析项目结构
 	currentPath := rese.C1(os.Getwd())
-	zaplog.LOG.Debug("current path", zap.String("path", currentPath))
 
 	// Get current executable path as debug info
 	// 获取当前可执行文件路径，用于调试信息
 	executePath := rese.C1(os.Executable())
-	zaplog.LOG.Debug("execute path", zap.String("path", executePath))
 
 	// Analyze project structure, get project root and relative path
 	// projectPath: project root DIR
 	// shortMiddle: relative path from project root to current DIR
+	// monorepoPath: go.work DIR, or project root DIR without go.work
 	//
 	// 分析项目结构，获取项目根目录和相对路径
 	// projectPath: 项目根 DIR
 	// shortMiddle: 从项目根 DIR 到当前 DIR 的相对路径
-	projectPath, shortMiddle := utils.GetProjectPath(currentPath)
-	zaplog.LOG.Debug("project path", zap.String("path", projectPath))
+	// monorepoPath: go.work 所在 DIR，没有 go.work 时为项目根 DIR
+	workspacePath, hasWorkspace := utils.GetWorkspacePath(currentPath)
+	projectPath, shortMiddle, hasProject := utils.FindRootPath(currentPath, "go.mod")
+	if !hasProject {
+		// Root of go.work monorepo may have no go.mod
+		// go.work monorepo 的根 DIR 可以没有 go.mod
+		must.True(hasWorkspace)
+		projectPath, shortMiddle = workspacePath, rese.C1(filepath.Rel(workspacePath, currentPath))
+	}
+	monorepoPath := tern.BVV(hasWorkspace, workspacePath, projectPath)
+
+	// Load project config, its values become flag defaults so flags override them
+	// 加载项目配置，其值作为参数默认值，使命令行参数可以覆盖它们
+	config := rese.P1(synckratos.LoadConfig(projectPath))
 
 	// Define command line parameters
 	// 定义命令行参数
 	var protoName string
 	flag.StringVar(&protoName, "name", "", "proto-filename. example: demo.proto / demo")
 	var autoConfirm bool
-	flag.BoolVar(&autoConfirm, "auto", false, "auto-confirm")
+	flag.BoolVar(&autoConfirm, "auto", config.Auto, "auto-confirm")
 	var maskMode bool
-	flag.BoolVar(&maskMode, "mask", true, "mask mode: match via embedded Unimplemented*Server type")
+	flag.BoolVar(&maskMode, "mask", config.Mask, "mask mode: match via embedded Unimplemented*Server type")
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "dry-run: print planned changes without writing service files")
+	var diffPath string
+	flag.StringVar(&diffPath, "diff", "", "write unified diff of service changes to file, use - as stdout")
+	var reportFormat string
+	flag.StringVar(&reportFormat, "report", "", "print sync report to stdout: json / text")
+	renames := make(map[string]string)
+	flag.Func("rename", "rename method in place when proto RPC is renamed: Old=New, repeatable", func(value string) error {
+		oldName, newName, ok := strings.Cut(value, "=")
+		if !ok || oldName == "" || newName == "" {
+			return erero.Errorf("wrong rename %q, expect Old=New", value)
+		}
+		renames[oldName] = newName
+		return nil
+	})
+	var removedPolicy string
+	flag.StringVar(&removedPolicy, "removed", config.Removed, "how to handle methods removed from proto: unexport / comment-out / move-to-file / delete / keep")
+	var useKratosCLI bool
+	flag.BoolVar(&useKratosCLI, "kratos-cli", config.KratosCLI, "generate service code via kratos proto server instead of native generation")
+	var sortStructs bool
+	flag.BoolVar(&sortStructs, "sort-structs", config.SortStructs, "sort service structs sharing a file to match service sequence in proto")
+	var registerServers bool
+	flag.BoolVar(&registerServers, "register-servers", config.RegisterServers, "register new services in NewGRPCServer/NewHTTPServer and report stale registrations")
+	var syncProviders bool
+	flag.BoolVar(&syncProviders, "sync-providers", config.SyncProviders, "append missing service constructors to ProviderSet of service package and report stale ones")
+	var pruneProviders bool
+	flag.BoolVar(&pruneProviders, "prune-providers", config.PruneProviders, "remove constructors of services defined in no proto from ProviderSet, with -sync-providers")
+	var scaffoldLayers bool
+	flag.BoolVar(&scaffoldLayers, "layers", config.Layers, "scaffold biz usecase and data repo of new services, inject usecase and wire ProviderSets")
+	var testSkeletons bool
+	flag.BoolVar(&testSkeletons, "tests", config.Tests, "add a skipped table-driven test per added method to <service>_test.go, rename tests with their methods")
+	var watchMode bool
+	flag.BoolVar(&watchMode, "watch", false, "poll *.proto under -proto-root (proto_root, api by default) and -proto-include roots, sync each proto on save")
+	var protoRoot string
+	flag.StringVar(&protoRoot, "proto-root", config.ProtoRoot, "proto DIR, relative to project root")
+	var serviceRoot string
+	flag.StringVar(&serviceRoot, "service-root", config.ServiceRoot, "service DIR, relative to project root")
+	var serverRoot string
+	flag.StringVar(&serverRoot, "server-root", config.ServerRoot, "server DIR holding grpc.go and http.go, relative to project root")
+	var bizRoot string
+	flag.StringVar(&bizRoot, "biz-root", config.BizRoot, "biz DIR of -layers, relative to project root, blank means next to service DIR")
+	var dataRoot string
+	flag.StringVar(&dataRoot, "data-root", config.DataRoot, "data DIR of -layers, relative to project root, blank means next to service DIR")
+	var stagingRoot string
+	flag.StringVar(&stagingRoot, "staging-root", config.StagingRoot, "staging DIR of regenerated services, blank means OS temp DIR")
+	// Given flags replace proto_includes of config, same as other flags
+	// 给出的参数会替换配置中的 proto_includes，与其它参数一致
+	protoIncludes := config.ProtoIncludes
+	protoIncludesSet := false
+	flag.Func("proto-include", "proto root outside project, DIR or Go module in go.mod, repeatable. services there are synced via mask type, never created", func(value string) error {
+		if !protoIncludesSet {
+			protoIncludes, protoIncludesSet = nil, true
+		}
+		protoIncludes = append(protoIncludes, value)
+		return nil
+	})
+	var undoSync bool
+	flag.BoolVar(&undoSync, "undo", false, "restore service files from the last backup, undoing the last sync")
+	var restoreID string
+	flag.StringVar(&restoreID, "restore", "", "restore service files from the backup with this id")
+	var keepBackups int
+	flag.IntVar(&keepBackups, "keep-backups", config.KeepBackups, "keep the last N backups, older ones are pruned after each sync, 0 keeps all")
+	var listBackups bool
+	flag.BoolVar(&listBackups, "list-backups", false, "list backups with the protos that triggered each sync")
+	var allApps bool
+	flag.BoolVar(&allApps, "all-apps", false, "sync each Kratos app in monorepo (DIRs with internal/service and cmd/, or go.work members), with -list-backups lists backups of each app")
+	var appName string
+	flag.StringVar(&appName, "app", "", "sync one Kratos app in monorepo, by path (app/user/service) or path element (user), with backup commands picks backups of the app")
+	var printConfig bool
+	flag.BoolVar(&printConfig, "print-config", false, "print effective config (file values overridden by flags) and exit")
 	flag.Parse()
 
+	// Diff or JSON report to stdout: move logs to stderr, keep stdout clean to pipe into other tools
+	// Switched right after parsing flags, before the first log line
+	//
+	// Diff 或 JSON 报告输出到 stdout：日志改到 stderr，使 stdout 可以直接传给其它工具
+	// 在解析参数后立即切换，早于第一行日志
+	messageOutput := os.Stdout
+	if diffPath == "-" || reportFormat == "json" {
+		zaplog.SetLog(rese.P1(zaplog.NewZapLog(zaplog.NewConfig().SetOutputPaths([]string{"stderr"}))))
+		messageOutput = os.Stderr
+	}
+	zaplog.LOG.Debug("current path", zap.String("path", currentPath))
+	zaplog.LOG.Debug("execute path", zap.String("path", executePath))
+	zaplog.LOG.Debug("project path", zap.String("path", projectPath))
+
+	// Effective config is file values overridden by flags
+	// 生效的配置是被命令行参数覆盖后的文件值
+	config.Auto = autoConfirm
+	config.Mask = maskMode
+	config.KratosCLI = useKratosCLI
+	config.SortStructs = sortStructs
+	config.RegisterServers = registerServers
+	config.SyncProviders = syncProviders
+	config.PruneProviders = pruneProviders
+	config.Layers = scaffoldLayers
+	config.Tests = testSkeletons
+	config.Removed = removedPolicy
+	config.ProtoRoot = protoRoot
+	config.ServiceRoot = serviceRoot
+	config.ServerRoot = serverRoot
+	config.BizRoot = bizRoot
+	config.DataRoot = dataRoot
+	config.StagingRoot = stagingRoot
+	config.ProtoIncludes = protoIncludes
+	config.KeepBackups = keepBackups
+	if printConfig {
+		must.Done(config.WriteYAML(os.Stdout))
+		return
+	}
+
+	// Backup commands do not sync, run them and return
+	// Apps of monorepo keep backups in their own roots, so -app and -all-apps pick those roots
+	//
+	// 备份命令不执行同步，执行后直接返回
+	// monorepo 中的应用在各自的根 DIR 中保存备份，因此 -app 和 -all-apps 选择这些根 DIR
+	if listBackups || undoSync || restoreID != "" {
+		if allApps && appName != "" {
+			zaplog.LOG.Panic("apps conflict: cannot use both -all-apps and -app")
+		}
+		backupRoot := projectPath
+		if appName != "" {
+			backupRoot = rese.P1(synckratos.FindApp(rese.V1(synckratos.DiscoverApps(monorepoPath)), appName)).Root
+		}
+		if listBackups {
+			if allApps {
+				for _, app := range rese.V1(synckratos.DiscoverApps(monorepoPath)) {
+					fmt.Println(eroticgo.BLUE.Sprint("app: " + app.Name))
+					synckratos.WriteBackups(os.Stdout, rese.V1(synckratos.ListBackups(app.Root)))
+				}
+				return
+			}
+			synckratos.WriteBackups(os.Stdout, rese.V1(synckratos.ListBackups(backupRoot)))
+			return
+		}
+		if undoSync && restoreID != "" {
+			zaplog.LOG.Panic("restore conflict: cannot use both -undo and -restore")
+		}
+		if allApps {
+			zaplog.LOG.Panic("restore conflict: backups of apps are restored one by one, use -app instead of -all-apps")
+		}
+		if !autoConfirm && !chooseConfirm("restore service files from backup?") {
+			return
+		}
+		manifest := rese.P1(synckratos.RestoreBackup(backupRoot, restoreID))
+		synckratos.WriteBackups(os.Stdout, []*synckratos.BackupManifest{manifest})
+		eroticgo.GREEN.ShowMessage("SUCCESS")
+		return
+	}
+
+	must.True(reportFormat == "" || reportFormat == "json" || reportFormat == "text")
+	if diffPath == "-" && reportFormat == "json" {
+		zaplog.LOG.Panic("stdout conflict: cannot write both -diff - and -report json to stdout")
+	}
+
+	// Dry-run writes nothing, so no confirmation is needed
+	// Dry-run 不写入任何文件，因此无需确认
+	if dryRun {
+		autoConfirm = true
+	}
+	syncOptions := &synckratos.SyncOptions{
+		MaskMode:     maskMode,
+		DryRun:       dryRun,
+		UseKratosCLI: useKratosCLI,
+		SortStructs:  sortStructs,
+		Renames:      renames,
+
+		RegisterServers: registerServers,
+		SyncProviders:   syncProviders,
+		PruneProviders:  pruneProviders,
+		Layers:          scaffoldLayers,
+		TestSkeletons:   testSkeletons,
+
+		RemovedMethodPolicy: synckratos.RemovedMethodPolicy(removedPolicy),
+
+		ProtoRoot:   protoRoot,
+		ServiceRoot: serviceRoot,
+		ServerRoot:  serverRoot,
+		BizRoot:     bizRoot,
+		DataRoot:    dataRoot,
+		StagingRoot: stagingRoot,
+		IgnoreGlobs: config.Ignore,
+
+		ProtoIncludes:  protoIncludes,
+		ImportRewrites: config.ImportRewrites,
+		Templates:      config.Templates,
+		KeepBackups:    keepBackups,
+	}
+
+	if diffPath == "-" {
+		syncOptions.DiffOutput = os.Stdout
+	} else if diffPath != "" {
+		diffFile := rese.P1(os.Create(diffPath))
+		defer rese.F0(diffFile.Close)
+		syncOptions.DiffOutput = diffFile
+	}
+
 	// Handle position args: use the first arg from command line
 	// 处理位置参数：使用命令行的第一个参数
 	if args := flag.Args(); len(args) > 0 {
@@ -88,7 +339,54 @@ func main() {
 
 	// Execute based on proto file specification
 	// 根据是否指定 proto 文件来执行
-	if protoName != "" {
+	if allApps || appName != "" {
+		// Monorepo mode syncs each app in turn, prints per-app results
+		// Monorepo 模式依次同步每个应用，打印每个应用的结果
+		if allApps && appName != "" {
+			zaplog.LOG.Panic("apps conflict: cannot use both -all-apps and -app")
+		}
+		if protoName != "" || watchMode {
+			zaplog.LOG.Panic("apps conflict: -all-apps and -app sync whole apps, cannot use with proto-name or -watch")
+		}
+		apps := rese.V1(synckratos.DiscoverApps(monorepoPath))
+		if appName != "" {
+			apps = []*synckratos.KratosApp{rese.P1(synckratos.FindApp(apps, appName))}
+		}
+		for _, app := range apps {
+			zaplog.LOG.Debug("app", zap.String("name", app.Name), zap.String("root", app.Root))
+			// Options come from the config loaded at start, config files of apps are not read
+			// 选项来自启动时加载的配置，不读取各应用的配置文件
+			if appConfigPath := filepath.Join(app.Root, synckratos.ConfigFileName); app.Root != projectPath && ossoftexist.IsFile(appConfigPath) {
+				zaplog.LOG.Warn("app config ignored, config of the DIR running the command applies to each app", zap.String("path", appConfigPath), zap.String("config", filepath.Join(projectPath, synckratos.ConfigFileName)))
+			}
+		}
+		if !autoConfirm && !chooseConfirm(fmt.Sprintf("execute sync kratos service code of %d apps?", len(apps))) {
+			return
+		}
+		appsReport, err := synckratos.SyncApps(context.Background(), apps, syncOptions)
+		if reportFormat == "json" {
+			must.Done(appsReport.WriteJSON(os.Stdout))
+		} else {
+			appsReport.WriteText(messageOutput)
+		}
+		must.Done(err)
+		showSuccess(messageOutput)
+	} else if watchMode {
+		// Watch mode syncs each saved proto, prints a summary line per changed file
+		// 监听模式同步每个保存的 proto，每个变更的文件打印一行摘要
+		if protoName != "" {
+			zaplog.LOG.Panic("watch conflict: -watch syncs each saved proto, cannot use with proto-name")
+		}
+		if reportFormat != "" {
+			zaplog.LOG.Panic("watch conflict: -watch prints summary lines, cannot use with -report")
+		}
+		if !autoConfirm && !chooseConfirm("execute watch kratos service code?") {
+			return
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		must.Done(synckratos.WatchServices(ctx, projectPath, syncOptions, &synckratos.WatchOptions{Output: messageOutput}))
+	} else if protoName != "" {
 		// Sync specific proto file mode
 		// 同步特定 proto 文件模式
 		protoName = zerotern.VF(protoName, func() string {
@@ -114,7 +412,8 @@ func main() {
 		}
 		// Sync services with the specific proto file
 		// 同步特定 proto 文件的服务
-		synckratos.GenServicesOnce(projectPath, protoPath, &synckratos.SyncOptions{MaskMode: maskMode})
+		report := rese.P1(synckratos.SyncServicesOnce(context.Background(), projectPath, protoPath, syncOptions))
+		showReport(report, reportFormat, messageOutput)
 	} else {
 		// Sync each proto file mode. Ask to confirm service sync (unless auto-confirm enabled)
 		// 同步所有 proto 文件模式。确认服务同步（除非启用自动确认）
@@ -123,8 +422,34 @@ func main() {
 		}
 		// Sync each service in the project
 		// 同步项目中的所有服务
-		synckratos.GenServicesCode(projectPath, &synckratos.SyncOptions{MaskMode: maskMode})
+		report := rese.P1(synckratos.SyncServices(context.Background(), projectPath, syncOptions))
+		showReport(report, reportFormat, messageOutput)
+	}
+}
+
+// showReport prints sync report in requested format, then success message
+// Dry-run prints text report by default
+//
+// showReport 按指定格式打印同步报告，然后打印成功消息
+// dry-run 默认打印文本报告
+func showReport(report *synckratos.SyncReport, reportFormat string, messageOutput *os.File) {
+	switch {
+	case reportFormat == "json":
+		must.Done(report.WriteJSON(os.Stdout))
+	case reportFormat == "text" || report.DryRun:
+		report.WriteText(messageOutput)
+	}
+	showSuccess(messageOutput)
+}
+
+// showSuccess prints success message, plain line when messages go to stderr
+// showSuccess 打印成功消息，消息输出到 stderr 时打印普通行
+func showSuccess(messageOutput *os.File) {
+	if messageOutput != os.Stdout {
+		_, _ = fmt.Fprintln(messageOutput, eroticgo.GREEN.Sprint("SUCCESS"))
+		return
 	}
+	eroticgo.GREEN.ShowMessage("SUCCESS")
 }
 
 // chooseConfirm shows a confirmation prompt with Y/N selection
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/orzkratos/orzkratos/synckratos"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+)
+
+// TestStdoutOutputs tests -report json and -diff - keep stdout clean, logs go to stderr
+// TestStdoutOutputs 测试 -report json 和 -diff - 保持 stdout 干净，日志输出到 stderr
+func TestStdoutOutputs(t *testing.T) {
+	binaryPath := filepath.Join(t.TempDir(), "orzkratos-srv-proto")
+	output, err := exec.Command("go", "build", "-o", binaryPath, ".").CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	projectRoot := t.TempDir()
+	writeFile := func(path string, content string) {
+		path = filepath.Join(projectRoot, path)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+	}
+	writeFile("go.mod", "module demo\n\ngo 1.22\n")
+	writeFile("api/helloworld/v1/greeter.proto", `syntax = "proto3";
+package helloworld.v1;
+option go_package = "demo/api/helloworld/v1;v1";
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+}
+message HelloRequest {}
+message HelloReply {}
+`)
+	run := func(args ...string) string {
+		var stdout, stderr bytes.Buffer
+		command := exec.Command(binaryPath, args...)
+		command.Dir = projectRoot
+		command.Stdout = &stdout
+		command.Stderr = &stderr
+		require.NoError(t, command.Run(), stderr.String())
+		t.Log(stderr.String())
+		return stdout.String()
+	}
+
+	// Unified diff only, first line is the file header
+	// 只有统一 diff，第一行是文件头
+	stdout := run("-auto", "-dry-run", "-diff", "-")
+	t.Log(stdout)
+	require.True(t, strings.HasPrefix(stdout, "diff --git "), stdout)
+	require.Contains(t, stdout, "+++ b/internal/service/greeter.go")
+	require.NotContains(t, stdout, "DEBUG")
+
+	// JSON report only, decodes as a whole
+	// 只有 JSON 报告，可以整体解码
+	stdout = run("-auto", "-report", "json")
+	report := &synckratos.SyncReport{}
+	decoder := json.NewDecoder(strings.NewReader(stdout))
+	require.NoError(t, decoder.Decode(report), stdout)
+	require.False(t, decoder.More(), stdout)
+	require.Len(t, report.Protos, 1)
+	require.Equal(t, "api/helloworld/v1/greeter.proto", report.Protos[0].Path)
+}
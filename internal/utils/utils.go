@@ -68,12 +68,18 @@ func CopyBytes(src []byte) []byte {
 	return dst
 }
 
+// FormatCode formats raw Go code, keeps raw code when format fails
+// 对原始 Go 代码进行格式化，格式化失败时保留原始代码
+func FormatCode(data []byte) []byte {
+	code, _ := formatgo.FormatBytes(data)
+	must.Have(code)
+	return code
+}
+
 // FormatAndWriteCode formats raw Go code and writes to file
 // 对原始 Go 代码进行格式化并写入文件
 func FormatAndWriteCode(path string, data []byte) {
-	code, _ := formatgo.FormatBytes(data)
-	must.Have(code)
-	must.Done(os.WriteFile(path, code, 0644))
+	must.Done(os.WriteFile(path, FormatCode(data), 0644))
 }
 
 // GetProjectPath finds project root via go.mod file location
@@ -82,16 +88,39 @@ func FormatAndWriteCode(path string, data []byte) {
 // GetProjectPath 通过定位 go.mod 文件找到项目根路径
 // 返回项目根路径和从当前位置到根路径的相对路径
 func GetProjectPath(currentPath string) (string, string) {
-	projectPath := currentPath
+	projectPath, shortMiddle, ok := FindRootPath(currentPath, "go.mod")
+	must.True(ok) // Ensure go.mod found before reaching root // 确保在到达根路径前找到 go.mod
+	return projectPath, shortMiddle
+}
+
+// GetWorkspacePath finds monorepo root via go.work file location
+// Returns false when no go.work is found
+//
+// GetWorkspacePath 通过定位 go.work 文件找到 monorepo 根路径
+// 找不到 go.work 时返回 false
+func GetWorkspacePath(currentPath string) (string, bool) {
+	workspacePath, _, ok := FindRootPath(currentPath, "go.work")
+	return workspacePath, ok
+}
+
+// FindRootPath finds the nearest DIR holding file name, from current path upwards
+// Returns the DIR, relative path from it to current, and false when reaching root without it
+//
+// FindRootPath 从当前路径向上查找包含指定文件的最近 DIR
+// 返回该 DIR、从该 DIR 到当前位置的相对路径，到达根路径仍未找到时返回 false
+func FindRootPath(currentPath string, name string) (string, string, bool) {
+	rootPath := currentPath
 	shortMiddle := ""
-	for !osomitexist.IsFile(filepath.Join(projectPath, "go.mod")) {
-		subName := filepath.Base(projectPath) // Extract current DIR name // 提取当前 DIR 名称
+	for !osomitexist.IsFile(filepath.Join(rootPath, name)) {
+		subName := filepath.Base(rootPath) // Extract current DIR name // 提取当前 DIR 名称
 
-		prePath := filepath.Dir(projectPath)
-		must.Different(prePath, projectPath) // Ensure not stuck at root // 确保没有卡在根路径
+		prePath := filepath.Dir(rootPath)
+		if prePath == rootPath {
+			return "", "", false // Stuck at root // 已到达根路径
+		}
 
-		projectPath = prePath
+		rootPath = prePath
 		shortMiddle = filepath.Join(subName, shortMiddle) // Build relative path // 构建相对路径
 	}
-	return projectPath, shortMiddle
+	return rootPath, shortMiddle, true
 }
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -18,6 +19,20 @@ func TestGetProjectPath(t *testing.T) {
 	t.Log(shortMiddle)
 }
 
+// TestFindRootPath tests finding go.mod and missing go.work
+// TestFindRootPath 测试查找 go.mod 和不存在的 go.work
+func TestFindRootPath(t *testing.T) {
+	path := runpath.PARENT.Path()
+
+	projectPath, shortMiddle, ok := FindRootPath(path, "go.mod")
+	require.True(t, ok)
+	require.Equal(t, "internal/utils", filepath.ToSlash(shortMiddle))
+	require.Equal(t, path, filepath.Join(projectPath, shortMiddle))
+
+	_, _, ok = FindRootPath(path, "not-exist.work")
+	require.False(t, ok)
+}
+
 // TestHasFiles tests file existence check in DIR
 // TestHasFiles 测试 DIR 中的文件存在性检查
 func TestHasFiles(t *testing.T) {
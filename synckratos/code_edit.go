@@ -0,0 +1,170 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yyle88/syntaxgo/syntaxgo_ast"
+)
+
+// textEdit replaces code between pos and end with text
+// textEdit 将 pos 和 end 之间的代码替换为 text
+type textEdit struct {
+	pos  token.Pos // Start position // 起始位置
+	end  token.Pos // End position // 结束位置
+	text string    // Replacement text // 替换文本
+}
+
+// applyTextEdits applies non-overlapping edits to code, from back to front
+// Positions come from parsing the code in a fresh FileSet, offset is pos-1
+//
+// applyTextEdits 从后往前将互不重叠的编辑应用到代码
+// 位置来自在新 FileSet 中解析该代码，偏移量为 pos-1
+func applyTextEdits(code []byte, edits []*textEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].pos > edits[j].pos
+	})
+	source := string(code)
+	for _, edit := range edits {
+		source = source[:edit.pos-1] + edit.text + source[edit.end-1:]
+	}
+	return []byte(source)
+}
+
+// importName returns the name used to refer to imported package
+// Uses explicit alias when present, else the last element of import path
+//
+// importName 返回引用导入包时使用的名称
+// 有显式别名时使用别名，否则使用导入路径的最后一段
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	return path.Base(importPath(spec))
+}
+
+// importPath returns unquoted import path
+// importPath 返回去掉引号的导入路径
+func importPath(spec *ast.ImportSpec) string {
+	value, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return spec.Path.Value
+	}
+	return value
+}
+
+// importPathMap builds map from import name to import path
+// importPathMap 构建导入名称到导入路径的映射
+func importPathMap(astFile *ast.File) map[string]string {
+	result := make(map[string]string, len(astFile.Imports))
+	for _, spec := range astFile.Imports {
+		result[importName(spec)] = importPath(spec)
+	}
+	return result
+}
+
+// importNameMap builds map from import path to import name
+// importNameMap 构建导入路径到导入名称的映射
+func importNameMap(astFile *ast.File) map[string]string {
+	result := make(map[string]string, len(astFile.Imports))
+	for _, spec := range astFile.Imports {
+		result[importPath(spec)] = importName(spec)
+	}
+	return result
+}
+
+// addNamedImports adds imports (path to name map) into Go code
+// Adds alias only when name differs from last element of path, or the path ends with a version, e.g. "v1"
+// Since formatting assumes package of "demo/api/helloworld/v1" is "helloworld", and drops the import without alias
+//
+// addNamedImports 将导入（路径到名称的映射）添加到 Go 代码中
+// 仅当名称与路径最后一段不同，或路径以版本结尾（例如 "v1"）时才添加别名
+// 因为格式化会假定 "demo/api/helloworld/v1" 的包名是 "helloworld"，并删除没有别名的导入
+func addNamedImports(code []byte, imports map[string]string) ([]byte, error) {
+	if len(imports) == 0 {
+		return code, nil
+	}
+	astBundle, err := syntaxgo_ast.NewAstBundleV1(code)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(imports))
+	for pkgPath := range imports {
+		paths = append(paths, pkgPath)
+	}
+	sort.Strings(paths)
+	for _, pkgPath := range paths {
+		if name := imports[pkgPath]; name != path.Base(pkgPath) || isVersionElem(name) {
+			astBundle.AddNamedImport(name, pkgPath)
+		} else {
+			astBundle.AddImport(pkgPath)
+		}
+	}
+	return astBundle.FormatSource()
+}
+
+// isVersionElem checks if path element is a major version, e.g. "v1"
+// isVersionElem 检查路径段是否为主版本号，例如 "v1"
+func isVersionElem(elem string) bool {
+	digits, ok := strings.CutPrefix(elem, "v")
+	if !ok || digits == "" {
+		return false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pickImportName returns import name not in takenNames (import name to import path)
+// Tries name first, then baseName, then baseName with numbers, e.g. "userv12"
+//
+// pickImportName 返回不在 takenNames（导入名称到导入路径的映射）中的导入名称
+// 先尝试 name，然后是 baseName，然后是带数字的 baseName，例如 "userv12"
+func pickImportName(takenNames map[string]string, name string, baseName string) string {
+	for idx := 1; takenNames[name] != ""; idx++ {
+		name = baseName
+		if idx > 1 {
+			name = baseName + strconv.Itoa(idx)
+		}
+	}
+	return name
+}
+
+// qualifyExprText returns source text of expr with package names switched
+// Package names are switched via rename map, e.g. "pb" -> "v1"
+// Nested selectors such as "pb.X.Y" are followed down to the leftmost name
+//
+// qualifyExprText 返回切换了包名的 expr 源码文本
+// 包名通过 rename 映射切换，例如 "pb" -> "v1"
+// 嵌套的选择器如 "pb.X.Y" 会一直追溯到最左侧的名称
+func qualifyExprText(code []byte, expr ast.Node, rename map[string]string) string {
+	var edits []*textEdit
+	ast.Inspect(expr, func(node ast.Node) bool {
+		selectorExpr, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := selectorExpr.X.(*ast.Ident)
+		if !ok {
+			// Left side is an expr such as "pb.X" of "pb.X.Y", or a call, inspect it
+			// 左侧是表达式，例如 "pb.X.Y" 中的 "pb.X" 或函数调用，继续检查
+			return true
+		}
+		if name, ok := rename[ident.Name]; ok && name != ident.Name {
+			edits = append(edits, &textEdit{
+				pos:  ident.Pos() - expr.Pos() + 1,
+				end:  ident.End() - expr.Pos() + 1,
+				text: name,
+			})
+		}
+		return false
+	})
+	return string(applyTextEdits(code[expr.Pos()-1:expr.End()-1], edits))
+}
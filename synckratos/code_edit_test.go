@@ -0,0 +1,35 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/rese"
+)
+
+// TestQualifyExprText tests package names switched in plain and nested selectors
+// TestQualifyExprText 测试在普通和嵌套的选择器中切换包名
+func TestQualifyExprText(t *testing.T) {
+	code := []byte(`package service
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Status: pb.Status_OK, Kind: pb.Kind.String(pb.Kind_A), Name: req.Name}, s.uc.Check(ctx)
+}
+`)
+	astFile := rese.P1(parser.ParseFile(token.NewFileSet(), "", code, 0))
+	method := astFile.Decls[0].(*ast.FuncDecl)
+
+	text := qualifyExprText(code, method, map[string]string{"pb": "v1"})
+	t.Log(text)
+	require.Contains(t, text, "req *v1.HelloRequest) (*v1.HelloReply, error)")
+	require.Contains(t, text, "&v1.HelloReply{Status: v1.Status_OK, Kind: v1.Kind.String(v1.Kind_A), Name: req.Name}")
+	require.Contains(t, text, "s.uc.Check(ctx)")
+	require.NotContains(t, text, "pb.")
+
+	// Same names are kept as they are
+	// 相同的名称保持不变
+	require.Equal(t, string(code[method.Pos()-1:method.End()-1]), qualifyExprText(code, method, map[string]string{"pb": "pb"}))
+}
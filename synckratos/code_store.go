@@ -0,0 +1,283 @@
+package synckratos
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/orzkratos/orzkratos/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexistpath/ossoftexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// codeStore keeps service file contents in memory during one sync run
+// Reads fall back to disk on first access, writes stay in memory until flush
+// Lets dry-run share the same pipeline without touching source files
+//
+// codeStore 在一次同步过程中将服务文件内容保存在内存中
+// 首次读取时回退到磁盘，写入在 flush 前只保存在内存中
+// 使 dry-run 共用相同的流程而不修改源文件
+type codeStore struct {
+	files map[string]*storeFile // File path to stored file map // 文件路径到存储文件的映射
+	paths []string              // Paths in first-touch sequence // 按首次访问顺序排列的路径
+}
+
+// storeFile holds old and new content of one service file
+// storeFile 保存单个服务文件的旧内容和新内容
+type storeFile struct {
+	path    string // File path // 文件路径
+	oldCode []byte // Content on disk before sync, nil when created // 同步前磁盘上的内容，新建时为 nil
+	newCode []byte // Content after sync steps // 同步步骤后的内容
+	created bool   // File does not exist on disk // 文件在磁盘上不存在
+}
+
+// newCodeStore creates an empty codeStore
+// newCodeStore 创建空的 codeStore
+func newCodeStore() *codeStore {
+	return &codeStore{
+		files: make(map[string]*storeFile),
+	}
+}
+
+// exists checks if file exists in store or on disk
+// exists 检查文件是否存在于存储或磁盘中
+func (cs *codeStore) exists(path string) bool {
+	if _, ok := cs.files[path]; ok {
+		return true
+	}
+	return ossoftexist.IsFile(path)
+}
+
+// read returns current content of file, loads from disk on first access
+// read 返回文件的当前内容，首次访问时从磁盘加载
+func (cs *codeStore) read(path string) ([]byte, error) {
+	if file, ok := cs.files[path]; ok {
+		return file.newCode, nil
+	}
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newSyncError(ErrorKindReadFailure, path, err)
+	}
+	cs.track(&storeFile{
+		path:    path,
+		oldCode: code,
+		newCode: code,
+	})
+	return code, nil
+}
+
+// write formats code and saves it as new content of file
+// write 格式化代码并保存为文件的新内容
+func (cs *codeStore) write(path string, code []byte) error {
+	// Load old content first
+	// 先加载旧内容
+	if _, err := cs.read(path); err != nil {
+		return err
+	}
+	cs.files[path].newCode = utils.FormatCode(code)
+	return nil
+}
+
+// create adds a new file into store, skips when file exists
+// Same as kratos, which does not overwrite existing service files
+//
+// create 向存储中添加新文件，文件已存在时跳过
+// 与 kratos 一致，不覆盖已有的服务文件
+func (cs *codeStore) create(path string, code []byte) bool {
+	if cs.exists(path) {
+		zaplog.LOG.Debug("file already exists, skip create", zap.String("path", path))
+		return false
+	}
+	cs.track(&storeFile{
+		path:    path,
+		newCode: utils.FormatCode(code),
+		created: true,
+	})
+	return true
+}
+
+// track registers file in store
+// track 在存储中登记文件
+func (cs *codeStore) track(file *storeFile) {
+	cs.files[file.path] = file
+	cs.paths = append(cs.paths, file.path)
+}
+
+// changedFiles returns files created or modified in sync, in first-touch sequence
+// changedFiles 返回同步中新建或修改的文件，按首次访问顺序
+func (cs *codeStore) changedFiles() []*storeFile {
+	var files []*storeFile
+	for _, path := range cs.paths {
+		file := cs.files[path]
+		if file.created || !bytes.Equal(file.oldCode, file.newCode) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// verify parses each changed file, so a sync never writes broken Go code
+// verify 解析每个有改动的文件，使同步不会写入损坏的 Go 代码
+func (cs *codeStore) verify() error {
+	for _, file := range cs.changedFiles() {
+		if _, err := parser.ParseFile(token.NewFileSet(), file.path, file.newCode, parser.SkipObjectResolution); err != nil {
+			return newSyncError(ErrorKindParseFailure, file.path, err)
+		}
+	}
+	return nil
+}
+
+// flush writes changed files to disk, all or nothing
+// Verifies each file first, then writes each one via temp file and rename,
+// on failure restores written files and removes created ones and their new DIRs
+//
+// flush 将有改动的文件写入磁盘，要么全部写入要么全部不写
+// 先校验每个文件，再通过临时文件和重命名逐个写入，
+// 失败时恢复已写入的文件并删除新建的文件及其新建的 DIR
+func (cs *codeStore) flush() error {
+	if err := cs.verify(); err != nil {
+		return err
+	}
+	var written []*storeFile // Files already written // 已写入的文件
+	var newRoots []string    // DIRs created in flush // flush 中新建的 DIR
+	for _, file := range cs.changedFiles() {
+		zaplog.LOG.Debug("write file", zap.String("path", file.path), zap.Bool("created", file.created))
+		root := filepath.Dir(file.path)
+		if !ossoftexist.IsRoot(root) {
+			newRoots = append(newRoots, nearestMissingRoot(root))
+			if err := os.MkdirAll(root, 0755); err != nil {
+				cs.rollback(written, newRoots)
+				return newSyncError(ErrorKindWriteFailure, root, err)
+			}
+		}
+		if err := writeFileAtomic(file.path, file.newCode); err != nil {
+			cs.rollback(written, newRoots)
+			return newSyncError(ErrorKindWriteFailure, file.path, err)
+		}
+		written = append(written, file)
+	}
+	return nil
+}
+
+// rollback restores written files to old content, removes created files and DIRs
+// Failures are logged, the write failure is what gets returned
+//
+// rollback 将已写入的文件恢复为旧内容，删除新建的文件和 DIR
+// 失败只记录日志，返回的是写入失败本身
+func (cs *codeStore) rollback(written []*storeFile, newRoots []string) {
+	for idx := len(written) - 1; idx >= 0; idx-- {
+		file := written[idx]
+		zaplog.LOG.Debug("rollback file", zap.String("path", file.path), zap.Bool("created", file.created))
+		if file.created {
+			if err := os.Remove(file.path); err != nil {
+				zaplog.LOG.Warn("rollback remove file failed", zap.String("path", file.path), zap.Error(err))
+			}
+			continue
+		}
+		if err := writeFileAtomic(file.path, file.oldCode); err != nil {
+			zaplog.LOG.Warn("rollback restore file failed", zap.String("path", file.path), zap.Error(err))
+		}
+	}
+	for idx := len(newRoots) - 1; idx >= 0; idx-- {
+		if err := os.RemoveAll(newRoots[idx]); err != nil {
+			zaplog.LOG.Warn("rollback remove DIR failed", zap.String("path", newRoots[idx]), zap.Error(err))
+		}
+	}
+}
+
+// nearestMissingRoot returns the topmost missing DIR on the way to root
+// nearestMissingRoot 返回通往 root 路径上最顶层的缺失 DIR
+func nearestMissingRoot(root string) string {
+	for parent := filepath.Dir(root); parent != root && !ossoftexist.IsRoot(parent); parent = filepath.Dir(root) {
+		root = parent
+	}
+	return root
+}
+
+// writeFileAtomic writes code into temp file in same DIR, then renames it onto path
+// Keeps file mode of existing file, readers never see a half-written file
+//
+// writeFileAtomic 将代码写入同一 DIR 中的临时文件，再重命名到目标路径
+// 保留已有文件的权限，读取方不会看到写了一半的文件
+func writeFileAtomic(path string, code []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return erero.Wro(err)
+	}
+	tempPath := tempFile.Name()
+	if err := writeTempFile(tempFile, code, mode); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// writeTempFile writes code into temp file, syncs and closes it
+// writeTempFile 将代码写入临时文件，同步并关闭
+func writeTempFile(tempFile *os.File, code []byte, mode os.FileMode) error {
+	if _, err := tempFile.Write(code); err != nil {
+		_ = tempFile.Close()
+		return erero.Wro(err)
+	}
+	if err := tempFile.Chmod(mode); err != nil {
+		_ = tempFile.Close()
+		return erero.Wro(err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		_ = tempFile.Close()
+		return erero.Wro(err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// listGoFiles lists Go files under root on disk and in store
+// Skips staging DIRs, and tmp/ sub-DIR left by older versions, to avoid scanning temp files
+//
+// listGoFiles 列出磁盘上和存储中 root 下的 Go 文件
+// 跳过暂存 DIR 以及旧版本留下的 tmp/ 子 DIR，以避免扫描临时文件
+func (cs *codeStore) listGoFiles(root string) []string {
+	pathSet := make(map[string]bool)
+	_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		// Skip staging and tmp DIRs
+		// 跳过暂存和 tmp DIR
+		if info.IsDir() && (info.Name() == "tmp" || strings.HasPrefix(info.Name(), "orzkratos_staging_")) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") {
+			return nil
+		}
+		pathSet[path] = true
+		return nil
+	})
+	for _, path := range cs.paths {
+		if strings.HasPrefix(path, root+string(filepath.Separator)) && strings.HasSuffix(path, ".go") {
+			pathSet[path] = true
+		}
+	}
+	paths := make([]string, 0, len(pathSet))
+	for path := range pathSet {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,80 @@
+package synckratos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestCodeStoreFlush tests flush writes each changed file, keeping file mode
+// TestCodeStoreFlush 测试 flush 写入每个有改动的文件，并保留文件权限
+func TestCodeStoreFlush(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_store_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	oldPath := filepath.Join(tempRoot, "greeter.go")
+	must.Done(os.WriteFile(oldPath, []byte("package service\n"), 0600))
+
+	store := newCodeStore()
+	require.NoError(t, store.write(oldPath, []byte("package service\n\nfunc SayHello() {}\n")))
+	require.True(t, store.create(filepath.Join(tempRoot, "sub/user.go"), []byte("package service\n")))
+	require.NoError(t, store.flush())
+
+	require.Equal(t, "package service\n\nfunc SayHello() {}\n", string(rese.V1(os.ReadFile(oldPath))))
+	require.Equal(t, os.FileMode(0600), rese.V1(os.Stat(oldPath)).Mode().Perm())
+	require.Equal(t, "package service\n", string(rese.V1(os.ReadFile(filepath.Join(tempRoot, "sub/user.go")))))
+
+	// No temp files left behind
+	// 不留下临时文件
+	entries := rese.V1(os.ReadDir(tempRoot))
+	require.Len(t, entries, 2)
+}
+
+// TestCodeStoreFlushRollback tests flush leaves the tree untouched on failure
+// TestCodeStoreFlushRollback 测试 flush 失败时保持文件树不变
+func TestCodeStoreFlushRollback(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_store_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	oldContent := "package service\n\nfunc SayHello() {}\n"
+	oldPath := filepath.Join(tempRoot, "greeter.go")
+	must.Done(os.WriteFile(oldPath, []byte(oldContent), 0644))
+
+	t.Run("parse-failure", func(t *testing.T) {
+		store := newCodeStore()
+		require.NoError(t, store.write(oldPath, []byte("package service\n\nfunc SayWorld() {}\n")))
+		require.True(t, store.create(filepath.Join(tempRoot, "broken.go"), []byte("package service\n\nfunc Broken( {\n")))
+
+		err := store.flush()
+		require.True(t, IsErrorKind(err, ErrorKindParseFailure))
+		require.Equal(t, oldContent, string(rese.V1(os.ReadFile(oldPath))))
+		require.NoFileExists(t, filepath.Join(tempRoot, "broken.go"))
+	})
+
+	t.Run("write-failure", func(t *testing.T) {
+		// A non-empty DIR at the target path makes the rename fail after other files are written
+		// 目标路径上的非空 DIR 使重命名在其它文件写入后失败
+		blockPath := filepath.Join(tempRoot, "block.go")
+		must.Done(os.MkdirAll(filepath.Join(blockPath, "keep"), 0755))
+
+		store := newCodeStore()
+		require.NoError(t, store.write(oldPath, []byte("package service\n\nfunc SayWorld() {}\n")))
+		require.True(t, store.create(filepath.Join(tempRoot, "new/user.go"), []byte("package service\n")))
+		require.True(t, store.create(blockPath, []byte("package service\n")))
+
+		err := store.flush()
+		require.True(t, IsErrorKind(err, ErrorKindWriteFailure))
+		t.Log(err)
+		require.Equal(t, oldContent, string(rese.V1(os.ReadFile(oldPath))))
+		require.NoDirExists(t, filepath.Join(tempRoot, "new"))
+		require.DirExists(t, filepath.Join(blockPath, "keep"))
+	})
+}
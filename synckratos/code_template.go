@@ -0,0 +1,91 @@
+package synckratos
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// Templates holds paths of text/template files replacing built-in ones, blank means built-in
+// Relative paths are joined with project root
+//
+// Templates 保存替换内置模板的 text/template 文件路径，为空时使用内置模板
+// 相对路径会拼接到项目根 DIR
+type Templates struct {
+	Service string `yaml:"service"` // Whole file of new service // 新服务的整个文件
+	Method  string `yaml:"method"`  // Body of each generated method, in new service files and added methods // 每个生成方法的方法体，用于新服务文件和新增的方法
+	Biz     string `yaml:"biz"`     // Biz layer file of new service, see SyncOptions.Layers // 新服务的 biz 层文件，参见 SyncOptions.Layers
+	Data    string `yaml:"data"`    // Data layer file of new service, see SyncOptions.Layers // 新服务的 data 层文件，参见 SyncOptions.Layers
+}
+
+// templateFuncs are functions usable in templates
+// templateFuncs 是模板中可用的函数
+var templateFuncs = template.FuncMap{
+	// comment turns text into "// " prefixed lines, blank text gives blank output
+	// comment 将文本转为带 "// " 前缀的行，空文本输出为空
+	"comment": func(text string) string {
+		if text == "" {
+			return ""
+		}
+		return "// " + strings.ReplaceAll(text, "\n", "\n// ")
+	},
+	// import declares an import of generated code, see importFuncs, it does nothing in other templates
+	// import 声明生成代码的导入，参见 importFuncs，在其它模板中不起作用
+	"import": func(pkgPath string, names ...string) string {
+		return ""
+	},
+}
+
+// importFuncs returns the "import" function collecting imports into map of import path to import name
+// Usage: {{ import "github.com/go-kratos/kratos/v2/errors" }}, with alias: {{ import "github.com/acme/log/v2" "log" }}
+// Service and method templates use it, so methods added to existing files bring their imports too
+//
+// importFuncs 返回将导入收集到导入路径到导入名称映射中的 "import" 函数
+// 用法: {{ import "github.com/go-kratos/kratos/v2/errors" }}，带别名: {{ import "github.com/acme/log/v2" "log" }}
+// 服务和方法模板使用它，使添加到现有文件的方法也带上其导入
+func importFuncs(imports map[string]string) template.FuncMap {
+	return template.FuncMap{
+		"import": func(pkgPath string, names ...string) string {
+			name := path.Base(pkgPath)
+			if len(names) > 0 {
+				name = names[0]
+			}
+			imports[pkgPath] = name
+			return ""
+		},
+	}
+}
+
+// loadTemplate parses template file at path, or builtin text when path is blank
+// Returns read-failure when file cannot be read, bad-option when template does not parse
+//
+// loadTemplate 解析 path 处的模板文件，path 为空时解析内置文本
+// 文件无法读取时返回 read-failure，模板无法解析时返回 bad-option
+func loadTemplate(projectRoot string, path string, name string, builtin string) (*template.Template, error) {
+	text := builtin
+	if path != "" {
+		path = resolveRoot(projectRoot, path, "")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, newSyncError(ErrorKindReadFailure, path, err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, newSyncError(ErrorKindBadOption, "templates."+name, err)
+	}
+	return tmpl, nil
+}
+
+// executeTemplate renders template with data, failures are bad-option since templates come from users
+// executeTemplate 使用数据渲染模板，模板来自用户，因此失败时返回 bad-option
+func executeTemplate(tmpl *template.Template, data any) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return nil, newSyncError(ErrorKindBadOption, "templates."+tmpl.Name(), err)
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,71 @@
+package synckratos
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/yyle88/erero"
+)
+
+// writeUnifiedDiff writes git-apply compatible unified diff of changed files
+// Paths are relative to project root, created files diff against /dev/null
+//
+// writeUnifiedDiff 写出与 git apply 兼容的统一 diff
+// 路径相对于项目根 DIR，新建文件与 /dev/null 对比
+func writeUnifiedDiff(w io.Writer, projectRoot string, files []*storeFile) error {
+	for _, file := range files {
+		path := file.path
+		if rel, err := filepath.Rel(projectRoot, path); err == nil {
+			path = rel
+		}
+		path = filepath.ToSlash(path)
+
+		// Git extended header lets git apply know about new files
+		// Git 扩展头让 git apply 识别新建的文件
+		header := fmt.Sprintf("diff --git a/%s b/%s\n", path, path)
+		fromFile := "a/" + path
+		if file.created {
+			header += "new file mode 100644\n"
+			fromFile = "/dev/null"
+		}
+
+		text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitDiffLines(string(file.oldCode)),
+			B:        splitDiffLines(string(file.newCode)),
+			FromFile: fromFile,
+			ToFile:   "b/" + path,
+			Context:  3,
+		})
+		if err != nil {
+			return erero.Wro(err)
+		}
+		if text == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, header+text); err != nil {
+			return erero.Wro(err)
+		}
+	}
+	return nil
+}
+
+// splitDiffLines splits text into lines keeping line ends
+// Marks last line without line end in the way diff and git apply expect
+//
+// splitDiffLines 将文本拆分为保留行尾的行
+// 按 diff 和 git apply 的约定标记没有行尾的最后一行
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if last := lines[len(lines)-1]; last == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] = last + "\n\\ No newline at end of file\n"
+	}
+	return lines
+}
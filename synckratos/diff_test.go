@@ -0,0 +1,58 @@
+package synckratos
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteUnifiedDiff tests unified diff of modified and created files
+// TestWriteUnifiedDiff 测试修改文件和新建文件的统一 diff
+func TestWriteUnifiedDiff(t *testing.T) {
+	projectRoot := filepath.Join("/", "demo")
+	files := []*storeFile{
+		{
+			path:    filepath.Join(projectRoot, "internal/service/greeter.go"),
+			oldCode: []byte("package service\n\nfunc (s *GreeterService) SayBye() {}\n"),
+			newCode: []byte("package service\n\nfunc (s *GreeterService) sayBye() {}\n"),
+		},
+		{
+			path:    filepath.Join(projectRoot, "internal/service/user.go"),
+			newCode: []byte("package service\n\ntype UserService struct{}\n"),
+			created: true,
+		},
+	}
+
+	var buffer bytes.Buffer
+	require.NoError(t, writeUnifiedDiff(&buffer, projectRoot, files))
+	t.Log(buffer.String())
+
+	expected := `diff --git a/internal/service/greeter.go b/internal/service/greeter.go
+--- a/internal/service/greeter.go
++++ b/internal/service/greeter.go
+@@ -1,3 +1,3 @@
+ package service
+ 
+-func (s *GreeterService) SayBye() {}
++func (s *GreeterService) sayBye() {}
+diff --git a/internal/service/user.go b/internal/service/user.go
+new file mode 100644
+--- /dev/null
++++ b/internal/service/user.go
+@@ -0,0 +1,3 @@
++package service
++
++type UserService struct{}
+`
+	require.Equal(t, expected, buffer.String())
+}
+
+// TestSplitDiffLines tests line split with and without last line end
+// TestSplitDiffLines 测试有无最后行尾时的行拆分
+func TestSplitDiffLines(t *testing.T) {
+	require.Empty(t, splitDiffLines(""))
+	require.Equal(t, []string{"a\n", "b\n"}, splitDiffLines("a\nb\n"))
+	require.Equal(t, []string{"a\n", "b\n\\ No newline at end of file\n"}, splitDiffLines("a\nb"))
+}
@@ -0,0 +1,64 @@
+package synckratos
+
+import (
+	"fmt"
+
+	"github.com/yyle88/erero"
+)
+
+// ErrorKind classifies failures of sync run
+// ErrorKind 对同步过程中的失败进行分类
+type ErrorKind string
+
+const (
+	ErrorKindMissingTool  ErrorKind = "missing-tool"   // kratos binary not found in PATH // PATH 中找不到 kratos 命令
+	ErrorKindToolFailure  ErrorKind = "tool-failure"   // kratos command exits with failure // kratos 命令执行失败
+	ErrorKindPathNotFound ErrorKind = "path-not-found" // Project root or proto file not found // 找不到项目根 DIR 或 proto 文件
+	ErrorKindReadFailure  ErrorKind = "read-failure"   // Cannot read file or DIR // 无法读取文件或 DIR
+	ErrorKindParseFailure ErrorKind = "parse-failure"  // Cannot parse Go or proto source // 无法解析 Go 或 proto 源码
+	ErrorKindWriteFailure ErrorKind = "write-failure"  // Cannot write file or DIR // 无法写入文件或 DIR
+	ErrorKindBadOption    ErrorKind = "bad-option"     // Sync option has unsupported value // 同步选项的值不受支持
+)
+
+// SyncError describes a failure of sync run with its kind and path
+// Use errors.As to get it, or IsErrorKind to check the kind
+//
+// SyncError 描述同步过程中的失败，包含失败类型和路径
+// 使用 errors.As 获取，或使用 IsErrorKind 检查类型
+type SyncError struct {
+	Kind ErrorKind // Failure kind // 失败类型
+	Path string    // File or DIR path related to failure // 与失败相关的文件或 DIR 路径
+	Err  error     // Underlying cause // 底层原因
+}
+
+// newSyncError creates a SyncError with kind, path and cause
+// newSyncError 使用类型、路径和原因创建 SyncError
+func newSyncError(kind ErrorKind, path string, err error) *SyncError {
+	return &SyncError{
+		Kind: kind,
+		Path: path,
+		Err:  err,
+	}
+}
+
+// Error returns message with kind, path and cause
+// Error 返回包含类型、路径和原因的消息
+func (e *SyncError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Kind, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying cause
+// Unwrap 返回底层原因
+func (e *SyncError) Unwrap() error {
+	return e.Err
+}
+
+// IsErrorKind checks if err is a SyncError of given kind
+// IsErrorKind 检查 err 是否为指定类型的 SyncError
+func IsErrorKind(err error, kind ErrorKind) bool {
+	var syncError *SyncError
+	if erero.As(err, &syncError) {
+		return syncError.Kind == kind
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package synckratos
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+)
+
+// TestIsErrorKind tests kind check of wrapped SyncError
+// TestIsErrorKind 测试被包装的 SyncError 的类型检查
+func TestIsErrorKind(t *testing.T) {
+	err := erero.Wro(newSyncError(ErrorKindMissingTool, "kratos", os.ErrNotExist))
+	require.True(t, IsErrorKind(err, ErrorKindMissingTool))
+	require.False(t, IsErrorKind(err, ErrorKindWriteFailure))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	var syncError *SyncError
+	require.ErrorAs(t, err, &syncError)
+	require.Equal(t, "kratos", syncError.Path)
+
+	require.False(t, IsErrorKind(os.ErrNotExist, ErrorKindMissingTool))
+}
@@ -0,0 +1,295 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/orzkratos/orzkratos/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// wellKnownImportPaths maps google.protobuf messages to Go import paths of their packages
+// Used when the well-known proto is not found in import roots
+//
+// wellKnownImportPaths 将 google.protobuf 消息映射到其 Go 包的导入路径
+// 在导入根 DIR 中找不到知名类型 proto 时使用
+var wellKnownImportPaths = map[string]string{
+	"Any":           "google.golang.org/protobuf/types/known/anypb",
+	"Api":           "google.golang.org/protobuf/types/known/apipb",
+	"Method":        "google.golang.org/protobuf/types/known/apipb",
+	"Mixin":         "google.golang.org/protobuf/types/known/apipb",
+	"Duration":      "google.golang.org/protobuf/types/known/durationpb",
+	"Empty":         "google.golang.org/protobuf/types/known/emptypb",
+	"FieldMask":     "google.golang.org/protobuf/types/known/fieldmaskpb",
+	"SourceContext": "google.golang.org/protobuf/types/known/sourcecontextpb",
+	"Struct":        "google.golang.org/protobuf/types/known/structpb",
+	"Value":         "google.golang.org/protobuf/types/known/structpb",
+	"ListValue":     "google.golang.org/protobuf/types/known/structpb",
+	"Timestamp":     "google.golang.org/protobuf/types/known/timestamppb",
+	"Type":          "google.golang.org/protobuf/types/known/typepb",
+	"Field":         "google.golang.org/protobuf/types/known/typepb",
+	"Enum":          "google.golang.org/protobuf/types/known/typepb",
+	"EnumValue":     "google.golang.org/protobuf/types/known/typepb",
+	"Option":        "google.golang.org/protobuf/types/known/typepb",
+	"DoubleValue":   "google.golang.org/protobuf/types/known/wrapperspb",
+	"FloatValue":    "google.golang.org/protobuf/types/known/wrapperspb",
+	"Int64Value":    "google.golang.org/protobuf/types/known/wrapperspb",
+	"UInt64Value":   "google.golang.org/protobuf/types/known/wrapperspb",
+	"Int32Value":    "google.golang.org/protobuf/types/known/wrapperspb",
+	"UInt32Value":   "google.golang.org/protobuf/types/known/wrapperspb",
+	"BoolValue":     "google.golang.org/protobuf/types/known/wrapperspb",
+	"StringValue":   "google.golang.org/protobuf/types/known/wrapperspb",
+	"BytesValue":    "google.golang.org/protobuf/types/known/wrapperspb",
+}
+
+// ImportRewrites holds user rules applied when fixing placeholders of generated service code
+// Used for shared messages whose Go packages cannot be resolved, or are imported via custom aliases
+//
+// ImportRewrites 保存修复生成的服务代码中占位符时应用的用户规则
+// 用于无法解析 Go 包的共享消息，或以自定义别名导入的包
+type ImportRewrites struct {
+	// Types maps placeholder to qualified Go type, "pb." prefix of placeholder is optional
+	// e.g. "common_v1_Page" -> "github.com/acme/shared/common/v1.Page", overrides resolved types
+	//
+	// Types 将占位符映射到带包路径的 Go 类型，占位符的 "pb." 前缀可省略
+	// 例如 "common_v1_Page" -> "github.com/acme/shared/common/v1.Page"，优先于解析出的类型
+	Types map[string]string `yaml:"types"`
+
+	// Aliases maps import path to import name, used when the path is imported while fixing placeholders
+	// Aliases 将导入路径映射到导入名称，在修复占位符时导入该路径时使用
+	Aliases map[string]string `yaml:"aliases"`
+}
+
+// typeRefs converts Types rules to placeholders of Go types
+// typeRefs 将 Types 规则转换为 Go 类型的占位符映射
+func (rewrites *ImportRewrites) typeRefs() (map[string]*goTypeRef, error) {
+	refs := make(map[string]*goTypeRef)
+	if rewrites == nil {
+		return refs, nil
+	}
+	for placeholder, qualifiedType := range rewrites.Types {
+		idx := strings.LastIndex(qualifiedType, ".")
+		if idx <= strings.LastIndex(qualifiedType, "/") || idx == len(qualifiedType)-1 {
+			return nil, newSyncError(ErrorKindBadOption, "import-rewrites", erero.Errorf("wrong type %q of %q, expect import/path.Type", qualifiedType, placeholder))
+		}
+		importPath := qualifiedType[:idx]
+		pkgName := strings.NewReplacer("-", "_", ".", "_").Replace(importPath[strings.LastIndex(importPath, "/")+1:])
+		refs[strings.TrimPrefix(placeholder, "pb.")] = &goTypeRef{importPath: importPath, pkgName: pkgName, name: qualifiedType[idx+1:]}
+	}
+	return refs, nil
+}
+
+// checkImportRewrites checks each rule is well-formed
+// checkImportRewrites 检查每条规则格式正确
+func checkImportRewrites(rewrites *ImportRewrites) error {
+	if _, err := rewrites.typeRefs(); err != nil {
+		return err
+	}
+	if rewrites == nil {
+		return nil
+	}
+	for importPath, alias := range rewrites.Aliases {
+		if !token.IsIdentifier(alias) || alias == "_" {
+			return newSyncError(ErrorKindBadOption, "import-rewrites", erero.Errorf("wrong alias %q of %q, expect Go identifier", alias, importPath))
+		}
+	}
+	return nil
+}
+
+// goTypeRef is a Go type in another package, replacing a pb.<pkg>_<Message> placeholder
+// goTypeRef 是其它包中的 Go 类型，用于替换 pb.<pkg>_<Message> 占位符
+type goTypeRef struct {
+	importPath string // Go import path // Go 导入路径
+	pkgName    string // Go package name, used as import name unless taken // Go 包名，未被占用时作为导入名称
+	protoPkg   string // Proto package, gives the import name when pkgName is taken // proto 包名，包名被占用时用于生成导入名称
+	name       string // Go type name // Go 类型名
+}
+
+// protoImportRefs maps placeholders of RPC types in proto to Go types of other packages
+// Types are resolved via imports and go_package, google.protobuf types not found fall back to wellKnownImportPaths
+// Each type gets the placeholder of its name as written and of its full name, covering both generators
+//
+// protoImportRefs 将 proto 中 RPC 类型的占位符映射到其它包的 Go 类型
+// 类型通过导入和 go_package 解析，找不到的 google.protobuf 类型回退到 wellKnownImportPaths
+// 每个类型同时使用书写名称和全名的占位符，兼容两种生成方式
+func protoImportRefs(file *protoFile, resolver *protoResolver) (map[string]*goTypeRef, error) {
+	refs := make(map[string]*goTypeRef)
+	for _, service := range file.services {
+		for _, method := range service.methods {
+			for _, typeName := range []string{method.request, method.reply} {
+				typ, err := resolver.resolveType(file, typeName)
+				if err != nil {
+					return nil, err
+				}
+				if typ == nil {
+					name, ok := strings.CutPrefix(typeName, "google.protobuf.")
+					if !ok {
+						zaplog.LOG.Debug("type not resolved, keep placeholder", zap.String("type", typeName))
+						continue
+					}
+					typ = &protoType{pkg: "google.protobuf", name: name}
+				}
+				if typ.goImportPath == file.goImportPath() && typ.goImportPath != "" {
+					continue
+				}
+				ref := &goTypeRef{importPath: typ.goImportPath, pkgName: typ.goPackageName, protoPkg: typ.pkg, name: typ.goName()}
+				if ref.importPath == "" && typ.pkg == "google.protobuf" {
+					ref.importPath = wellKnownImportPaths[typ.name]
+					ref.pkgName = ref.importPath[strings.LastIndex(ref.importPath, "/")+1:]
+				}
+				if ref.importPath == "" {
+					zaplog.LOG.Warn("type without go_package, keep placeholder", zap.String("type", typeName))
+					continue
+				}
+				refs[strings.ReplaceAll(strings.TrimPrefix(typeName, file.pkg+"."), ".", "_")] = ref
+				refs[strings.ReplaceAll(typeName, ".", "_")] = ref
+				refs[strings.ReplaceAll(typ.pkg+"."+typ.name, ".", "_")] = ref
+			}
+		}
+	}
+	return refs, nil
+}
+
+// placeholderPattern matches pb.<Name> type references in generated code
+// placeholderPattern 匹配生成代码中的 pb.<Name> 类型引用
+var placeholderPattern = regexp.MustCompile(`\bpb\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// fixPlaceholders replaces placeholders in generated code with Go types, and imports only the packages used
+// Import names come from aliases, else package names, switched to names based on proto package when taken
+//
+// fixPlaceholders 将生成代码中的占位符替换为 Go 类型，并只导入用到的包
+// 导入名称取自 aliases，否则为包名，被占用时切换为基于 proto 包名的名称
+func fixPlaceholders(code []byte, refs map[string]*goTypeRef, aliases map[string]string) ([]byte, error) {
+	astFile, err := parser.ParseFile(token.NewFileSet(), "", code, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	existingNames := importNameMap(astFile) // Import path to import name in code // 代码中导入路径到导入名称的映射
+	takenNames := make(map[string]string)   // Import name to import path // 导入名称到导入路径的映射
+	for path, name := range existingNames {
+		takenNames[name] = path
+	}
+	imports := make(map[string]string) // Import path to import name of added imports // 新增导入的路径到名称的映射
+	importAs := func(ref *goTypeRef) string {
+		if name, ok := existingNames[ref.importPath]; ok {
+			return name
+		}
+		if name, ok := imports[ref.importPath]; ok {
+			return name
+		}
+		name := ref.pkgName
+		if alias, ok := aliases[ref.importPath]; ok {
+			name = alias
+		}
+		baseName := strings.ReplaceAll(ref.protoPkg, ".", "")
+		if baseName == "" || name != ref.pkgName {
+			baseName = name
+		}
+		name = pickImportName(takenNames, name, baseName)
+		takenNames[name] = ref.importPath
+		imports[ref.importPath] = name
+		return name
+	}
+	source := placeholderPattern.ReplaceAllStringFunc(string(code), func(match string) string {
+		ref, ok := refs[strings.TrimPrefix(match, "pb.")]
+		if !ok {
+			return match
+		}
+		return importAs(ref) + "." + ref.name
+	})
+	if source == string(code) {
+		return code, nil
+	}
+	return addNamedImports([]byte(source), imports)
+}
+
+// importUsedPackages imports packages that code refers to but does not import, via imports of new file
+// Used after copying methods of new file, since goimports cannot find proto packages in staging DIR
+//
+// importUsedPackages 通过新文件的导入，导入代码中引用但未导入的包
+// 在复制新文件的方法后使用，因为 goimports 无法在暂存 DIR 中找到 proto 包
+func importUsedPackages(code []byte, newFile *ServiceFile) ([]byte, error) {
+	astFile, err := parser.ParseFile(token.NewFileSet(), "", code, 0)
+	if err != nil {
+		return nil, err
+	}
+	importedNames := importPathMap(astFile)
+	newImportPaths := importPathMap(newFile.astFile)
+	existingNames := importNameMap(astFile)
+	missingImports := make(map[string]string) // Import path to import name // 导入路径到导入名称的映射
+	ast.Inspect(astFile, func(node ast.Node) bool {
+		selectorExpr, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := selectorExpr.X.(*ast.Ident); ok && ident.Obj == nil {
+			if _, ok := importedNames[ident.Name]; ok {
+				return true
+			}
+			if path, ok := newImportPaths[ident.Name]; ok {
+				if _, ok := existingNames[path]; !ok {
+					missingImports[path] = ident.Name
+				}
+			}
+		}
+		return true
+	})
+	return addNamedImports(code, missingImports)
+}
+
+// replaceProtoImports fixes placeholders in generated service files of DIR, via the proto of each file
+// Rules of ImportRewrites take precedence over types resolved via the proto
+//
+// replaceProtoImports 根据每个文件对应的 proto，修复 DIR 中生成的服务文件里的占位符
+// ImportRewrites 中的规则优先于通过 proto 解析出的类型
+func replaceProtoImports(run *syncRun, serviceRoot string) error {
+	zaplog.LOG.Debug("replacing proto imports", zap.String("root", serviceRoot))
+	ruleRefs, err := run.options.ImportRewrites.typeRefs()
+	if err != nil {
+		return err
+	}
+	var aliases map[string]string
+	if run.options.ImportRewrites != nil {
+		aliases = run.options.ImportRewrites.Aliases
+	}
+	return utils.WalkFiles(serviceRoot, utils.NewSuffixPattern([]string{".go"}), func(path string, info os.FileInfo) error {
+		protoPath, ok := run.stagingProto(serviceRoot, path)
+		if !ok {
+			return nil
+		}
+		protoFile, ok := run.protoFiles[protoPath]
+		if !ok {
+			return nil
+		}
+		refs, err := protoImportRefs(protoFile, run.resolver)
+		if err != nil {
+			return err
+		}
+		maps.Copy(refs, ruleRefs)
+		if len(refs) == 0 {
+			return nil
+		}
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return newSyncError(ErrorKindReadFailure, path, err)
+		}
+		newCode, err := fixPlaceholders(code, refs, aliases)
+		if err != nil {
+			return newSyncError(ErrorKindParseFailure, path, err)
+		}
+		if string(newCode) == string(code) {
+			return nil
+		}
+		if err := os.WriteFile(path, utils.FormatCode(newCode), 0644); err != nil {
+			return newSyncError(ErrorKindWriteFailure, path, err)
+		}
+		return nil
+	})
+}
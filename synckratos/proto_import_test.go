@@ -0,0 +1,203 @@
+package synckratos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestFixPlaceholders tests replacing placeholders with Go types, with import names free of collisions
+// TestFixPlaceholders 测试将占位符替换为 Go 类型，且导入名称互不冲突
+func TestFixPlaceholders(t *testing.T) {
+	code := `package service
+
+import (
+	"context"
+
+	pb "demo/api/shop/v1"
+)
+
+func (s *ShopService) List(ctx context.Context, req *pb.common_v1_Page) (*pb.google_protobuf_Timestamp, error) {
+	return &pb.user_v1_User{}, nil
+}
+
+func (s *ShopService) Get(ctx context.Context, req *pb.GetRequest) (*pb.google_protobuf_Timestamp, error) {
+	return &pb.google_protobuf_Timestamp{}, nil
+}
+`
+	refs := map[string]*goTypeRef{
+		"common_v1_Page":            {importPath: "demo/shared/common/v1", pkgName: "v1", protoPkg: "common.v1", name: "Page"},
+		"user_v1_User":              {importPath: "demo/shared/user/v1", pkgName: "v1", protoPkg: "user.v1", name: "User"},
+		"google_protobuf_Timestamp": {importPath: "google.golang.org/protobuf/types/known/timestamppb", pkgName: "timestamppb", protoPkg: "google.protobuf", name: "Timestamp"},
+	}
+	newCode := string(rese.V1(fixPlaceholders([]byte(code), refs, nil)))
+	t.Log(newCode)
+	require.Contains(t, newCode, "func (s *ShopService) List(ctx context.Context, req *v1.Page) (*timestamppb.Timestamp, error) {")
+	require.Contains(t, newCode, "return &userv1.User{}, nil")
+	require.Contains(t, newCode, "func (s *ShopService) Get(ctx context.Context, req *pb.GetRequest) (*timestamppb.Timestamp, error) {")
+	require.Contains(t, newCode, `"demo/shared/common/v1"`)
+	require.Contains(t, newCode, `userv1 "demo/shared/user/v1"`)
+	require.Contains(t, newCode, `"google.golang.org/protobuf/types/known/timestamppb"`)
+	require.NotContains(t, newCode, "emptypb")
+}
+
+// TestSyncServicesImports tests well-known types and messages of other proto packages in synced services
+// TestSyncServicesImports 测试同步的服务中的知名类型和其它 proto 包的消息
+func TestSyncServicesImports(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_imports_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	writeFile := func(path string, content string) {
+		path = filepath.Join(tempRoot, path)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+	}
+	writeFile("third_party/common/v1/page.proto", `syntax = "proto3";
+package common.v1;
+option go_package = "demo/third_party/common/v1;v1";
+message Page { int32 size = 1; }
+`)
+	writeFile("api/shop/v1/shop.proto", `syntax = "proto3";
+package shop.v1;
+import "common/v1/page.proto";
+import "google/protobuf/duration.proto";
+import "google/protobuf/timestamp.proto";
+option go_package = "demo/api/shop/v1;v1";
+service Shop {
+  rpc List (common.v1.Page) returns (google.protobuf.Timestamp);
+  rpc Wait (google.protobuf.Duration) returns (ListReply.Item);
+}
+message ListReply { message Item { string name = 1; } }
+`)
+
+	t.Setenv("PATH", "")
+	_, err := SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true})
+	require.NoError(t, err)
+
+	code := string(rese.V1(os.ReadFile(filepath.Join(tempRoot, "internal/service/shop.go"))))
+	t.Log(code)
+	require.Contains(t, code, "func (s *ShopService) List(ctx context.Context, req *v1.Page) (*timestamppb.Timestamp, error) {")
+	require.Contains(t, code, "func (s *ShopService) Wait(ctx context.Context, req *durationpb.Duration) (*pb.ListReply_Item, error) {")
+	require.Contains(t, code, `"demo/third_party/common/v1"`)
+	require.Contains(t, code, `"google.golang.org/protobuf/types/known/durationpb"`)
+	require.Contains(t, code, `"google.golang.org/protobuf/types/known/timestamppb"`)
+	require.NotContains(t, code, "emptypb")
+}
+
+// TestSyncServicesImportRewrites tests user rules of placeholders and aliases in synced services
+// TestSyncServicesImportRewrites 测试同步的服务中占位符和别名的用户规则
+func TestSyncServicesImportRewrites(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_rewrites_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	// Shared proto is not on disk, its type cannot be resolved
+	// 共享的 proto 不在磁盘上，其类型无法解析
+	protoPath := filepath.Join(tempRoot, "api/shop/v1/shop.proto")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	must.Done(os.WriteFile(protoPath, []byte(`syntax = "proto3";
+package shop.v1;
+import "acme/common/page.proto";
+import "google/protobuf/timestamp.proto";
+option go_package = "demo/api/shop/v1;v1";
+service Shop {
+  rpc List (acme.common.Page) returns (google.protobuf.Timestamp);
+}
+`), 0644))
+
+	t.Setenv("PATH", "")
+	_, err := SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, ImportRewrites: &ImportRewrites{
+		Types:   map[string]string{"pb.acme_common_Page": "github.com/acme/shared-protos/common.Page"},
+		Aliases: map[string]string{"google.golang.org/protobuf/types/known/timestamppb": "tspb"},
+	}})
+	require.NoError(t, err)
+
+	code := string(rese.V1(os.ReadFile(filepath.Join(tempRoot, "internal/service/shop.go"))))
+	t.Log(code)
+	require.Contains(t, code, "func (s *ShopService) List(ctx context.Context, req *common.Page) (*tspb.Timestamp, error) {")
+	require.Contains(t, code, `"github.com/acme/shared-protos/common"`)
+	require.Contains(t, code, `tspb "google.golang.org/protobuf/types/known/timestamppb"`)
+
+	for _, rewrites := range []*ImportRewrites{
+		{Types: map[string]string{"acme_common_Page": "Page"}},
+		{Types: map[string]string{"acme_common_Page": "github.com/acme/common."}},
+		{Aliases: map[string]string{"github.com/acme/common": "acme-common"}},
+	} {
+		_, err = SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, ImportRewrites: rewrites})
+		require.True(t, IsErrorKind(err, ErrorKindBadOption))
+	}
+}
+
+// TestReplaceProtoImportsSameServiceName tests protos defining services of the same name are staged apart, each fixed via its own proto
+// TestReplaceProtoImportsSameServiceName 测试定义同名服务的 proto 分开暂存，各自通过自己的 proto 修复
+func TestReplaceProtoImportsSameServiceName(t *testing.T) {
+	tempRoot := t.TempDir()
+	writeFile := func(path string, content string) string {
+		path = filepath.Join(tempRoot, path)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	writeFile("api/common/v1/page.proto", `syntax = "proto3";
+package common.v1;
+option go_package = "demo/api/common/v1;v1";
+message Page {}
+`)
+	protoPathA := writeFile("api/a/v1/user.proto", `syntax = "proto3";
+package a.v1;
+option go_package = "demo/api/a/v1;v1";
+import "common/v1/page.proto";
+service User {
+  rpc GetUser (common.v1.Page) returns (common.v1.Page);
+}
+`)
+	protoPathB := writeFile("api/b/v1/user.proto", `syntax = "proto3";
+package b.v1;
+option go_package = "demo/api/b/v1;v1";
+service User {
+  rpc ListUsers (ListUsersRequest) returns (ListUsersReply);
+}
+message ListUsersRequest {}
+message ListUsersReply {}
+`)
+
+	run := newSyncRun(tempRoot, &SyncOptions{})
+	for _, protoPath := range []string{protoPathA, protoPathB} {
+		run.protoFiles[protoPath] = rese.P1(parseProtoPath(protoPath))
+		run.stagingProtos[run.stagingKey(protoPath, "User")] = protoPath
+	}
+	require.Equal(t, "1/user.go", run.stagingKey(protoPathA, "User"))
+	require.Equal(t, "2/user.go", run.stagingKey(protoPathB, "User"))
+
+	stagingRoot := filepath.Join(tempRoot, "staging")
+	pathA := filepath.Join(stagingRoot, run.stagingDir(protoPathA), "user.go")
+	pathB := filepath.Join(stagingRoot, run.stagingDir(protoPathB), "user.go")
+	for path, code := range map[string]string{
+		pathA: "package service\n\nimport (\n\t\"context\"\n\n\tpb \"demo/api/a/v1\"\n)\n\nfunc (s *UserService) GetUser(ctx context.Context, req *pb.common_v1_Page) (*pb.common_v1_Page, error) {\n\treturn &pb.common_v1_Page{}, nil\n}\n",
+		pathB: "package service\n\nimport (\n\t\"context\"\n\n\tpb \"demo/api/b/v1\"\n)\n\nfunc (s *UserService) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersReply, error) {\n\treturn &pb.ListUsersReply{}, nil\n}\n",
+	} {
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(code), 0644))
+	}
+	for path, protoPath := range map[string]string{pathA: protoPathA, pathB: protoPathB} {
+		stagingProto, ok := run.stagingProto(stagingRoot, path)
+		require.True(t, ok)
+		require.Equal(t, protoPath, stagingProto)
+	}
+
+	require.NoError(t, replaceProtoImports(run, stagingRoot))
+	codeA := string(rese.V1(os.ReadFile(pathA)))
+	t.Log(codeA)
+	require.NotContains(t, codeA, "common_v1_Page")
+	require.Contains(t, codeA, `"demo/api/common/v1"`)
+	codeB := string(rese.V1(os.ReadFile(pathB)))
+	require.Contains(t, codeB, "*pb.ListUsersRequest")
+}
@@ -0,0 +1,581 @@
+package synckratos
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yyle88/erero"
+)
+
+// protoFile holds the parts of a proto file needed to generate service code
+// protoFile 保存生成服务代码所需的 proto 文件内容
+type protoFile struct {
+	path      string          // Proto file path // proto 文件路径
+	pkg       string          // Proto package, e.g. "helloworld.v1" // proto 包名，例如 "helloworld.v1"
+	goPackage string          // Value of go_package option // go_package 选项的值
+	imports   []string        // Imported proto paths // 导入的 proto 路径
+	publics   []string        // Imported proto paths with "import public" // 使用 "import public" 导入的 proto 路径
+	messages  []string        // Message names within package, nested ones joined with "." // 包内的消息名，嵌套消息用 "." 连接
+	services  []*protoService // Services in declaration sequence // 按声明顺序排列的服务
+}
+
+// protoService holds one service with its RPCs
+// protoService 保存单个服务及其 RPC
+type protoService struct {
+	name    string         // Service name as written in proto // proto 中书写的服务名
+	comment string         // Leading comment without markers, lines joined with "\n" // 不含注释符号的前置注释，多行用 "\n" 连接
+	methods []*protoMethod // RPCs in declaration sequence // 按声明顺序排列的 RPC
+}
+
+// protoMethod holds one RPC with its request and reply types
+// protoMethod 保存单个 RPC 及其请求和响应类型
+type protoMethod struct {
+	name           string // RPC name // RPC 名称
+	request        string // Request type, e.g. "HelloRequest" or "google.protobuf.Empty" // 请求类型
+	reply          string // Reply type // 响应类型
+	streamsRequest bool   // Client sends a stream // 客户端发送流
+	streamsReply   bool   // Server sends a stream // 服务端发送流
+	httpMethod     string // HTTP method of google.api.http option, e.g. "GET", blank without it // google.api.http 选项的 HTTP 方法，例如 "GET"，没有该选项时为空
+	httpPath       string // HTTP path of google.api.http option, e.g. "/v1/users/{id}" // google.api.http 选项的 HTTP 路径，例如 "/v1/users/{id}"
+	comment        string // Leading comment without markers, lines joined with "\n" // 不含注释符号的前置注释，多行用 "\n" 连接
+}
+
+// hasHTTP checks if any RPC of service has google.api.http option
+// hasHTTP 检查服务中是否有 RPC 带有 google.api.http 选项
+func (service *protoService) hasHTTP() bool {
+	for _, method := range service.methods {
+		if method.httpMethod != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// goImportPath returns go_package without the optional ";name" suffix
+// goImportPath 返回去掉可选 ";name" 后缀的 go_package
+func (file *protoFile) goImportPath() string {
+	path, _, _ := strings.Cut(file.goPackage, ";")
+	return path
+}
+
+// goPackageName returns Go package name, the ";name" suffix of go_package or the last element of its path
+// goPackageName 返回 Go 包名，即 go_package 的 ";name" 后缀或其路径的最后一段
+func (file *protoFile) goPackageName() string {
+	path, name, ok := strings.Cut(file.goPackage, ";")
+	if !ok {
+		name = path[strings.LastIndex(path, "/")+1:]
+	}
+	return strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
+
+// parseProtoPath reads and parses proto file
+// parseProtoPath 读取并解析 proto 文件
+func parseProtoPath(path string) (*protoFile, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newSyncError(ErrorKindReadFailure, path, err)
+	}
+	return parseProtoCode(path, code)
+}
+
+// parseProtoCode parses package, imports, go_package, message names and services of proto code
+// Skips message fields, enums, extends and options other than go_package and google.api.http
+//
+// parseProtoCode 解析 proto 代码中的包名、导入、go_package、消息名和服务
+// 跳过消息字段、enum、extend 以及除 go_package 和 google.api.http 以外的选项
+func parseProtoCode(path string, code []byte) (*protoFile, error) {
+	tokens, err := scanProtoTokens(string(code))
+	if err != nil {
+		return nil, newSyncError(ErrorKindParseFailure, path, err)
+	}
+	parser := &protoParser{tokens: tokens}
+	file := &protoFile{path: path}
+	if err := parser.parseFile(file); err != nil {
+		return nil, newSyncError(ErrorKindParseFailure, path, err)
+	}
+	return file, nil
+}
+
+// protoToken is a word, string literal or punctuation in proto code
+// protoToken 是 proto 代码中的单词、字符串字面量或标点
+type protoToken struct {
+	text    string // Token text, string literals without quotes // 标记文本，字符串字面量不含引号
+	quoted  bool   // Token is a string literal // 标记是字符串字面量
+	line    int    // Line number, starts at 1 // 行号，从 1 开始
+	comment string // Leading comment, see protoComments // 前置注释，参见 protoComments
+}
+
+// scanProtoTokens splits proto code into tokens, skips blanks and comments
+// Comments right above a token become its leading comment, same as protoc
+// Comments after a token on its line, or apart from the next token via a blank line, are dropped
+//
+// scanProtoTokens 将 proto 代码拆分为标记，跳过空白和注释
+// 紧挨在标记上方的注释成为其前置注释，与 protoc 一致
+// 与标记同行的尾随注释，或与下一个标记之间隔着空行的注释会被丢弃
+func scanProtoTokens(code string) ([]*protoToken, error) {
+	var tokens []*protoToken
+	comments := &protoComments{}
+	line := 1
+	for idx := 0; idx < len(code); {
+		char := code[idx]
+		switch {
+		case char == '\n':
+			line++
+			idx++
+		case char == ' ' || char == '\t' || char == '\r' || char == '\f' || char == '\v':
+			idx++
+		case strings.HasPrefix(code[idx:], "//"):
+			start := idx
+			for idx < len(code) && code[idx] != '\n' {
+				idx++
+			}
+			comments.add(tokens, line, line, []string{code[start+2 : idx]})
+		case strings.HasPrefix(code[idx:], "/*"):
+			end := strings.Index(code[idx+2:], "*/")
+			if end < 0 {
+				return nil, erero.Errorf("line %d: unclosed block comment", line)
+			}
+			text := code[idx+2 : idx+2+end]
+			lines := strings.Split(text, "\n")
+			for num := range lines {
+				lines[num] = strings.TrimPrefix(strings.TrimSpace(lines[num]), "*")
+			}
+			comments.add(tokens, line, line+len(lines)-1, lines)
+			line += len(lines) - 1
+			idx += 2 + end + 2
+		case char == '"' || char == '\'':
+			idx++
+			var text strings.Builder
+			for idx < len(code) && code[idx] != char {
+				if code[idx] == '\n' {
+					return nil, erero.Errorf("line %d: unclosed string", line)
+				}
+				if code[idx] == '\\' && idx+1 < len(code) {
+					idx++
+				}
+				text.WriteByte(code[idx])
+				idx++
+			}
+			if idx >= len(code) {
+				return nil, erero.Errorf("line %d: unclosed string", line)
+			}
+			idx++
+			// Adjacent string literals are joined, same as protoc
+			// 相邻的字符串字面量会拼接，与 protoc 一致
+			if last := len(tokens) - 1; last >= 0 && tokens[last].quoted {
+				tokens[last].text += text.String()
+				continue
+			}
+			tokens = append(tokens, &protoToken{text: text.String(), quoted: true, line: line, comment: comments.take(line)})
+		case isProtoWordChar(rune(char)) || char >= utf8.RuneSelf:
+			start := idx
+			for idx < len(code) && (isProtoWordChar(rune(code[idx])) || code[idx] >= utf8.RuneSelf) {
+				idx++
+			}
+			tokens = append(tokens, &protoToken{text: code[start:idx], line: line, comment: comments.take(line)})
+		default:
+			tokens = append(tokens, &protoToken{text: string(char), line: line, comment: comments.take(line)})
+			idx++
+		}
+	}
+	return tokens, nil
+}
+
+// protoComments collects comment lines waiting for the next token
+// protoComments 收集等待下一个标记的注释行
+type protoComments struct {
+	lines []string // Comment lines without markers // 不含注释符号的注释行
+	end   int      // Line where the last comment ends // 最后一条注释结束的行
+}
+
+// add collects comment spanning lines start to end, drops trailing comments and comments apart from the new one
+// add 收集从 start 行到 end 行的注释，丢弃尾随注释和与新注释不相邻的注释
+func (comments *protoComments) add(tokens []*protoToken, start int, end int, lines []string) {
+	if last := len(tokens) - 1; last >= 0 && tokens[last].line == start {
+		return
+	}
+	if len(comments.lines) > 0 && start > comments.end+1 {
+		comments.lines = nil
+	}
+	for _, text := range lines {
+		comments.lines = append(comments.lines, strings.TrimSpace(text))
+	}
+	comments.end = end
+}
+
+// take returns comment right above token on line, blank lines around it trimmed, then clears collected lines
+// take 返回紧挨在 line 行标记上方的注释，去掉首尾空行，然后清空已收集的行
+func (comments *protoComments) take(line int) string {
+	var comment string
+	if len(comments.lines) > 0 && comments.end >= line-1 {
+		comment = strings.Trim(strings.Join(comments.lines, "\n"), "\n")
+	}
+	comments.lines = nil
+	return comment
+}
+
+// isProtoWordChar checks if char is part of identifier, full name or number
+// isProtoWordChar 检查字符是否属于标识符、全名或数字
+func isProtoWordChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_' || char == '.' || char == '-' || char == '+'
+}
+
+// protoParser walks proto tokens
+// protoParser 遍历 proto 标记
+type protoParser struct {
+	tokens []*protoToken // Tokens of proto code // proto 代码的标记
+	idx    int           // Index of next token // 下一个标记的索引
+}
+
+// peek returns next token text, blank at the end
+// peek 返回下一个标记的文本，结束时返回空
+func (p *protoParser) peek() string {
+	if p.idx >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.idx].text
+}
+
+// next returns next token and moves forward
+// next 返回下一个标记并前进
+func (p *protoParser) next() (*protoToken, error) {
+	if p.idx >= len(p.tokens) {
+		return nil, erero.New("unexpected end of proto")
+	}
+	token := p.tokens[p.idx]
+	p.idx++
+	return token, nil
+}
+
+// expect consumes next token, fails when its text differs
+// expect 消费下一个标记，文本不同时失败
+func (p *protoParser) expect(text string) error {
+	token, err := p.next()
+	if err != nil {
+		return err
+	}
+	if token.text != text || token.quoted {
+		return erero.Errorf("line %d: expect %q, got %q", token.line, text, token.text)
+	}
+	return nil
+}
+
+// skipStatement skips tokens to the end of statement, including nested braces
+// skipStatement 跳过到语句结束的标记，包括嵌套的大括号
+func (p *protoParser) skipStatement() error {
+	depth := 0
+	for {
+		token, err := p.next()
+		if err != nil {
+			return err
+		}
+		if token.quoted {
+			continue
+		}
+		switch token.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				// Block ends the statement, an optional ";" may follow
+				// 代码块结束语句，后面可以有可选的 ";"
+				if p.peek() == ";" {
+					p.idx++
+				}
+				return nil
+			}
+			if depth < 0 {
+				return erero.Errorf("line %d: unexpected \"}\"", token.line)
+			}
+		case ";":
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// parseFile parses top level statements of proto file
+// parseFile 解析 proto 文件的顶层语句
+func (p *protoParser) parseFile(file *protoFile) error {
+	for p.idx < len(p.tokens) {
+		token, err := p.next()
+		if err != nil {
+			return err
+		}
+		switch token.text {
+		case ";":
+		case "package":
+			name, err := p.next()
+			if err != nil {
+				return err
+			}
+			file.pkg = name.text
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+		case "import":
+			public := p.peek() == "public"
+			if next := p.peek(); next == "public" || next == "weak" {
+				p.idx++
+			}
+			path, err := p.next()
+			if err != nil {
+				return err
+			}
+			if !path.quoted {
+				return erero.Errorf("line %d: expect import path, got %q", path.line, path.text)
+			}
+			file.imports = append(file.imports, path.text)
+			if public {
+				file.publics = append(file.publics, path.text)
+			}
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+		case "option":
+			if p.peek() == "go_package" {
+				p.idx++
+				if err := p.expect("="); err != nil {
+					return err
+				}
+				value, err := p.next()
+				if err != nil {
+					return err
+				}
+				file.goPackage = value.text
+				if err := p.expect(";"); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		case "service":
+			service, err := p.parseService()
+			if err != nil {
+				return err
+			}
+			service.comment = token.comment
+			file.services = append(file.services, service)
+		case "message":
+			if err := p.parseMessage(file, ""); err != nil {
+				return err
+			}
+		default:
+			// syntax, edition, enum, extend
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseMessage parses message block after the "message" keyword, records its name and nested message names
+// parseMessage 解析 "message" 关键字之后的消息代码块，记录其名称和嵌套消息的名称
+func (p *protoParser) parseMessage(file *protoFile, scope string) error {
+	name, err := p.next()
+	if err != nil {
+		return err
+	}
+	fullName := name.text
+	if scope != "" {
+		fullName = scope + "." + name.text
+	}
+	file.messages = append(file.messages, fullName)
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for {
+		switch p.peek() {
+		case "}":
+			p.idx++
+			return nil
+		case ";":
+			p.idx++
+		case "message":
+			p.idx++
+			if err := p.parseMessage(file, fullName); err != nil {
+				return err
+			}
+		default:
+			// fields, oneof, enum, option, reserved, extensions
+			// 字段、oneof、enum、option、reserved、extensions
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseService parses service block after the "service" keyword
+// parseService 解析 "service" 关键字之后的服务代码块
+func (p *protoParser) parseService() (*protoService, error) {
+	name, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	service := &protoService{name: name.text}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for {
+		token, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch token.text {
+		case "}":
+			return service, nil
+		case ";":
+		case "rpc":
+			method, err := p.parseMethod()
+			if err != nil {
+				return nil, err
+			}
+			method.comment = token.comment
+			service.methods = append(service.methods, method)
+		default:
+			// option and other statements
+			// option 和其它语句
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// parseMethod parses rpc statement after the "rpc" keyword
+// parseMethod 解析 "rpc" 关键字之后的 rpc 语句
+func (p *protoParser) parseMethod() (*protoMethod, error) {
+	name, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	method := &protoMethod{name: name.text}
+	if method.streamsRequest, method.request, err = p.parseMethodType(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("returns"); err != nil {
+		return nil, err
+	}
+	if method.streamsReply, method.reply, err = p.parseMethodType(); err != nil {
+		return nil, err
+	}
+	// Either ";" or a block of options
+	// 以 ";" 结束或跟随选项代码块
+	if p.peek() == ";" {
+		p.idx++
+		return method, nil
+	}
+	if p.peek() != "{" {
+		token, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		return nil, erero.Errorf("line %d: expect \";\" or \"{\", got %q", token.line, token.text)
+	}
+	p.idx++
+	for {
+		switch p.peek() {
+		case "}":
+			p.idx++
+			if p.peek() == ";" {
+				p.idx++
+			}
+			return method, nil
+		case ";":
+			p.idx++
+		case "option":
+			p.idx++
+			if err := p.parseMethodOption(method); err != nil {
+				return nil, err
+			}
+		default:
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// httpMethods are the verbs of google.api.http rule
+// httpMethods 是 google.api.http 规则中的 HTTP 方法
+var httpMethods = []string{"get", "put", "post", "delete", "patch"}
+
+// parseMethodOption parses option statement of rpc after the "option" keyword
+// Reads the first binding of google.api.http, additional_bindings and custom verbs are skipped
+//
+// parseMethodOption 解析 rpc 中 "option" 关键字之后的选项语句
+// 读取 google.api.http 的第一个绑定，跳过 additional_bindings 和自定义方法
+func (p *protoParser) parseMethodOption(method *protoMethod) error {
+	if p.idx+3 >= len(p.tokens) || p.peek() != "(" || p.tokens[p.idx+1].text != "google.api.http" || p.tokens[p.idx+2].text != ")" || p.tokens[p.idx+3].text != "=" {
+		return p.skipStatement()
+	}
+	p.idx += 4
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	depth := 1
+	for depth > 0 {
+		token, err := p.next()
+		if err != nil {
+			return err
+		}
+		if token.quoted {
+			continue
+		}
+		switch {
+		case token.text == "{":
+			depth++
+		case token.text == "}":
+			depth--
+		case depth == 1 && method.httpMethod == "" && slices.Contains(httpMethods, token.text):
+			if p.peek() == ":" {
+				p.idx++
+			}
+			value, err := p.next()
+			if err != nil {
+				return err
+			}
+			if !value.quoted {
+				return erero.Errorf("line %d: expect HTTP path, got %q", value.line, value.text)
+			}
+			method.httpMethod = strings.ToUpper(token.text)
+			method.httpPath = value.text
+		}
+	}
+	if p.peek() == ";" {
+		p.idx++
+	}
+	return nil
+}
+
+// parseMethodType parses "( [stream] Type )" of rpc
+// parseMethodType 解析 rpc 的 "( [stream] Type )"
+func (p *protoParser) parseMethodType() (bool, string, error) {
+	if err := p.expect("("); err != nil {
+		return false, "", err
+	}
+	token, err := p.next()
+	if err != nil {
+		return false, "", err
+	}
+	stream := false
+	if token.text == "stream" && p.peek() != ")" {
+		stream = true
+		if token, err = p.next(); err != nil {
+			return false, "", err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return false, "", err
+	}
+	return stream, strings.TrimPrefix(token.text, "."), nil
+}
@@ -0,0 +1,97 @@
+package synckratos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseProtoCode tests parsing package, imports, go_package and services of proto code
+// TestParseProtoCode 测试解析 proto 代码中的包名、导入、go_package 和服务
+func TestParseProtoCode(t *testing.T) {
+	protoContent := `syntax = "proto3";
+
+package helloworld.v1;
+
+import "google/api/annotations.proto";
+import public "google/protobuf/empty.proto";
+
+option go_package = "demo/api/helloworld/v1;v1";
+option java_multiple_files = true;
+
+/* The greeting service
+   with a block comment */
+service Greeter {
+  option deprecated = false;
+
+  // Sends a greeting; braces in comments { are skipped
+  rpc SayHello (HelloRequest) returns (HelloReply) {
+    option (google.api.http) = {
+      get: "/helloworld/{name}"
+      additional_bindings { post: "/helloworld" body: "*" }
+    };
+    option deprecated = true;
+  }
+  rpc SayBye (.google.protobuf.Empty) returns (google.protobuf.Empty); // Trailing comment is dropped
+  // Detached comment is dropped
+
+  // Chats in both directions
+  rpc Chat (stream HelloRequest) returns (stream HelloReply);
+  rpc Upload (stream HelloRequest) returns (HelloReply);
+  rpc Watch (HelloRequest) returns (stream HelloReply);
+}
+
+message HelloRequest {
+  string name = 1;
+  message Inner { string text = 1 [json_name = "text"]; }
+}
+
+message HelloReply {
+  string message = 1;
+}
+
+service user_admin {
+  rpc list_users (HelloRequest) returns (HelloReply);
+}
+`
+	file, err := parseProtoCode("greeter.proto", []byte(protoContent))
+	require.NoError(t, err)
+	require.Equal(t, "helloworld.v1", file.pkg)
+	require.Equal(t, "demo/api/helloworld/v1", file.goImportPath())
+	require.Equal(t, []string{"google/api/annotations.proto", "google/protobuf/empty.proto"}, file.imports)
+	require.Equal(t, []string{"google/protobuf/empty.proto"}, file.publics)
+	require.Equal(t, []string{"HelloRequest", "HelloRequest.Inner", "HelloReply"}, file.messages)
+	require.Len(t, file.services, 2)
+
+	greeter := file.services[0]
+	require.Equal(t, "Greeter", greeter.name)
+	require.Equal(t, "The greeting service\nwith a block comment", greeter.comment)
+	require.Equal(t, []*protoMethod{
+		{name: "SayHello", request: "HelloRequest", reply: "HelloReply", httpMethod: "GET", httpPath: "/helloworld/{name}", comment: "Sends a greeting; braces in comments { are skipped"},
+		{name: "SayBye", request: "google.protobuf.Empty", reply: "google.protobuf.Empty"},
+		{name: "Chat", request: "HelloRequest", reply: "HelloReply", streamsRequest: true, streamsReply: true, comment: "Chats in both directions"},
+		{name: "Upload", request: "HelloRequest", reply: "HelloReply", streamsRequest: true},
+		{name: "Watch", request: "HelloRequest", reply: "HelloReply", streamsReply: true},
+	}, greeter.methods)
+
+	require.True(t, greeter.hasHTTP())
+
+	require.Equal(t, "user_admin", file.services[1].name)
+	require.False(t, file.services[1].hasHTTP())
+	require.Equal(t, "list_users", file.services[1].methods[0].name)
+}
+
+// TestParseProtoCodeErrors tests parse-failure on broken proto code
+// TestParseProtoCodeErrors 测试损坏的 proto 代码返回 parse-failure
+func TestParseProtoCodeErrors(t *testing.T) {
+	for _, protoContent := range []string{
+		"service Greeter {\n  rpc SayHello (HelloRequest) returns (HelloReply);\n",
+		"service Greeter {\n  rpc SayHello (HelloRequest) (HelloReply);\n}\n",
+		"option go_package = \"demo/api/v1;\n",
+		"/* unclosed comment\n",
+	} {
+		_, err := parseProtoCode("broken.proto", []byte(protoContent))
+		require.True(t, IsErrorKind(err, ErrorKindParseFailure), protoContent)
+		t.Log(err)
+	}
+}
@@ -0,0 +1,220 @@
+package synckratos
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexistpath/ossoftexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// protoType is an RPC type resolved to the proto file defining it
+// protoType 是解析到其定义所在 proto 文件的 RPC 类型
+type protoType struct {
+	pkg           string // Proto package, e.g. "common.v1" // proto 包名，例如 "common.v1"
+	name          string // Message name within package, nested ones joined with "." // 包内的消息名，嵌套消息用 "." 连接
+	goImportPath  string // Go import path of defining proto // 定义该类型的 proto 的 Go 导入路径
+	goPackageName string // Go package name of defining proto // 定义该类型的 proto 的 Go 包名
+}
+
+// goName returns Go type name of message, e.g. "Outer.Inner" -> "Outer_Inner"
+// goName 返回消息的 Go 类型名，例如 "Outer.Inner" -> "Outer_Inner"
+func (typ *protoType) goName() string {
+	return strings.ReplaceAll(typ.name, ".", "_")
+}
+
+// protoResolver loads imported protos across import roots, same as "protoc -I" DIRs
+// Each import path is looked up in roots in turn, parsed protos are cached
+//
+// protoResolver 在导入根 DIR 中加载被导入的 proto，与 "protoc -I" 的 DIR 一致
+// 每个导入路径依次在根 DIR 中查找，已解析的 proto 会被缓存
+type protoResolver struct {
+	roots []string              // Import roots in lookup sequence // 按查找顺序排列的导入根 DIR
+	files map[string]*protoFile // Import path to parsed proto, nil when not found // 导入路径到已解析 proto 的映射，找不到时为 nil
+}
+
+// newProtoResolver creates resolver over import roots, roots not existing are dropped
+// newProtoResolver 基于导入根 DIR 创建解析器，不存在的根 DIR 会被丢弃
+func newProtoResolver(roots []string) *protoResolver {
+	resolver := &protoResolver{files: make(map[string]*protoFile)}
+	for _, root := range roots {
+		if ossoftexist.IsRoot(root) && !slices.Contains(resolver.roots, root) {
+			resolver.roots = append(resolver.roots, root)
+		}
+	}
+	return resolver
+}
+
+// load finds import path in roots and parses it, returns nil when no root has it
+// load 在根 DIR 中查找导入路径并解析，所有根 DIR 都没有时返回 nil
+func (resolver *protoResolver) load(importPath string) (*protoFile, error) {
+	if file, ok := resolver.files[importPath]; ok {
+		return file, nil
+	}
+	var file *protoFile
+	for _, root := range resolver.roots {
+		path := filepath.Join(root, filepath.FromSlash(importPath))
+		if !ossoftexist.IsFile(path) {
+			continue
+		}
+		var err error
+		if file, err = parseProtoPath(path); err != nil {
+			return nil, err
+		}
+		break
+	}
+	if file == nil {
+		// Well-known types such as google/protobuf/empty.proto are usually not on disk
+		// google/protobuf/empty.proto 之类的知名类型通常不在磁盘上
+		zaplog.LOG.Debug("import not found in roots", zap.String("import", importPath), zap.Strings("roots", resolver.roots))
+	}
+	resolver.files[importPath] = file
+	return file, nil
+}
+
+// visibleFiles returns proto file and protos it imports, with "import public" ones of them
+// visibleFiles 返回 proto 文件及其导入的 proto，以及这些 proto 通过 "import public" 导入的文件
+func (resolver *protoResolver) visibleFiles(file *protoFile) ([]*protoFile, error) {
+	files := []*protoFile{file}
+	var visit func(importPaths []string) error
+	visit = func(importPaths []string) error {
+		for _, importPath := range importPaths {
+			imported, err := resolver.load(importPath)
+			if err != nil {
+				return err
+			}
+			if imported == nil || slices.Contains(files, imported) {
+				continue
+			}
+			files = append(files, imported)
+			if err := visit(imported.publics); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(file.imports); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// resolveType resolves type name used in proto file, via package scopes same as protoc
+// Name is tried in package of file then in each parent package, returns nil when not found
+//
+// resolveType 按与 protoc 一致的包作用域解析 proto 文件中使用的类型名
+// 依次在文件的包及其各级父包中尝试，找不到时返回 nil
+func (resolver *protoResolver) resolveType(file *protoFile, typeName string) (*protoType, error) {
+	files, err := resolver.visibleFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	scope := file.pkg
+	for {
+		fullName := typeName
+		if scope != "" {
+			fullName = scope + "." + typeName
+		}
+		for _, visible := range files {
+			name := fullName
+			if visible.pkg != "" {
+				var ok bool
+				if name, ok = strings.CutPrefix(fullName, visible.pkg+"."); !ok {
+					continue
+				}
+			}
+			if slices.Contains(visible.messages, name) {
+				return &protoType{pkg: visible.pkg, name: name, goImportPath: visible.goImportPath(), goPackageName: visible.goPackageName()}, nil
+			}
+		}
+		if scope == "" {
+			return nil, nil
+		}
+		if idx := strings.LastIndex(scope, "."); idx >= 0 {
+			scope = scope[:idx]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// protoIncludeRoots returns DIRs of ProtoIncludes
+// Entries naming an existing DIR are joined with project root when relative
+// Other entries are taken as Go module paths required in go.mod, located via "go list -m"
+//
+// protoIncludeRoots 返回 ProtoIncludes 对应的 DIR
+// 指向已存在 DIR 的条目在是相对路径时拼接到项目根 DIR
+// 其它条目视为 go.mod 中依赖的 Go 模块路径，通过 "go list -m" 定位
+func (options *SyncOptions) protoIncludeRoots(ctx context.Context, projectRoot string) ([]string, error) {
+	roots := make([]string, 0, len(options.ProtoIncludes))
+	for _, include := range options.ProtoIncludes {
+		if root := resolveRoot(projectRoot, include, "."); ossoftexist.IsRoot(root) {
+			roots = append(roots, root)
+			continue
+		}
+		root, err := findModuleRoot(ctx, projectRoot, include)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// findModuleRoot returns DIR of Go module required in project, via "go list -m"
+// Returns missing-tool when go is not installed, bad-option when module cannot be located
+//
+// findModuleRoot 通过 "go list -m" 返回项目依赖的 Go 模块的 DIR
+// 未安装 go 时返回 missing-tool，无法定位模块时返回 bad-option
+func findModuleRoot(ctx context.Context, projectRoot string, modulePath string) (string, error) {
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		return "", newSyncError(ErrorKindMissingTool, "go", err)
+	}
+	command := exec.CommandContext(ctx, goPath, "list", "-m", "-f", "{{.Dir}}", modulePath)
+	command.Dir = projectRoot
+	out, err := command.CombinedOutput()
+	if err != nil {
+		return "", newSyncError(ErrorKindBadOption, modulePath, erero.Errorf("proto include is neither DIR nor module in go.mod: %s", strings.TrimSpace(string(out))))
+	}
+	root := strings.TrimSpace(string(out))
+	if !ossoftexist.IsRoot(root) {
+		// Blank when module is required but not downloaded yet
+		// 模块已依赖但尚未下载时为空
+		return "", newSyncError(ErrorKindBadOption, modulePath, erero.New("module DIR not found, run go mod download"))
+	}
+	return root, nil
+}
+
+// protoImportRoots returns roots where proto imports are looked up
+// Include roots come first, then proto DIR, third_party and project root, same as kratos Makefile
+//
+// protoImportRoots 返回查找 proto 导入的根 DIR
+// 先是包含的根 DIR，然后是 proto DIR、third_party 和项目根 DIR，与 kratos Makefile 一致
+func protoImportRoots(projectRoot string, options *SyncOptions, includeRoots []string) []string {
+	roots := slices.Clone(includeRoots)
+	return append(roots, options.protoRoot(projectRoot), filepath.Join(projectRoot, "third_party"), projectRoot)
+}
+
+// setIncludeRoots sets include roots of run, and resolves imports across them
+// setIncludeRoots 设置本次同步的包含根 DIR，并在其中解析导入
+func (run *syncRun) setIncludeRoots(includeRoots []string) {
+	run.includeRoots = includeRoots
+	run.resolver = newProtoResolver(protoImportRoots(run.projectRoot, run.options, includeRoots))
+}
+
+// isIncludedProto checks if proto path lives in one of include roots
+// isIncludedProto 检查 proto 路径是否位于某个包含的根 DIR 中
+func isIncludedProto(protoPath string, includeRoots []string) bool {
+	for _, root := range includeRoots {
+		if rel, err := filepath.Rel(root, protoPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
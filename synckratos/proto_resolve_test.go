@@ -0,0 +1,158 @@
+package synckratos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexistpath/ossoftexist"
+	"github.com/yyle88/rese"
+)
+
+// TestProtoResolver tests resolving RPC types across import roots via package scopes
+// TestProtoResolver 测试按包作用域在导入根 DIR 中解析 RPC 类型
+func TestProtoResolver(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_resolve_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	writeProto := func(path string, content string) {
+		path = filepath.Join(tempRoot, path)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+	}
+	writeProto("shared/common/v1/page.proto", `syntax = "proto3";
+package common.v1;
+import public "common/v1/sort.proto";
+option go_package = "demo/shared/common/v1;v1";
+message Page { message Cursor { string token = 1; } }
+`)
+	writeProto("shared/common/v1/sort.proto", `syntax = "proto3";
+package common.v1;
+option go_package = "demo/shared/common/v1;v1";
+message Sort { string field = 1; }
+`)
+	writeProto("api/shop/v1/shop.proto", `syntax = "proto3";
+package shop.v1;
+import "common/v1/page.proto";
+import "google/protobuf/empty.proto";
+option go_package = "demo/api/shop/v1;v1";
+message ListReply { message Item { string name = 1; } }
+`)
+
+	resolver := newProtoResolver([]string{filepath.Join(tempRoot, "shared"), filepath.Join(tempRoot, "api"), filepath.Join(tempRoot, "none")})
+	require.Len(t, resolver.roots, 2)
+	file := rese.P1(parseProtoPath(filepath.Join(tempRoot, "api/shop/v1/shop.proto")))
+
+	for typeName, expected := range map[string]*protoType{
+		"ListReply":             {pkg: "shop.v1", name: "ListReply", goImportPath: "demo/api/shop/v1", goPackageName: "v1"},
+		"ListReply.Item":        {pkg: "shop.v1", name: "ListReply.Item", goImportPath: "demo/api/shop/v1", goPackageName: "v1"},
+		"v1.ListReply":          {pkg: "shop.v1", name: "ListReply", goImportPath: "demo/api/shop/v1", goPackageName: "v1"},
+		"common.v1.Page.Cursor": {pkg: "common.v1", name: "Page.Cursor", goImportPath: "demo/shared/common/v1", goPackageName: "v1"},
+		"common.v1.Sort":        {pkg: "common.v1", name: "Sort", goImportPath: "demo/shared/common/v1", goPackageName: "v1"},
+	} {
+		typ, err := resolver.resolveType(file, typeName)
+		require.NoError(t, err)
+		require.Equal(t, expected, typ, typeName)
+	}
+	typ, err := resolver.resolveType(file, "google.protobuf.Empty")
+	require.NoError(t, err)
+	require.Nil(t, typ)
+
+	require.Equal(t, "ListReply_Item", rese.C1(stubTypeName(file, resolver, "ListReply.Item")))
+	require.Equal(t, "common_v1_Page_Cursor", rese.C1(stubTypeName(file, resolver, "common.v1.Page.Cursor")))
+	require.Equal(t, "google_protobuf_Empty", rese.C1(stubTypeName(file, resolver, "google.protobuf.Empty")))
+}
+
+// TestSyncServicesIncludes tests protos of include roots sync services in project via mask type, and create none
+// TestSyncServicesIncludes 测试包含的根 DIR 中的 proto 按嵌入类型同步项目中的服务，且不新建服务
+func TestSyncServicesIncludes(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_includes_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	protoContent := `syntax = "proto3";
+
+package shop.v1;
+
+option go_package = "demo/shared/shop/v1;v1";
+
+service User {
+  rpc GetUser (GetUserRequest) returns (GetUserReply);
+  rpc ListUsers (ListUsersRequest) returns (ListUsersReply);
+}
+
+service Order {
+  rpc GetOrder (GetOrderRequest) returns (GetOrderReply);
+}
+
+message GetUserRequest {}
+message GetUserReply {}
+message ListUsersRequest {}
+message ListUsersReply {}
+`
+	oldContent := `package service
+
+import (
+	"context"
+
+	pb "demo/shared/shop/v1"
+)
+
+type UserService struct {
+	pb.UnimplementedUserServer
+}
+
+func (s *UserService) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserReply, error) {
+	return &pb.GetUserReply{}, nil
+}
+`
+	// Shared api module lives beside the project, project has no api/ DIR
+	// 共享的 api 模块位于项目旁边，项目没有 api/ DIR
+	projectRoot := filepath.Join(tempRoot, "user")
+	protoPath := filepath.Join(tempRoot, "shared/shop/v1/shop.proto")
+	servicePath := filepath.Join(projectRoot, "internal/service/users.go")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	must.Done(os.MkdirAll(filepath.Dir(servicePath), 0755))
+	must.Done(os.WriteFile(protoPath, []byte(protoContent), 0644))
+	must.Done(os.WriteFile(servicePath, []byte(oldContent), 0644))
+
+	_, err := SyncServices(context.Background(), projectRoot, &SyncOptions{})
+	require.True(t, IsErrorKind(err, ErrorKindPathNotFound))
+
+	// Filename mode is set, protos of include roots still match via mask type
+	// 设置了文件名模式，包含的根 DIR 中的 proto 仍按嵌入类型匹配
+	report, err := SyncServices(context.Background(), projectRoot, &SyncOptions{ProtoIncludes: []string{"../shared"}})
+	require.NoError(t, err)
+	report.WriteText(os.Stdout)
+
+	require.Len(t, report.Protos, 1)
+	require.Equal(t, "../shared/shop/v1/shop.proto", report.Protos[0].Path)
+	require.Equal(t, []string{"User"}, report.Protos[0].Services)
+	require.Equal(t, MatchedByMaskType, report.Protos[0].Files[0].MatchedBy)
+	require.Equal(t, []string{"ListUsers"}, report.Protos[0].Files[0].Added)
+
+	code := string(rese.V1(os.ReadFile(servicePath)))
+	require.Contains(t, code, "func (s *UserService) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersReply, error) {")
+	require.False(t, ossoftexist.IsFile(filepath.Join(projectRoot, "internal/service/order.go")))
+
+	_, err = SyncServices(context.Background(), projectRoot, &SyncOptions{ProtoIncludes: []string{"../missing"}})
+	require.True(t, IsErrorKind(err, ErrorKindBadOption))
+}
+
+// TestFindModuleRoot tests locating DIR of Go module required in go.mod
+// TestFindModuleRoot 测试定位 go.mod 中依赖的 Go 模块的 DIR
+func TestFindModuleRoot(t *testing.T) {
+	root, err := findModuleRoot(context.Background(), "..", "github.com/yyle88/must")
+	require.NoError(t, err)
+	t.Log(root)
+	require.True(t, ossoftexist.IsRoot(root))
+
+	_, err = findModuleRoot(context.Background(), "..", "example.com/none")
+	require.True(t, IsErrorKind(err, ErrorKindBadOption))
+}
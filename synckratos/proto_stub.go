@@ -0,0 +1,317 @@
+package synckratos
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/yyle88/erero"
+)
+
+// Method types, same values as kratos proto server
+// 方法类型，与 kratos proto server 的取值一致
+const (
+	methodTypeUnary        = 1 // Unary RPC // 一元 RPC
+	methodTypeBidiStream   = 2 // Both sides send streams // 双向流
+	methodTypeClientStream = 3 // Client sends a stream // 客户端流
+	methodTypeServerStream = 4 // Server sends a stream // 服务端流
+)
+
+// serviceStubTemplate generates service code, same layout as kratos proto server, with proto comments of methods
+// Types of other proto packages come as pb.<pkg>_<Message> placeholders, fixed via replaceProtoImports
+// Replaced via Templates.Service in new service files, staging code to sync existing ones keeps this layout
+//
+// serviceStubTemplate 生成服务代码，布局与 kratos proto server 一致，并带有 proto 中方法的注释
+// 其它 proto 包的类型以 pb.<pkg>_<Message> 占位符输出，由 replaceProtoImports 修复
+// 新服务文件中可通过 Templates.Service 替换，用于同步现有服务的暂存代码保持此布局
+const serviceStubTemplate = `package service
+
+import (
+	{{- if .UseContext }}
+	"context"
+	{{- end }}
+	{{- if .UseIO }}
+	"io"
+	{{- end }}
+
+	pb "{{ .Package }}"
+)
+
+type {{ .Service }}Service struct {
+	pb.Unimplemented{{ .Service }}Server
+}
+
+func New{{ .Service }}Service() *{{ .Service }}Service {
+	return &{{ .Service }}Service{}
+}
+{{ range .Methods }}
+{{- with .Comment }}
+{{ comment . }}
+{{- end }}
+func (s *{{ .Service }}Service) {{ .Name }}{{ .Signature }} {
+{{ .Body }}
+}
+{{ end }}`
+
+// methodBodyTemplate generates method body, same as kratos proto server, replaced via Templates.Method
+// methodBodyTemplate 生成方法体，与 kratos proto server 一致，可通过 Templates.Method 替换
+const methodBodyTemplate = `
+{{- if eq .Type 1 }}
+	return &pb.{{ .Reply }}{}, nil
+{{- else if eq .Type 2 }}
+	for {
+		_, err := conn.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = conn.Send(&pb.{{ .Reply }}{})
+		if err != nil {
+			return err
+		}
+	}
+{{- else if eq .Type 3 }}
+	for {
+		_, err := conn.Recv()
+		if err == io.EOF {
+			return conn.SendAndClose(&pb.{{ .Reply }}{})
+		}
+		if err != nil {
+			return err
+		}
+	}
+{{- else if eq .Type 4 }}
+	for {
+		err := conn.Send(&pb.{{ .Reply }}{})
+		if err != nil {
+			return err
+		}
+	}
+{{- end }}`
+
+// serviceStub is the data of serviceStubTemplate
+// serviceStub 是 serviceStubTemplate 的数据
+type serviceStub struct {
+	Package    string               // Go import path of proto package // proto 包的 Go 导入路径
+	Service    string               // Go name of service // 服务的 Go 名称
+	Comment    string               // Leading comment of service in proto // proto 中服务的前置注释
+	Methods    []*serviceStubMethod // Methods in proto sequence // 按 proto 顺序排列的方法
+	UseContext bool                 // Any unary method // 存在一元方法
+	UseIO      bool                 // Any method receiving a stream // 存在接收流的方法
+}
+
+// serviceStubMethod is the data of one method in serviceStubTemplate, and the data of methodBodyTemplate
+// serviceStubMethod 是 serviceStubTemplate 中单个方法的数据，也是 methodBodyTemplate 的数据
+type serviceStubMethod struct {
+	Service    string // Go name of service // 服务的 Go 名称
+	Name       string // Go name of method // 方法的 Go 名称
+	RPC        string // RPC name as written in proto // proto 中书写的 RPC 名称
+	Request    string // Request type, dots replaced with "_" // 请求类型，点号替换为 "_"
+	Reply      string // Reply type, dots replaced with "_" // 响应类型，点号替换为 "_"
+	Type       int    // Method type // 方法类型
+	Kind       string // Method type name, e.g. "unary" or "server-streaming" // 方法类型名称，例如 "unary" 或 "server-streaming"
+	HTTPMethod string // HTTP method of google.api.http option, blank without it // google.api.http 选项的 HTTP 方法，没有该选项时为空
+	HTTPPath   string // HTTP path of google.api.http option // google.api.http 选项的 HTTP 路径
+	Comment    string // Leading comment of RPC in proto // proto 中 RPC 的前置注释
+	Signature  string // Params and results, e.g. "(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error)" // 参数和返回值
+	Body       string // Method body rendered via methodBodyTemplate, blank within it // 通过 methodBodyTemplate 渲染的方法体，在其内部为空
+}
+
+// stubTemplates holds templates generating service code
+// stubTemplates 保存生成服务代码的模板
+type stubTemplates struct {
+	service *template.Template // Template of whole service file // 整个服务文件的模板
+	method  *template.Template // Template of method body // 方法体的模板
+}
+
+// loadStubTemplates loads service and method templates, custom service template only applies when create is set
+// loadStubTemplates 加载服务和方法模板，自定义服务模板仅在设置 create 时生效
+func loadStubTemplates(projectRoot string, templates *Templates, create bool) (*stubTemplates, error) {
+	if templates == nil {
+		templates = &Templates{}
+	}
+	servicePath := templates.Service
+	if !create {
+		servicePath = ""
+	}
+	service, err := loadTemplate(projectRoot, servicePath, "service", serviceStubTemplate)
+	if err != nil {
+		return nil, err
+	}
+	method, err := loadTemplate(projectRoot, templates.Method, "method", methodBodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &stubTemplates{service: service, method: method}, nil
+}
+
+// generateServiceStubs generates service code of each service in proto, without kratos CLI
+// Returns filename to code map, filename is lowercase service name same as kratos
+// RPC types are resolved via imports of proto, types not found keep the names written in proto
+//
+// generateServiceStubs 为 proto 中的每个服务生成服务代码，无需 kratos 命令行
+// 返回文件名到代码的映射，文件名与 kratos 一致为小写服务名
+// RPC 类型通过 proto 的导入解析，找不到的类型保留 proto 中书写的名称
+func generateServiceStubs(file *protoFile, resolver *protoResolver, templates *stubTemplates) (map[string][]byte, error) {
+	if file.goImportPath() == "" {
+		return nil, newSyncError(ErrorKindParseFailure, file.path, erero.New("missing go_package option"))
+	}
+	results := make(map[string][]byte, len(file.services))
+	for _, service := range file.services {
+		stub, err := newServiceStub(file, service, resolver)
+		if err != nil {
+			return nil, err
+		}
+		imports := make(map[string]string) // Imports declared in templates // 模板中声明的导入
+		templates.service.Funcs(importFuncs(imports))
+		templates.method.Funcs(importFuncs(imports))
+		for _, method := range stub.Methods {
+			body, err := executeTemplate(templates.method, method)
+			if err != nil {
+				return nil, err
+			}
+			method.Body = strings.Trim(string(body), "\n")
+		}
+		code, err := executeTemplate(templates.service, stub)
+		if err != nil {
+			return nil, err
+		}
+		if code, err = addNamedImports(code, imports); err != nil {
+			return nil, newSyncError(ErrorKindBadOption, "templates", err)
+		}
+		results[strings.ToLower(stub.Service)+".go"] = code
+	}
+	return results, nil
+}
+
+// newServiceStub builds template data of service
+// newServiceStub 构建服务的模板数据
+func newServiceStub(file *protoFile, service *protoService, resolver *protoResolver) (*serviceStub, error) {
+	stub := &serviceStub{
+		Package: file.goImportPath(),
+		Service: goCamelCase(service.name),
+		Comment: service.comment,
+	}
+	for _, method := range service.methods {
+		request, err := stubTypeName(file, resolver, method.request)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := stubTypeName(file, resolver, method.reply)
+		if err != nil {
+			return nil, err
+		}
+		stubMethod := &serviceStubMethod{
+			Service:    stub.Service,
+			Name:       goCamelCase(method.name),
+			RPC:        method.name,
+			Request:    request,
+			Reply:      reply,
+			Type:       method.methodType(),
+			HTTPMethod: method.httpMethod,
+			HTTPPath:   method.httpPath,
+			Comment:    method.comment,
+		}
+		switch stubMethod.Type {
+		case methodTypeUnary:
+			stub.UseContext = true
+			stubMethod.Kind = string(rpcKindUnary)
+			stubMethod.Signature = "(ctx context.Context, req *pb." + request + ") (*pb." + reply + ", error)"
+		case methodTypeBidiStream:
+			stub.UseIO = true
+			stubMethod.Kind = string(rpcKindBidiStream)
+			stubMethod.Signature = "(conn pb." + stub.Service + "_" + stubMethod.Name + "Server) error"
+		case methodTypeClientStream:
+			stub.UseIO = true
+			stubMethod.Kind = string(rpcKindClientStream)
+			stubMethod.Signature = "(conn pb." + stub.Service + "_" + stubMethod.Name + "Server) error"
+		case methodTypeServerStream:
+			stubMethod.Kind = string(rpcKindServerStream)
+			stubMethod.Signature = "(req *pb." + request + ", conn pb." + stub.Service + "_" + stubMethod.Name + "Server) error"
+		}
+		stub.Methods = append(stub.Methods, stubMethod)
+	}
+	return stub, nil
+}
+
+// stubTypeName returns type name used after "pb.", types in Go package of proto lose the package prefix
+// Types of other packages become placeholders, e.g. "google.protobuf.Empty" -> "google_protobuf_Empty"
+// Nested messages join with "_" same as protoc-gen-go, e.g. "Outer.Inner" -> "Outer_Inner"
+//
+// stubTypeName 返回 "pb." 之后使用的类型名，位于 proto 的 Go 包中的类型去掉包前缀
+// 其它包的类型变为占位符，例如 "google.protobuf.Empty" -> "google_protobuf_Empty"
+// 嵌套消息与 protoc-gen-go 一致用 "_" 连接，例如 "Outer.Inner" -> "Outer_Inner"
+func stubTypeName(file *protoFile, resolver *protoResolver, typeName string) (string, error) {
+	typ, err := resolver.resolveType(file, typeName)
+	if err != nil {
+		return "", err
+	}
+	if typ != nil {
+		if typ.goImportPath == file.goImportPath() {
+			return typ.goName(), nil
+		}
+		return strings.ReplaceAll(typ.pkg+"."+typ.name, ".", "_"), nil
+	}
+	if file.pkg != "" {
+		typeName = strings.TrimPrefix(typeName, file.pkg+".")
+	}
+	return strings.ReplaceAll(typeName, ".", "_"), nil
+}
+
+// methodType returns method type via streaming flags
+// methodType 根据流标志返回方法类型
+func (method *protoMethod) methodType() int {
+	switch {
+	case method.streamsRequest && method.streamsReply:
+		return methodTypeBidiStream
+	case method.streamsRequest:
+		return methodTypeClientStream
+	case method.streamsReply:
+		return methodTypeServerStream
+	default:
+		return methodTypeUnary
+	}
+}
+
+// goCamelCase converts proto name to Go name, e.g. "say_hello" -> "SayHello"
+// Ported from GoCamelCase of protoc-gen-go, so names match generated code, e.g. "foo_1bar" -> "Foo_1Bar", "_foo" -> "XFoo"
+//
+// goCamelCase 将 proto 名称转换为 Go 名称，例如 "say_hello" -> "SayHello"
+// 移植自 protoc-gen-go 的 GoCamelCase，使名称与生成代码一致，例如 "foo_1bar" -> "Foo_1Bar"，"_foo" -> "XFoo"
+func goCamelCase(name string) string {
+	isLower := func(c byte) bool { return 'a' <= c && c <= 'z' }
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	// Words start at "_" or upper case letter, digits are words too, next lower case letter of a word is upper-cased
+	// 单词以 "_" 或大写字母开头，数字也算单词，单词的首个小写字母会转为大写
+	var b []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '.' && i+1 < len(name) && isLower(name[i+1]):
+			// Skip "." in ".{{lowercase}}"
+			// 跳过 ".{{lowercase}}" 中的 "."
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || name[i-1] == '.'):
+			// Leading "_" becomes "X" to start with a capital letter, same after "."
+			// 开头的 "_" 转为 "X" 以大写字母开头，"." 之后同样处理
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(name) && isLower(name[i+1]):
+			// Skip "_" in "_{{lowercase}}"
+			// 跳过 "_{{lowercase}}" 中的 "_"
+		case isDigit(c):
+			b = append(b, c)
+		default:
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(name) && isLower(name[i+1]); i++ {
+				b = append(b, name[i+1])
+			}
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,223 @@
+package synckratos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/eroticgo"
+	"github.com/yyle88/osexistpath/ossoftexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+	"golang.org/x/mod/modfile"
+)
+
+// KratosApp is one Kratos app found in a monorepo
+// KratosApp 是在 monorepo 中找到的单个 Kratos 应用
+type KratosApp struct {
+	Name     string // App path relative to monorepo root, e.g. "app/user/service" // 相对于 monorepo 根 DIR 的应用路径
+	Root     string // App root path // 应用根路径
+	Monorepo string // Monorepo root path the app is found from // 发现该应用的 monorepo 根路径
+}
+
+// AppsReport describes a sync run over apps of a monorepo
+// AppsReport 描述对 monorepo 中多个应用的同步过程
+type AppsReport struct {
+	Apps []*AppReport `json:"apps"` // Apps in sync sequence // 按同步顺序排列的应用
+}
+
+// AppReport describes the sync result of one app
+// AppReport 描述单个应用的同步结果
+type AppReport struct {
+	Name   string      `json:"name"`             // App name // 应用名称
+	Report *SyncReport `json:"report,omitempty"` // Sync report, nil when failed // 同步报告，失败时为 nil
+	Error  string      `json:"error,omitempty"`  // Failure message // 失败消息
+}
+
+// skipAppRoots are DIR names never holding Kratos apps
+// skipAppRoots 是不会包含 Kratos 应用的 DIR 名称
+var skipAppRoots = []string{"vendor", "node_modules", "third_party", "testdata"}
+
+// DiscoverApps finds Kratos apps under monorepo root
+// An app is a DIR with both internal/service and cmd/, go.work members are checked the same way
+// Apps are not searched inside other apps, hidden DIRs and vendor like DIRs are skipped
+//
+// DiscoverApps 查找 monorepo 根 DIR 下的 Kratos 应用
+// 同时包含 internal/service 和 cmd/ 的 DIR 即为应用，go.work 成员按同样方式检查
+// 不在其它应用内部查找，跳过隐藏 DIR 和 vendor 之类的 DIR
+func DiscoverApps(root string) ([]*KratosApp, error) {
+	rootSet := make(map[string]bool)
+	if err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != root && (strings.HasPrefix(entry.Name(), ".") || slices.Contains(skipAppRoots, entry.Name())) {
+			return filepath.SkipDir
+		}
+		if isKratosApp(path) {
+			rootSet[path] = true
+			return filepath.SkipDir
+		}
+		return nil
+	}); err != nil {
+		return nil, newSyncError(ErrorKindReadFailure, root, err)
+	}
+
+	workRoots, err := listWorkRoots(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range workRoots {
+		if isKratosApp(path) {
+			rootSet[path] = true
+		}
+	}
+
+	apps := make([]*KratosApp, 0, len(rootSet))
+	for path := range rootSet {
+		name := "."
+		if rel, err := filepath.Rel(root, path); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		apps = append(apps, &KratosApp{Name: name, Root: path, Monorepo: root})
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].Name < apps[j].Name
+	})
+	zaplog.LOG.Debug("discover apps", zap.String("root", root), zap.Int("apps", len(apps)))
+	return apps, nil
+}
+
+// isKratosApp checks if DIR has both internal/service and cmd/
+// isKratosApp 检查 DIR 是否同时包含 internal/service 和 cmd/
+func isKratosApp(path string) bool {
+	return ossoftexist.IsRoot(filepath.Join(path, "internal/service")) && ossoftexist.IsRoot(filepath.Join(path, "cmd"))
+}
+
+// listWorkRoots returns DIRs of "use" directives in go.work of root, nil without go.work
+// listWorkRoots 返回 root 中 go.work 的 "use" 指令对应的 DIR，没有 go.work 时返回 nil
+func listWorkRoots(root string) ([]string, error) {
+	path := filepath.Join(root, "go.work")
+	if !ossoftexist.IsFile(path) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newSyncError(ErrorKindReadFailure, path, err)
+	}
+	workFile, err := modfile.ParseWork(path, data, nil)
+	if err != nil {
+		return nil, newSyncError(ErrorKindParseFailure, path, err)
+	}
+	roots := make([]string, 0, len(workFile.Use))
+	for _, use := range workFile.Use {
+		roots = append(roots, resolveRoot(root, filepath.FromSlash(use.Path), "."))
+	}
+	return roots, nil
+}
+
+// FindApp picks the app matching name, via its full name or one of its path elements
+// Returns bad-option when no app or more than one app matches
+//
+// FindApp 选择与名称匹配的应用，按完整名称或其中一个路径元素匹配
+// 没有应用或多个应用匹配时返回 bad-option
+func FindApp(apps []*KratosApp, name string) (*KratosApp, error) {
+	for _, app := range apps {
+		if app.Name == name {
+			return app, nil
+		}
+	}
+	var matches []*KratosApp
+	var names []string
+	for _, app := range apps {
+		if slices.Contains(strings.Split(app.Name, "/"), name) {
+			matches = append(matches, app)
+			names = append(names, app.Name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, newSyncError(ErrorKindBadOption, name, erero.New("app not found"))
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, newSyncError(ErrorKindBadOption, name, erero.Errorf("app name matches %d apps: %s", len(matches), strings.Join(names, ", ")))
+	}
+}
+
+// SyncApps syncs each app via SyncServices in turn, a failed app does not stop the others
+// Diff paths are relative to monorepo root unless DiffRoot is set, so the combined diff applies there
+// Returns the report of each app, and an error naming the failed apps
+//
+// SyncApps 依次通过 SyncServices 同步每个应用，某个应用失败不会中断其它应用
+// 未设置 DiffRoot 时 diff 路径相对于 monorepo 根 DIR，使合并后的 diff 可以在那里应用
+// 返回每个应用的报告，以及列出失败应用的错误
+func SyncApps(ctx context.Context, apps []*KratosApp, options *SyncOptions) (*AppsReport, error) {
+	appsReport := &AppsReport{Apps: make([]*AppReport, 0, len(apps))}
+	var failedNames []string
+	for _, app := range apps {
+		zaplog.LOG.Debug("sync app", zap.String("name", app.Name), zap.String("root", app.Root))
+		appReport := &AppReport{Name: app.Name}
+		appOptions := *options
+		if appOptions.DiffRoot == "" {
+			appOptions.DiffRoot = app.Monorepo
+		}
+		report, err := SyncServices(ctx, app.Root, &appOptions)
+		if err != nil {
+			appReport.Error = err.Error()
+			failedNames = append(failedNames, app.Name)
+		} else {
+			appReport.Report = report
+		}
+		appsReport.Apps = append(appsReport.Apps, appReport)
+	}
+	if len(failedNames) > 0 {
+		return appsReport, erero.Errorf("sync failed in %d apps: %s", len(failedNames), strings.Join(failedNames, ", "))
+	}
+	return appsReport, nil
+}
+
+// HasChanges checks if any app has service files created or modified
+// HasChanges 检查是否有应用的服务文件被新建或修改
+func (appsReport *AppsReport) HasChanges() bool {
+	for _, app := range appsReport.Apps {
+		if app.Report != nil && app.Report.HasChanges() {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes report as indented JSON
+// WriteJSON 将报告写为缩进的 JSON
+func (appsReport *AppsReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(appsReport); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// WriteText writes report of each app under an "app:" heading
+// WriteText 在 "app:" 标题下写出每个应用的报告
+func (appsReport *AppsReport) WriteText(w io.Writer) {
+	for _, app := range appsReport.Apps {
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint("app: "+app.Name))
+		if app.Error != "" {
+			_, _ = fmt.Fprintln(w, eroticgo.RED.Sprint("sync failed: "+app.Error))
+			continue
+		}
+		app.Report.WriteText(w)
+	}
+}
@@ -0,0 +1,160 @@
+package synckratos
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestSyncApps tests discovering apps in monorepo, picking one by name, and syncing each
+// TestSyncApps 测试在 monorepo 中发现应用、按名称选择应用以及逐个同步
+func TestSyncApps(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_apps_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	createApp := func(appPath string, protoContent string) {
+		appRoot := filepath.Join(tempRoot, appPath)
+		must.Done(os.MkdirAll(filepath.Join(appRoot, "internal/service"), 0755))
+		must.Done(os.MkdirAll(filepath.Join(appRoot, "cmd/server"), 0755))
+		must.Done(os.MkdirAll(filepath.Join(appRoot, "api/v1"), 0755))
+		must.Done(os.WriteFile(filepath.Join(appRoot, "api/v1/app.proto"), []byte(protoContent), 0644))
+	}
+	createApp("app/user/service", "syntax = \"proto3\";\noption go_package = \"demo/app/user/service/api/v1;v1\";\nservice User {\n  rpc GetUser (GetUserRequest) returns (GetUserReply);\n}\n")
+	createApp("app/order/service", "service Order {\n")
+	createApp("vendor/demo/service", "")
+	// go.work member outside the walked DIRs
+	// 位于被跳过 DIR 中的 go.work 成员
+	createApp("third_party/admin", "")
+	must.Done(os.WriteFile(filepath.Join(tempRoot, "go.work"), []byte("go 1.22\n\nuse (\n\t./app/user/service\n\t./third_party/admin\n)\n"), 0644))
+
+	apps, err := DiscoverApps(tempRoot)
+	require.NoError(t, err)
+	var names []string
+	for _, app := range apps {
+		names = append(names, app.Name)
+	}
+	require.Equal(t, []string{"app/order/service", "app/user/service", "third_party/admin"}, names)
+
+	app, err := FindApp(apps, "user")
+	require.NoError(t, err)
+	require.Equal(t, "app/user/service", app.Name)
+	app, err = FindApp(apps, "app/order/service")
+	require.NoError(t, err)
+	require.Equal(t, "app/order/service", app.Name)
+	_, err = FindApp(apps, "service")
+	require.True(t, IsErrorKind(err, ErrorKindBadOption))
+	_, err = FindApp(apps, "none")
+	require.True(t, IsErrorKind(err, ErrorKindBadOption))
+
+	// Broken proto of order app fails it, user app still syncs
+	// order 应用的 proto 损坏导致其失败，user 应用仍然同步
+	appsReport, err := SyncApps(context.Background(), apps[:2], &SyncOptions{DryRun: true})
+	require.Error(t, err)
+	t.Log(err)
+	require.Len(t, appsReport.Apps, 2)
+	require.Contains(t, appsReport.Apps[0].Error, "parse-failure")
+	require.Nil(t, appsReport.Apps[0].Report)
+	require.Empty(t, appsReport.Apps[1].Error)
+	require.True(t, appsReport.Apps[1].Report.Protos[0].Files[0].Created)
+	require.True(t, appsReport.HasChanges())
+
+	var buffer bytes.Buffer
+	appsReport.WriteText(&buffer)
+	t.Log(buffer.String())
+	require.Contains(t, buffer.String(), "app: app/user/service")
+	require.Contains(t, buffer.String(), "internal/service/user.go")
+
+	buffer.Reset()
+	require.NoError(t, appsReport.WriteJSON(&buffer))
+	require.Contains(t, buffer.String(), `"name": "app/order/service"`)
+
+	// go.work member beside the monorepo root keeps that root, diff paths go through ".."
+	// 位于 monorepo 根 DIR 旁边的 go.work 成员保留该根 DIR，diff 路径经过 ".."
+	workRoot := filepath.Join(tempRoot, "work")
+	createApp("shared/app", "syntax = \"proto3\";\noption go_package = \"demo/shared/app/api/v1;v1\";\nservice User {\n  rpc GetUser (GetUserRequest) returns (GetUserReply);\n}\n")
+	must.Done(os.MkdirAll(workRoot, 0755))
+	must.Done(os.WriteFile(filepath.Join(workRoot, "go.work"), []byte("go 1.22\n\nuse ../shared/app\n"), 0644))
+	apps, err = DiscoverApps(workRoot)
+	require.NoError(t, err)
+	require.Len(t, apps, 1)
+	require.Equal(t, "../shared/app", apps[0].Name)
+	require.Equal(t, workRoot, apps[0].Monorepo)
+
+	buffer.Reset()
+	_, err = SyncApps(context.Background(), apps, &SyncOptions{DryRun: true, DiffOutput: &buffer})
+	require.NoError(t, err)
+	t.Log(buffer.String())
+	require.Contains(t, buffer.String(), "+++ b/../shared/app/internal/service/user.go\n")
+}
+
+// TestSyncAppsDiff tests the combined diff of apps applying from monorepo root
+// TestSyncAppsDiff 测试多个应用合并后的 diff 可以在 monorepo 根 DIR 应用
+func TestSyncAppsDiff(t *testing.T) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not installed")
+	}
+	tempRoot := t.TempDir()
+	createApp := func(appPath string) {
+		appRoot := filepath.Join(tempRoot, appPath)
+		must.Done(os.MkdirAll(filepath.Join(appRoot, "internal/service"), 0755))
+		must.Done(os.MkdirAll(filepath.Join(appRoot, "cmd/server"), 0755))
+		must.Done(os.MkdirAll(filepath.Join(appRoot, "api/v1"), 0755))
+		must.Done(os.WriteFile(filepath.Join(appRoot, "api/v1/user.proto"), []byte(`syntax = "proto3";
+option go_package = "demo/`+appPath+`/api/v1;v1";
+service User {
+  rpc GetUser (GetUserRequest) returns (GetUserReply);
+  rpc ListUsers (GetUserRequest) returns (GetUserReply);
+}
+message GetUserRequest {}
+message GetUserReply {}
+`), 0644))
+		must.Done(os.WriteFile(filepath.Join(appRoot, "internal/service/user.go"), []byte(`package service
+
+import (
+	"context"
+
+	v1 "demo/`+appPath+`/api/v1"
+)
+
+type UserService struct {
+	v1.UnimplementedUserServer
+}
+
+func (s *UserService) GetUser(ctx context.Context, req *v1.GetUserRequest) (*v1.GetUserReply, error) {
+	return &v1.GetUserReply{}, nil
+}
+`), 0644))
+	}
+	createApp("app/user/service")
+	createApp("app/admin/service")
+
+	apps := rese.V1(DiscoverApps(tempRoot))
+	require.Len(t, apps, 2)
+	var buffer bytes.Buffer
+	_, err = SyncApps(context.Background(), apps, &SyncOptions{MaskMode: true, DryRun: true, DiffOutput: &buffer})
+	require.NoError(t, err)
+	t.Log(buffer.String())
+	require.Contains(t, buffer.String(), "diff --git a/app/admin/service/internal/service/user.go b/app/admin/service/internal/service/user.go\n")
+	require.Contains(t, buffer.String(), "diff --git a/app/user/service/internal/service/user.go b/app/user/service/internal/service/user.go\n")
+
+	patchPath := filepath.Join(t.TempDir(), "changes.patch")
+	must.Done(os.WriteFile(patchPath, buffer.Bytes(), 0644))
+	command := exec.Command(gitPath, "apply", patchPath)
+	command.Dir = tempRoot
+	output, err := command.CombinedOutput()
+	require.NoError(t, err, string(output))
+	for _, app := range apps {
+		code := string(rese.V1(os.ReadFile(filepath.Join(app.Root, "internal/service/user.go"))))
+		require.Contains(t, code, "func (s *UserService) ListUsers(")
+	}
+}
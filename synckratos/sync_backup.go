@@ -0,0 +1,280 @@
+package synckratos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/eroticgo"
+	"github.com/yyle88/osexistpath/ossoftexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// BackupRoot is the DIR holding backup snapshots, relative to project root
+// BackupRoot 是存放备份快照的 DIR，相对于项目根 DIR
+const BackupRoot = ".orzkratos/backups"
+
+// BackupManifest describes one backup snapshot, saved as manifest.json in snapshot DIR
+// BackupManifest 描述一个备份快照，保存为快照 DIR 中的 manifest.json
+type BackupManifest struct {
+	ID         string        `json:"id"`                    // Snapshot DIR name, sortable by time // 快照 DIR 名称，可按时间排序
+	CreatedAt  time.Time     `json:"created_at"`            // Time of the sync // 同步的时间
+	Protos     []string      `json:"protos"`                // Protos that triggered the sync // 触发同步的 proto
+	Files      []*BackupFile `json:"files"`                 // Files touched in the sync // 同步中涉及的文件
+	RestoredAt *time.Time    `json:"restored_at,omitempty"` // Time of the last restore, nil when never restored // 最后恢复的时间，从未恢复时为 nil
+}
+
+// BackupFile is one file in backup snapshot
+// BackupFile 是备份快照中的单个文件
+type BackupFile struct {
+	Path    string `json:"path"`    // File path relative to project root // 相对于项目根 DIR 的文件路径
+	Created bool   `json:"created"` // File is created in the sync, restore removes it // 文件在同步中新建，恢复时删除
+}
+
+// backup snapshots each file about to change into a new snapshot DIR with manifest
+// Skips when nothing changes, files outside project root are skipped with a warning
+// Fails before any service file is written, finish removes the snapshot when flush fails
+//
+// backup 将每个即将变更的文件快照到新的快照 DIR 并写入清单
+// 没有变更时跳过，项目根 DIR 之外的文件会被跳过并给出警告
+// 在写入任何服务文件之前失败，flush 失败时由 finish 删除该快照
+func (run *syncRun) backup() (*BackupManifest, error) {
+	files := run.store.changedFiles()
+	if len(files) == 0 {
+		return nil, nil
+	}
+	manifest := &BackupManifest{
+		CreatedAt: time.Now(),
+		Protos:    []string{},
+		Files:     make([]*BackupFile, 0, len(files)),
+	}
+	for _, proto := range run.report.Protos {
+		for _, change := range proto.Files {
+			if change.HasChanges() {
+				manifest.Protos = append(manifest.Protos, proto.Path)
+				break
+			}
+		}
+	}
+
+	backupRoot := filepath.Join(run.projectRoot, BackupRoot)
+	manifest.ID = newBackupID(backupRoot, manifest.CreatedAt)
+	snapshotRoot := filepath.Join(backupRoot, manifest.ID)
+	for _, file := range files {
+		path := run.relPath(file.path)
+		if path == ".." || strings.HasPrefix(path, "../") || filepath.IsAbs(path) {
+			zaplog.LOG.Warn("file outside project root, skip backup", zap.String("path", file.path))
+			continue
+		}
+		manifest.Files = append(manifest.Files, &BackupFile{Path: path, Created: file.created})
+		if file.created {
+			continue
+		}
+		backupPath := filepath.Join(snapshotRoot, "files", filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+			return nil, newSyncError(ErrorKindWriteFailure, filepath.Dir(backupPath), err)
+		}
+		if err := os.WriteFile(backupPath, file.oldCode, 0644); err != nil {
+			return nil, newSyncError(ErrorKindWriteFailure, backupPath, err)
+		}
+	}
+	if len(manifest.Files) == 0 {
+		return nil, nil
+	}
+	if err := writeBackupManifest(snapshotRoot, manifest); err != nil {
+		return nil, err
+	}
+	zaplog.LOG.Debug("backup done", zap.String("id", manifest.ID), zap.Int("files", len(manifest.Files)))
+	return manifest, nil
+}
+
+// removeBackup removes snapshot of a sync that did not reach disk, so undo never picks it
+// Failures only warn, the flush failure is what gets returned
+//
+// removeBackup 删除未写入磁盘的同步的快照，使撤销不会选中它
+// 失败时只给出警告，返回的是 flush 失败本身
+func removeBackup(projectRoot string, manifest *BackupManifest) {
+	snapshotRoot := filepath.Join(projectRoot, BackupRoot, manifest.ID)
+	if err := os.RemoveAll(snapshotRoot); err != nil {
+		zaplog.LOG.Warn("remove backup failed", zap.String("path", snapshotRoot), zap.Error(err))
+		return
+	}
+	zaplog.LOG.Debug("removed backup", zap.String("id", manifest.ID))
+}
+
+// pruneBackups removes the oldest snapshots, keeping the last keep ones
+// Failures only warn, since the sync itself is not affected
+//
+// pruneBackups 删除最早的快照，保留最近的 keep 个
+// 失败时只给出警告，因为同步本身不受影响
+func pruneBackups(projectRoot string, keep int) {
+	manifests, err := ListBackups(projectRoot)
+	if err != nil {
+		zaplog.LOG.Warn("list backups failed, skip prune", zap.Error(err))
+		return
+	}
+	for _, manifest := range manifests[:max(len(manifests)-keep, 0)] {
+		snapshotRoot := filepath.Join(projectRoot, BackupRoot, manifest.ID)
+		if err := os.RemoveAll(snapshotRoot); err != nil {
+			zaplog.LOG.Warn("remove backup failed", zap.String("path", snapshotRoot), zap.Error(err))
+			continue
+		}
+		zaplog.LOG.Debug("pruned backup", zap.String("id", manifest.ID))
+	}
+}
+
+// newBackupID returns a snapshot DIR name based on time, suffixed when taken
+// newBackupID 基于时间返回快照 DIR 名称，被占用时添加后缀
+func newBackupID(backupRoot string, createdAt time.Time) string {
+	baseID := createdAt.Format("20060102-150405")
+	id := baseID
+	for idx := 2; ossoftexist.IsRoot(filepath.Join(backupRoot, id)); idx++ {
+		id = fmt.Sprintf("%s-%d", baseID, idx)
+	}
+	return id
+}
+
+// writeBackupManifest writes manifest.json into snapshot DIR
+// writeBackupManifest 将 manifest.json 写入快照 DIR
+func writeBackupManifest(snapshotRoot string, manifest *BackupManifest) error {
+	if err := os.MkdirAll(snapshotRoot, 0755); err != nil {
+		return newSyncError(ErrorKindWriteFailure, snapshotRoot, err)
+	}
+	data, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return newSyncError(ErrorKindWriteFailure, snapshotRoot, err)
+	}
+	path := filepath.Join(snapshotRoot, "manifest.json")
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return newSyncError(ErrorKindWriteFailure, path, err)
+	}
+	return nil
+}
+
+// ListBackups returns backup snapshots of project, oldest first
+// ListBackups 返回项目的备份快照，最早的排在前面
+func ListBackups(projectRoot string) ([]*BackupManifest, error) {
+	backupRoot := filepath.Join(projectRoot, BackupRoot)
+	if !ossoftexist.IsRoot(backupRoot) {
+		return []*BackupManifest{}, nil
+	}
+	entries, err := os.ReadDir(backupRoot)
+	if err != nil {
+		return nil, newSyncError(ErrorKindReadFailure, backupRoot, err)
+	}
+	manifests := make([]*BackupManifest, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		snapshotRoot := filepath.Join(backupRoot, entry.Name())
+		if !ossoftexist.IsFile(filepath.Join(snapshotRoot, "manifest.json")) {
+			// Backup failed before writing manifest, nothing to restore
+			// 备份在写入清单前失败，无可恢复内容
+			zaplog.LOG.Warn("backup without manifest, skip", zap.String("path", snapshotRoot))
+			continue
+		}
+		manifest, err := readBackupManifest(snapshotRoot)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].CreatedAt.Before(manifests[j].CreatedAt)
+	})
+	return manifests, nil
+}
+
+// readBackupManifest reads manifest.json of snapshot DIR
+// readBackupManifest 读取快照 DIR 中的 manifest.json
+func readBackupManifest(snapshotRoot string) (*BackupManifest, error) {
+	path := filepath.Join(snapshotRoot, "manifest.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newSyncError(ErrorKindReadFailure, path, err)
+	}
+	manifest := &BackupManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, newSyncError(ErrorKindParseFailure, path, err)
+	}
+	return manifest, nil
+}
+
+// RestoreBackup restores service files from backup snapshot
+// Blank id picks the latest snapshot never restored, which undoes the last sync
+// Files created in the sync are removed, others get their content before the sync
+//
+// RestoreBackup 从备份快照恢复服务文件
+// id 为空时选择最新的未恢复快照，即撤销最近一次同步
+// 同步中新建的文件会被删除，其它文件恢复为同步前的内容
+func RestoreBackup(projectRoot string, id string) (*BackupManifest, error) {
+	manifests, err := ListBackups(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	var manifest *BackupManifest
+	for idx := len(manifests) - 1; idx >= 0; idx-- {
+		if id == "" && manifests[idx].RestoredAt == nil || id != "" && manifests[idx].ID == id {
+			manifest = manifests[idx]
+			break
+		}
+	}
+	backupRoot := filepath.Join(projectRoot, BackupRoot)
+	if manifest == nil {
+		return nil, newSyncError(ErrorKindPathNotFound, filepath.Join(backupRoot, id), erero.New("backup not found"))
+	}
+
+	snapshotRoot := filepath.Join(backupRoot, manifest.ID)
+	for _, file := range manifest.Files {
+		path := filepath.Join(projectRoot, filepath.FromSlash(file.Path))
+		zaplog.LOG.Debug("restore file", zap.String("path", path), zap.Bool("created", file.Created))
+		if file.Created {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, newSyncError(ErrorKindWriteFailure, path, err)
+			}
+			continue
+		}
+		backupPath := filepath.Join(snapshotRoot, "files", filepath.FromSlash(file.Path))
+		code, err := os.ReadFile(backupPath)
+		if err != nil {
+			return nil, newSyncError(ErrorKindReadFailure, backupPath, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, newSyncError(ErrorKindWriteFailure, filepath.Dir(path), err)
+		}
+		if err := writeFileAtomic(path, code); err != nil {
+			return nil, newSyncError(ErrorKindWriteFailure, path, err)
+		}
+	}
+	restoredAt := time.Now()
+	manifest.RestoredAt = &restoredAt
+	if err := writeBackupManifest(snapshotRoot, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// WriteBackups writes one line per backup snapshot, with time, protos and file count
+// WriteBackups 为每个备份快照写出一行，包含时间、proto 和文件数量
+func WriteBackups(w io.Writer, manifests []*BackupManifest) {
+	if len(manifests) == 0 {
+		_, _ = fmt.Fprintln(w, "no backups")
+		return
+	}
+	for _, manifest := range manifests {
+		line := fmt.Sprintf("%s  %s  %d files  %s", manifest.ID, manifest.CreatedAt.Format(time.DateTime), len(manifest.Files), strings.Join(manifest.Protos, " "))
+		if manifest.RestoredAt != nil {
+			_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint(line+"  (restored)"))
+			continue
+		}
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(line))
+	}
+}
@@ -0,0 +1,185 @@
+package synckratos
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestBackupAndRestore tests sync snapshots touched files, and undo restores them
+// TestBackupAndRestore 测试同步时快照涉及的文件，以及撤销时恢复这些文件
+func TestBackupAndRestore(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_backup_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	protoContent := `syntax = "proto3";
+
+package helloworld.v1;
+
+option go_package = "demo/api/helloworld/v1;v1";
+
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+  rpc SayBye (HelloRequest) returns (HelloReply);
+}
+
+service User {
+  rpc GetUser (HelloRequest) returns (HelloReply);
+}
+`
+	oldContent := `package service
+
+import (
+	"context"
+
+	pb "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
+}
+`
+	protoPath := filepath.Join(tempRoot, "api/helloworld/v1/greeter.proto")
+	servicePath := filepath.Join(tempRoot, "internal/service/greeter.go")
+	userPath := filepath.Join(tempRoot, "internal/service/user.go")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	must.Done(os.MkdirAll(filepath.Dir(servicePath), 0755))
+	must.Done(os.WriteFile(protoPath, []byte(protoContent), 0644))
+	must.Done(os.WriteFile(servicePath, []byte(oldContent), 0644))
+
+	// Dry-run takes no backup
+	// dry-run 不做备份
+	_, err := SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Empty(t, rese.V1(ListBackups(tempRoot)))
+
+	_, err = SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(rese.V1(os.ReadFile(servicePath))), "SayBye")
+	require.FileExists(t, userPath)
+
+	manifests, err := ListBackups(tempRoot)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	require.Equal(t, []string{"api/helloworld/v1/greeter.proto"}, manifests[0].Protos)
+	require.ElementsMatch(t, []*BackupFile{
+		{Path: "internal/service/greeter.go"},
+		{Path: "internal/service/user.go", Created: true},
+	}, manifests[0].Files)
+
+	var buffer bytes.Buffer
+	WriteBackups(&buffer, manifests)
+	t.Log(buffer.String())
+	require.Contains(t, buffer.String(), manifests[0].ID)
+
+	// Undo restores the last sync
+	// 撤销恢复最近一次同步
+	manifest, err := RestoreBackup(tempRoot, "")
+	require.NoError(t, err)
+	require.Equal(t, manifests[0].ID, manifest.ID)
+	require.Equal(t, oldContent, string(rese.V1(os.ReadFile(servicePath))))
+	require.NoFileExists(t, userPath)
+
+	// Nothing left to undo, restore via id still works
+	// 没有可撤销的快照，按 id 恢复仍然可用
+	_, err = RestoreBackup(tempRoot, "")
+	require.True(t, IsErrorKind(err, ErrorKindPathNotFound))
+	manifest, err = RestoreBackup(tempRoot, manifests[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, manifest.RestoredAt)
+}
+
+// TestBackupKeepAndOutsideRoot tests snapshots beyond KeepBackups are pruned, and files outside project root are skipped
+// TestBackupKeepAndOutsideRoot 测试超出 KeepBackups 的快照会被清理，以及项目根 DIR 之外的文件会被跳过
+func TestBackupKeepAndOutsideRoot(t *testing.T) {
+	tempRoot := t.TempDir()
+	protoPath := filepath.Join(tempRoot, "api/helloworld/v1/greeter.proto")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	writeProto := func(rpcs ...string) {
+		content := "syntax = \"proto3\";\npackage helloworld.v1;\noption go_package = \"demo/api/helloworld/v1;v1\";\nservice Greeter {\n"
+		for _, rpc := range rpcs {
+			content += "  rpc " + rpc + " (HelloRequest) returns (HelloReply);\n"
+		}
+		content += "}\nmessage HelloRequest {}\nmessage HelloReply {}\n"
+		must.Done(os.WriteFile(protoPath, []byte(content), 0644))
+	}
+
+	// Each sync adds a method and takes a snapshot, only the last 2 are kept
+	// 每次同步新增一个方法并做一次快照，只保留最近 2 个
+	var rpcs []string
+	for _, rpc := range []string{"SayHello", "SayBye", "SayHi", "SayYes"} {
+		rpcs = append(rpcs, rpc)
+		writeProto(rpcs...)
+		_, err := SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{KeepBackups: 2})
+		require.NoError(t, err)
+	}
+	manifests, err := ListBackups(tempRoot)
+	require.NoError(t, err)
+	require.Len(t, manifests, 2)
+	entries := rese.V1(os.ReadDir(filepath.Join(tempRoot, BackupRoot)))
+	require.Len(t, entries, 2)
+
+	// Service files outside project root are synced without backup
+	// 项目根 DIR 之外的服务文件会被同步但不做备份
+	serviceRoot := t.TempDir()
+	must.Done(os.WriteFile(filepath.Join(serviceRoot, "greeter.go"), rese.V1(os.ReadFile(filepath.Join(tempRoot, "internal/service/greeter.go"))), 0644))
+	writeProto(append(rpcs, "SayNo")...)
+	_, err = SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{ServiceRoot: serviceRoot, KeepBackups: 2})
+	require.NoError(t, err)
+	require.Contains(t, string(rese.V1(os.ReadFile(filepath.Join(serviceRoot, "greeter.go")))), "SayNo")
+	require.Equal(t, manifests, rese.V1(ListBackups(tempRoot)))
+}
+
+// TestBackupFlushFailure tests a failed write drops its snapshot, so undo picks the last written sync
+// TestBackupFlushFailure 测试写入失败时丢弃其快照，使撤销选中最近一次写入的同步
+func TestBackupFlushFailure(t *testing.T) {
+	tempRoot := t.TempDir()
+	protoPath := filepath.Join(tempRoot, "api/helloworld/v1/greeter.proto")
+	servicePath := filepath.Join(tempRoot, "internal/service/greeter.go")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	writeProto := func(content string) {
+		content = "syntax = \"proto3\";\npackage helloworld.v1;\noption go_package = \"demo/api/helloworld/v1;v1\";\n" + content + "message HelloRequest {}\nmessage HelloReply {}\n"
+		must.Done(os.WriteFile(protoPath, []byte(content), 0644))
+	}
+
+	writeProto("service Greeter {\n  rpc SayHello (HelloRequest) returns (HelloReply);\n}\n")
+	_, err := SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{KeepBackups: 1})
+	require.NoError(t, err)
+	manifests, err := ListBackups(tempRoot)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	oldContent := string(rese.V1(os.ReadFile(servicePath)))
+
+	// A non-empty DIR at user.go makes the flush fail after greeter.go is written
+	// user.go 位置上的非空 DIR 使 flush 在 greeter.go 写入后失败
+	must.Done(os.MkdirAll(filepath.Join(tempRoot, "internal/service/user.go/keep"), 0755))
+	writeProto("service Greeter {\n  rpc SayHello (HelloRequest) returns (HelloReply);\n  rpc SayBye (HelloRequest) returns (HelloReply);\n}\nservice User {\n  rpc GetUser (HelloRequest) returns (HelloReply);\n}\n")
+	_, err = SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{KeepBackups: 1})
+	require.True(t, IsErrorKind(err, ErrorKindWriteFailure), err)
+	require.Equal(t, oldContent, string(rese.V1(os.ReadFile(servicePath))))
+
+	// The failed sync leaves no snapshot and prunes none
+	// 失败的同步不留快照，也不清理快照
+	require.Equal(t, manifests, rese.V1(ListBackups(tempRoot)))
+	entries := rese.V1(os.ReadDir(filepath.Join(tempRoot, BackupRoot)))
+	require.Len(t, entries, 1)
+
+	// Undo restores the first sync, removing the created greeter.go
+	// 撤销恢复第一次同步，删除新建的 greeter.go
+	manifest, err := RestoreBackup(tempRoot, "")
+	require.NoError(t, err)
+	require.Equal(t, manifests[0].ID, manifest.ID)
+	require.NoFileExists(t, servicePath)
+}
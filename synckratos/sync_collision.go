@@ -0,0 +1,125 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/orzkratos/orzkratos/internal/utils"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// unexportedNames picks unexported names of removed methods
+// Type-checks the service package to avoid names taken on the struct or in the package,
+// on collision picks a deterministic suffixed name like getUserRemoved, getUserRemoved2
+//
+// unexportedNames 为已删除的方法选择非导出名称
+// 对服务包进行类型检查，避免与 struct 或包中已有的名称冲突，
+// 冲突时选择确定的带后缀名称，如 getUserRemoved、getUserRemoved2
+func (run *syncRun) unexportedNames(oldFile *ServiceFile, methods []*ast.FuncDecl) (map[*ast.FuncDecl]string, error) {
+	pkg, err := run.checkServicePackage(oldFile)
+	if err != nil {
+		return nil, err
+	}
+
+	takenNames := make(map[string]bool) // Names picked in this call // 本次调用中已选择的名称
+	isTaken := func(structName string, name string) bool {
+		if takenNames[structName+"."+name] || pkg.Scope().Lookup(name) != nil {
+			return true
+		}
+		if typeName, ok := pkg.Scope().Lookup(structName).(*types.TypeName); ok {
+			obj, _, _ := types.LookupFieldOrMethod(typeName.Type(), true, pkg, name)
+			return obj != nil
+		}
+		return false
+	}
+
+	results := make(map[*ast.FuncDecl]string, len(methods))
+	for _, method := range methods {
+		structName := receiverName(method)
+		baseName := utils.LowerFirstChar(method.Name.Name)
+		name := baseName
+		for idx := 1; isTaken(structName, name); idx++ {
+			name = baseName + "Removed"
+			if idx > 1 {
+				name += strconv.Itoa(idx)
+			}
+		}
+		if name != baseName {
+			zaplog.LOG.Debug("unexported name collision", zap.String("struct", structName), zap.String("name", baseName), zap.String("pick", name))
+		}
+		takenNames[structName+"."+name] = true
+		results[method] = name
+	}
+	return results, nil
+}
+
+// checkServicePackage type-checks Go files in the DIR of service file, reads them via store
+// Imported packages are stubbed, so it works without building dependencies, type errors are skipped
+//
+// checkServicePackage 对服务文件所在 DIR 的 Go 文件进行类型检查，通过存储读取文件
+// 导入的包使用空桩代替，因此无需构建依赖即可工作，类型错误会被忽略
+func (run *syncRun) checkServicePackage(oldFile *ServiceFile) (*types.Package, error) {
+	serviceRoot := filepath.Dir(oldFile.path)
+	fset := token.NewFileSet()
+	var astFiles []*ast.File
+	for _, path := range run.store.listGoFiles(serviceRoot) {
+		if filepath.Dir(path) != serviceRoot || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		code, err := run.store.read(path)
+		if err != nil {
+			return nil, err
+		}
+		astFile, err := parser.ParseFile(fset, path, code, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, newSyncError(ErrorKindParseFailure, path, err)
+		}
+		astFiles = append(astFiles, astFile)
+	}
+	config := &types.Config{
+		Importer: stubImporter{},
+		Error:    func(err error) {}, // Keep checking on errors, only declarations are needed // 出错时继续检查，只需要声明信息
+	}
+	pkg, _ := config.Check(oldFile.astFile.Name.Name, fset, astFiles, nil)
+	return pkg, nil
+}
+
+// stubImporter imports each package as an empty package
+// stubImporter 将每个包导入为空包
+type stubImporter struct{}
+
+// Import returns an empty package with path, named as last element of path
+// Import 返回指定路径的空包，包名为路径的最后一段
+func (stubImporter) Import(path string) (*types.Package, error) {
+	pkg := types.NewPackage(path, filepath.Base(path))
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// receiverName returns struct name of method receiver
+// receiverName 返回方法接收者的 struct 名
+func receiverName(method *ast.FuncDecl) string {
+	if method.Recv == nil || len(method.Recv.List) == 0 {
+		return ""
+	}
+	expr := method.Recv.List[0].Type
+	if starExpr, ok := expr.(*ast.StarExpr); ok {
+		expr = starExpr.X
+	}
+	switch typeExpr := expr.(type) {
+	case *ast.IndexExpr:
+		expr = typeExpr.X
+	case *ast.IndexListExpr:
+		expr = typeExpr.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
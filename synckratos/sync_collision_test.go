@@ -0,0 +1,93 @@
+package synckratos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestUnexportedNames tests picking suffixed names when lowercase names are taken
+// TestUnexportedNames 测试小写名称被占用时选择带后缀的名称
+func TestUnexportedNames(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_collision_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	serviceContent := `package service
+
+import (
+	"context"
+
+	pb "demo/api/user/v1"
+)
+
+type UserService struct {
+	pb.UnimplementedUserServer
+}
+
+func (s *UserService) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserReply, error) {
+	return s.getUser(ctx, req.Id)
+}
+
+func (s *UserService) getUser(ctx context.Context, id int64) (*pb.GetUserReply, error) {
+	return &pb.GetUserReply{}, nil
+}
+
+func (s *UserService) ListUser(ctx context.Context, req *pb.ListUserRequest) (*pb.ListUserReply, error) {
+	return &pb.ListUserReply{}, nil
+}
+
+func (s *UserService) DelUser(ctx context.Context, req *pb.DelUserRequest) (*pb.DelUserReply, error) {
+	return &pb.DelUserReply{}, nil
+}
+`
+	// Helper in another file of the same package takes getUserRemoved and listUser
+	// 同一包中另一个文件的辅助代码占用了 getUserRemoved 和 listUser
+	helperContent := `package service
+
+func (s *UserService) getUserRemoved() {}
+
+func listUser() {}
+`
+	newContent := `package service
+
+import (
+	pb "demo/api/user/v1"
+)
+
+type UserService struct {
+	pb.UnimplementedUserServer
+}
+`
+	serviceRoot := filepath.Join(tempRoot, "internal/service")
+	servicePath := filepath.Join(serviceRoot, "user.go")
+	must.Done(os.MkdirAll(serviceRoot, 0755))
+	must.Done(os.WriteFile(servicePath, []byte(serviceContent), 0644))
+	must.Done(os.WriteFile(filepath.Join(serviceRoot, "user_helper.go"), []byte(helperContent), 0644))
+
+	run := newSyncRun(tempRoot, &SyncOptions{DryRun: true})
+	oldFile, err := run.parseStoreFile(servicePath)
+	require.NoError(t, err)
+	newFile, err := parseServiceCode("new_user.go", []byte(newContent))
+	require.NoError(t, err)
+
+	change := run.change(filepath.Join(tempRoot, "api/user/v1/user.proto"), servicePath)
+	oldFile, err = run.handleRemovedMethods(change, oldFile, newFile)
+	require.NoError(t, err)
+	require.Equal(t, []*MethodRename{
+		{From: "GetUser", To: "getUserRemoved2"},
+		{From: "ListUser", To: "listUserRemoved"},
+		{From: "DelUser", To: "delUser"},
+	}, change.Unexported)
+
+	code := string(oldFile.code)
+	require.Contains(t, code, "func (s *UserService) getUserRemoved2(")
+	require.Contains(t, code, "func (s *UserService) getUser(ctx context.Context, id int64)")
+	require.Contains(t, code, "func (s *UserService) listUserRemoved(")
+	require.Contains(t, code, "func (s *UserService) delUser(")
+}
@@ -0,0 +1,153 @@
+package synckratos
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexistpath/ossoftexist"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the project config file, placed next to go.mod
+// ConfigFileName 是项目配置文件，放在 go.mod 旁边
+const ConfigFileName = ".orzkratos.yaml"
+
+// Config holds project defaults of both commands, CLI flags override them
+// Config 保存两个命令的项目默认值，命令行参数会覆盖它们
+type Config struct {
+	Auto            bool     `yaml:"auto"`             // Skip confirmation prompts // 跳过确认提示
+	Mask            bool     `yaml:"mask"`             // Match via Unimplemented*Server type // 按 Unimplemented*Server 类型匹配
+	KratosCLI       bool     `yaml:"kratos_cli"`       // Generate via kratos proto server // 通过 kratos proto server 生成
+	SortStructs     bool     `yaml:"sort_structs"`     // Sort structs sharing a file by proto // 按 proto 排序共用文件的 struct
+	RegisterServers bool     `yaml:"register_servers"` // Register new services in server constructors // 在服务器构造函数中注册新服务
+	SyncProviders   bool     `yaml:"sync_providers"`   // Append missing constructors to Wire ProviderSet // 将缺失的构造函数追加到 Wire ProviderSet
+	PruneProviders  bool     `yaml:"prune_providers"`  // Remove stale constructors from Wire ProviderSet // 从 Wire ProviderSet 删除过时的构造函数
+	Layers          bool     `yaml:"layers"`           // Scaffold biz and data layers of new services // 为新服务生成 biz 和 data 分层代码
+	Tests           bool     `yaml:"tests"`            // Generate test skeletons of methods added in sync // 为同步中新增的方法生成测试骨架
+	Removed         string   `yaml:"removed"`          // Policy of methods removed from proto // 已从 proto 删除的方法的处理策略
+	ProtoRoot       string   `yaml:"proto_root"`       // Proto DIR // proto DIR
+	ServiceRoot     string   `yaml:"service_root"`     // Service DIR // 服务 DIR
+	ServerRoot      string   `yaml:"server_root"`      // Server DIR holding grpc.go and http.go // 存放 grpc.go 和 http.go 的服务器 DIR
+	BizRoot         string   `yaml:"biz_root"`         // Biz DIR, blank means next to service DIR // biz DIR，为空时与服务 DIR 同级
+	DataRoot        string   `yaml:"data_root"`        // Data DIR, blank means next to service DIR // data DIR，为空时与服务 DIR 同级
+	StagingRoot     string   `yaml:"staging_root"`     // Staging DIR, blank means OS temp DIR // 暂存 DIR，为空时使用系统临时 DIR
+	ProtoIncludes   []string `yaml:"proto_includes"`   // Proto roots outside project, DIRs or Go modules // 项目之外的 proto 根 DIR，可以是 DIR 或 Go 模块
+	Ignore          []string `yaml:"ignore"`           // Globs of proto paths to skip, "**" matches any DIRs // 要跳过的 proto 路径通配符，"**" 匹配任意层 DIR
+	KeepBackups     int      `yaml:"keep_backups"`     // Backup snapshots to keep, default 20, 0 keeps all // 保留的备份快照数量，默认 20，为 0 时全部保留
+
+	ImportRewrites *ImportRewrites `yaml:"import_rewrites"` // Rules fixing imports of generated code // 修复生成代码导入的规则
+	Templates      *Templates      `yaml:"templates"`       // Template files replacing built-in ones // 替换内置模板的模板文件
+}
+
+// NewConfig creates config with default values, same as CLI flag defaults
+// KeepBackups defaults to 20, unlike the SyncOptions zero value which keeps all
+//
+// NewConfig 创建带默认值的配置，与命令行参数默认值一致
+// KeepBackups 默认为 20，不同于 SyncOptions 零值的全部保留
+func NewConfig() *Config {
+	return &Config{
+		Mask:          true,
+		Removed:       string(RemovedMethodUnexport),
+		ProtoRoot:     "api",
+		ServiceRoot:   "internal/service",
+		ServerRoot:    "internal/server",
+		ProtoIncludes: []string{},
+		Ignore:        []string{},
+		KeepBackups:   20,
+
+		ImportRewrites: &ImportRewrites{Types: map[string]string{}, Aliases: map[string]string{}},
+		Templates:      &Templates{},
+	}
+}
+
+// LoadConfig reads ConfigFileName in project root, keys not in file keep default values
+// Returns defaults when file does not exist, parse-failure on unknown keys
+//
+// LoadConfig 读取项目根 DIR 中的 ConfigFileName，文件中没有的键保持默认值
+// 文件不存在时返回默认值，存在未知的键时返回 parse-failure
+func LoadConfig(projectRoot string) (*Config, error) {
+	config := NewConfig()
+	path := filepath.Join(projectRoot, ConfigFileName)
+	if !ossoftexist.IsFile(path) {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newSyncError(ErrorKindReadFailure, path, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, newSyncError(ErrorKindParseFailure, path, err)
+	}
+	if err := checkRemovedMethodPolicy(RemovedMethodPolicy(config.Removed)); err != nil {
+		return nil, newSyncError(ErrorKindBadOption, path, err)
+	}
+	if err := checkImportRewrites(config.ImportRewrites); err != nil {
+		return nil, newSyncError(ErrorKindBadOption, path, err)
+	}
+	return config, nil
+}
+
+// WriteYAML writes config as YAML, used to show the effective config
+// WriteYAML 将配置写为 YAML，用于显示生效的配置
+func (config *Config) WriteYAML(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return erero.Wro(err)
+	}
+	if err := encoder.Close(); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// matchGlob checks if slash path matches glob
+// "*" and "?" match within one path element, "**" matches any number of DIRs
+//
+// matchGlob 检查斜杠路径是否匹配通配符
+// "*" 和 "?" 在单个路径元素内匹配，"**" 匹配任意层 DIR
+func matchGlob(glob string, path string) bool {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for idx := 0; idx < len(glob); idx++ {
+		switch {
+		case strings.HasPrefix(glob[idx:], "**/"):
+			pattern.WriteString("(.*/)?")
+			idx += 2
+		case strings.HasPrefix(glob[idx:], "**"):
+			pattern.WriteString(".*")
+			idx++
+		case glob[idx] == '*':
+			pattern.WriteString("[^/]*")
+		case glob[idx] == '?':
+			pattern.WriteString("[^/]")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(glob[idx : idx+1]))
+		}
+	}
+	pattern.WriteString("$")
+	matched, _ := regexp.MatchString(pattern.String(), path)
+	return matched
+}
+
+// isIgnored checks if path matches one of the ignore globs, path is made relative to project root
+// isIgnored 检查路径是否匹配任一忽略通配符，路径会转换为相对于项目根 DIR 的形式
+func isIgnored(projectRoot string, path string, globs []string) bool {
+	if rel, err := filepath.Rel(projectRoot, path); err == nil {
+		path = rel
+	}
+	path = filepath.ToSlash(path)
+	for _, glob := range globs {
+		if matchGlob(glob, path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package synckratos
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestLoadConfig tests config defaults, file values and failures on wrong keys or values
+// TestLoadConfig 测试配置默认值、文件值，以及错误键或值的失败
+func TestLoadConfig(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_config_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+	configPath := filepath.Join(tempRoot, ConfigFileName)
+
+	config, err := LoadConfig(tempRoot)
+	require.NoError(t, err)
+	require.Equal(t, NewConfig(), config)
+	// Features editing files outside service DIR are off, same as SyncOptions
+	// 修改服务 DIR 之外文件的功能默认关闭，与 SyncOptions 一致
+	require.False(t, config.RegisterServers)
+	require.False(t, config.SyncProviders)
+	// Backups are pruned to 20, unlike SyncOptions whose zero value keeps all
+	// 备份清理到 20 个，不同于 SyncOptions 零值的全部保留
+	require.Equal(t, 20, config.KeepBackups)
+
+	must.Done(os.WriteFile(configPath, []byte("mask: false\nremoved: delete\nservice_root: app/user/service/internal/service\nproto_includes:\n  - ../shared/api\nignore:\n  - api/third_party/**\nimport_rewrites:\n  aliases:\n    github.com/acme/shared/common/v1: commonv1\n"), 0644))
+	config, err = LoadConfig(tempRoot)
+	require.NoError(t, err)
+	require.False(t, config.Mask)
+	require.Equal(t, string(RemovedMethodDelete), config.Removed)
+	require.Equal(t, "api", config.ProtoRoot)
+	require.Equal(t, "app/user/service/internal/service", config.ServiceRoot)
+	require.Equal(t, []string{"../shared/api"}, config.ProtoIncludes)
+	require.Equal(t, []string{"api/third_party/**"}, config.Ignore)
+	require.Equal(t, map[string]string{"github.com/acme/shared/common/v1": "commonv1"}, config.ImportRewrites.Aliases)
+	require.Empty(t, config.ImportRewrites.Types)
+
+	var buffer bytes.Buffer
+	require.NoError(t, config.WriteYAML(&buffer))
+	t.Log(buffer.String())
+	require.Contains(t, buffer.String(), "removed: delete\n")
+
+	must.Done(os.WriteFile(configPath, []byte("maks: true\n"), 0644))
+	_, err = LoadConfig(tempRoot)
+	require.True(t, IsErrorKind(err, ErrorKindParseFailure))
+
+	must.Done(os.WriteFile(configPath, []byte("removed: drop\n"), 0644))
+	_, err = LoadConfig(tempRoot)
+	require.True(t, IsErrorKind(err, ErrorKindBadOption))
+
+	must.Done(os.WriteFile(configPath, []byte("import_rewrites:\n  types:\n    common_v1_Page: Page\n"), 0644))
+	_, err = LoadConfig(tempRoot)
+	require.True(t, IsErrorKind(err, ErrorKindBadOption))
+}
+
+// TestMatchGlob tests glob matching on slash paths
+// TestMatchGlob 测试斜杠路径上的通配符匹配
+func TestMatchGlob(t *testing.T) {
+	require.True(t, matchGlob("api/third_party/**", "api/third_party/google/api/http.proto"))
+	require.True(t, matchGlob("**/internal/*.proto", "api/internal/a.proto"))
+	require.True(t, matchGlob("**/internal/*.proto", "internal/a.proto"))
+	require.False(t, matchGlob("**/internal/*.proto", "api/internal/v1/a.proto"))
+	require.True(t, matchGlob("api/*/v?/*.proto", "api/user/v1/user.proto"))
+	require.False(t, matchGlob("api/*.proto", "api/user/user.proto"))
+	require.False(t, matchGlob("api/user.proto", "api/userXproto"))
+}
+
+// TestSyncServicesIgnore tests ignored protos are skipped, even when they fail to parse
+// TestSyncServicesIgnore 测试被忽略的 proto 会被跳过，即使无法解析
+func TestSyncServicesIgnore(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_ignore_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	brokenPath := filepath.Join(tempRoot, "api/third_party/broken.proto")
+	must.Done(os.MkdirAll(filepath.Dir(brokenPath), 0755))
+	must.Done(os.WriteFile(brokenPath, []byte("service Broken {\n"), 0644))
+
+	_, err := SyncServices(context.Background(), tempRoot, &SyncOptions{DryRun: true})
+	require.True(t, IsErrorKind(err, ErrorKindParseFailure))
+
+	report, err := SyncServices(context.Background(), tempRoot, &SyncOptions{DryRun: true, IgnoreGlobs: []string{"api/third_party/**"}})
+	require.NoError(t, err)
+	require.Empty(t, report.Protos)
+}
@@ -0,0 +1,383 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/orzkratos/orzkratos/internal/utils"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// LayerChange records biz and data layers scaffolded for one service created in this sync
+// LayerChange 记录为本次同步新建的单个服务生成的 biz 和 data 分层代码
+type LayerChange struct {
+	Service   string   `json:"service"`   // Service name // 服务名
+	Created   []string `json:"created"`   // Biz and data files created, relative to project root // 新建的 biz 和 data 文件，相对于项目根 DIR
+	Injected  bool     `json:"injected"`  // Usecase injected into service struct // 用例已注入服务 struct
+	Providers []string `json:"providers"` // Constructors appended to ProviderSets // 追加到 ProviderSet 的构造函数
+}
+
+// bizLayerTemplate generates usecase and repo interface of new service, same layout as kratos-layout greeter
+// bizLayerTemplate 生成新服务的用例和仓库接口，布局与 kratos-layout 的 greeter 一致
+const bizLayerTemplate = `package {{ .BizName }}
+
+import (
+	"context"
+)
+
+// {{ .Service }} is a {{ .Service }} model.
+type {{ .Service }} struct {
+	ID int64
+}
+
+// {{ .Service }}Repo is a {{ .Service }} repo.
+type {{ .Service }}Repo interface {
+	Save(context.Context, *{{ .Service }}) (*{{ .Service }}, error)
+	FindByID(context.Context, int64) (*{{ .Service }}, error)
+}
+
+// {{ .Service }}Usecase is a {{ .Service }} usecase.
+type {{ .Service }}Usecase struct {
+	repo {{ .Service }}Repo
+}
+
+// New{{ .Service }}Usecase new a {{ .Service }} usecase.
+func New{{ .Service }}Usecase(repo {{ .Service }}Repo) *{{ .Service }}Usecase {
+	return &{{ .Service }}Usecase{repo: repo}
+}
+`
+
+// dataLayerTemplate generates repo implementation of new service, same layout as kratos-layout greeter
+// dataLayerTemplate 生成新服务的仓库实现，布局与 kratos-layout 的 greeter 一致
+const dataLayerTemplate = `package {{ .DataName }}
+
+import (
+	"context"
+
+	"{{ .BizPackage }}"
+)
+
+type {{ .Var }}Repo struct {
+	data *Data
+}
+
+// New{{ .Service }}Repo .
+func New{{ .Service }}Repo(data *Data) {{ .BizName }}.{{ .Service }}Repo {
+	return &{{ .Var }}Repo{data: data}
+}
+
+func (r *{{ .Var }}Repo) Save(ctx context.Context, m *{{ .BizName }}.{{ .Service }}) (*{{ .BizName }}.{{ .Service }}, error) {
+	return m, nil
+}
+
+func (r *{{ .Var }}Repo) FindByID(ctx context.Context, id int64) (*{{ .BizName }}.{{ .Service }}, error) {
+	return nil, nil
+}
+`
+
+// layerStub is the data of biz and data layer templates
+// layerStub 是 biz 和 data 分层模板的数据
+type layerStub struct {
+	Service     string // Go name of service, e.g. "User" // 服务的 Go 名称，例如 "User"
+	Var         string // Service name with lowercase first letter, e.g. "user" // 首字母小写的服务名，例如 "user"
+	BizPackage  string // Go import path of biz package // biz 包的 Go 导入路径
+	BizName     string // Package name of biz // biz 的包名
+	DataPackage string // Go import path of data package // data 包的 Go 导入路径
+	DataName    string // Package name of data // data 的包名
+}
+
+// scaffoldLayers generates biz and data files of each service created in this sync, from templates
+// Injects the usecase into the service struct, and appends constructors to ProviderSets of service, biz and data
+// A layer file is skipped when it exists or its names are taken in the package, existing constructors are still wired
+//
+// scaffoldLayers 根据模板为本次同步新建的每个服务生成 biz 和 data 文件
+// 将用例注入服务 struct，并将构造函数追加到 service、biz 和 data 的 ProviderSet
+// 分层文件已存在或其名称在包中已被占用时跳过，已有的构造函数仍会被装配
+func (run *syncRun) scaffoldLayers() error {
+	services, err := run.createdServices()
+	if err != nil || len(services) == 0 {
+		return err
+	}
+	templates := run.options.Templates
+	if templates == nil {
+		templates = &Templates{}
+	}
+	bizTemplate, err := loadTemplate(run.projectRoot, templates.Biz, "biz", bizLayerTemplate)
+	if err != nil {
+		return err
+	}
+	dataTemplate, err := loadTemplate(run.projectRoot, templates.Data, "data", dataLayerTemplate)
+	if err != nil {
+		return err
+	}
+	serviceRoot := run.options.serviceRoot(run.projectRoot)
+	bizRoot := run.options.bizRoot(run.projectRoot)
+	dataRoot := run.options.dataRoot(run.projectRoot)
+	bizPkgPath, err := goPackagePath(bizRoot)
+	if err != nil {
+		return err
+	}
+	dataPkgPath, err := goPackagePath(dataRoot)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		stub := &layerStub{
+			Service:     service.name,
+			Var:         utils.LowerFirstChar(service.name),
+			BizPackage:  bizPkgPath,
+			BizName:     path.Base(bizPkgPath),
+			DataPackage: dataPkgPath,
+			DataName:    path.Base(dataPkgPath),
+		}
+		change := &LayerChange{Service: service.name, Created: []string{}, Providers: []string{}}
+		fileName := strings.ToLower(service.name) + ".go"
+		for _, layer := range []struct {
+			root string
+			tmpl *template.Template
+		}{
+			{root: bizRoot, tmpl: bizTemplate},
+			{root: dataRoot, tmpl: dataTemplate},
+		} {
+			layerPath := filepath.Join(layer.root, fileName)
+			created, err := run.createLayerFile(layerPath, layer.tmpl, stub)
+			if err != nil {
+				return err
+			}
+			if created {
+				change.Created = append(change.Created, run.relPath(layerPath))
+			}
+		}
+
+		// Inject and wire only constructors the packages declare, created now or written by hand
+		// 只注入和装配包中已声明的构造函数，可以是本次新建的，也可以是手写的
+		usecaseName := service.name + "Usecase"
+		bizNames, err := run.packageNames(bizRoot)
+		if err != nil {
+			return err
+		}
+		if bizNames["New"+usecaseName] {
+			code, err := run.store.read(service.path)
+			if err != nil {
+				return err
+			}
+			newCode, injected, err := injectUsecase(code, service.structName, usecaseName, bizPkgPath)
+			if err != nil {
+				return newSyncError(ErrorKindParseFailure, service.path, err)
+			}
+			if injected {
+				if err := run.store.write(service.path, newCode); err != nil {
+					return err
+				}
+				change.Injected = true
+			}
+			added, err := run.appendProviders(bizRoot, []string{"New" + usecaseName})
+			if err != nil {
+				return err
+			}
+			change.Providers = append(change.Providers, added...)
+		}
+		dataNames, err := run.packageNames(dataRoot)
+		if err != nil {
+			return err
+		}
+		if dataNames["New"+service.name+"Repo"] {
+			added, err := run.appendProviders(dataRoot, []string{"New" + service.name + "Repo"})
+			if err != nil {
+				return err
+			}
+			change.Providers = append(change.Providers, added...)
+		}
+		added, err := run.appendProviders(serviceRoot, []string{"New" + service.structName})
+		if err != nil {
+			return err
+		}
+		change.Providers = append(change.Providers, added...)
+
+		if change.Injected || len(change.Providers) > 0 {
+			run.report.WireGen = true
+		}
+		run.report.Layers = append(run.report.Layers, change)
+	}
+	return nil
+}
+
+// createLayerFile renders layer template into store at path
+// Skips when file exists or a top-level name of rendered code is declared in package already
+//
+// createLayerFile 将分层模板渲染到存储中的 path
+// 文件已存在，或渲染代码的顶层名称已在包中声明时跳过
+func (run *syncRun) createLayerFile(path string, tmpl *template.Template, stub *layerStub) (bool, error) {
+	if run.store.exists(path) {
+		zaplog.LOG.Debug("layer file exists, skip", zap.String("path", path))
+		return false, nil
+	}
+	code, err := executeTemplate(tmpl, stub)
+	if err != nil {
+		return false, err
+	}
+	astFile, err := parser.ParseFile(token.NewFileSet(), "", code, parser.SkipObjectResolution)
+	if err != nil {
+		return false, newSyncError(ErrorKindBadOption, "templates."+tmpl.Name(), err)
+	}
+	names, err := run.packageNames(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+	for name := range declaredNames(astFile) {
+		if names[name] {
+			zaplog.LOG.Warn("layer name taken in package, skip", zap.String("path", path), zap.String("name", name))
+			return false, nil
+		}
+	}
+	return run.store.create(path, code), nil
+}
+
+// packageNames returns top-level names declared in Go files of root, reading via store
+// packageNames 通过存储读取 root 中的 Go 文件，返回其中声明的顶层名称
+func (run *syncRun) packageNames(root string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	for _, path := range run.store.listGoFiles(root) {
+		if filepath.Dir(path) != root || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		code, err := run.store.read(path)
+		if err != nil {
+			return nil, err
+		}
+		astFile, err := parser.ParseFile(token.NewFileSet(), path, code, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, newSyncError(ErrorKindParseFailure, path, err)
+		}
+		for name := range declaredNames(astFile) {
+			names[name] = true
+		}
+	}
+	return names, nil
+}
+
+// declaredNames returns names of top-level types, functions, vars and consts, methods excluded
+// declaredNames 返回顶层类型、函数、变量和常量的名称，不包括方法
+func declaredNames(astFile *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, decl := range astFile.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				names[decl.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names[spec.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						names[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// injectUsecase adds usecase field into service struct, and takes it as param of New<Struct> constructor
+// e.g. "uc *biz.UserUsecase" field, "NewUserService(uc *biz.UserUsecase)" and "&UserService{uc: uc}"
+// Skips when struct already holds the usecase, or constructor does not return a keyed composite literal
+//
+// injectUsecase 将用例字段添加到服务 struct，并作为 New<Struct> 构造函数的参数
+// 例如 "uc *biz.UserUsecase" 字段、"NewUserService(uc *biz.UserUsecase)" 和 "&UserService{uc: uc}"
+// struct 已持有该用例，或构造函数返回的不是带键的复合字面量时跳过
+func injectUsecase(code []byte, structName string, usecaseName string, bizPkgPath string) ([]byte, bool, error) {
+	astFile, err := parser.ParseFile(token.NewFileSet(), "", code, parser.ParseComments)
+	if err != nil {
+		return nil, false, err
+	}
+	var structType *ast.StructType
+	var constructor *ast.FuncDecl
+	for _, decl := range astFile.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if typeSpec, ok := spec.(*ast.TypeSpec); ok && typeSpec.Name.Name == structName {
+					structType, _ = typeSpec.Type.(*ast.StructType)
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv == nil && decl.Name.Name == "New"+structName && decl.Body != nil {
+				constructor = decl
+			}
+		}
+	}
+	if structType == nil || constructor == nil {
+		return code, false, nil
+	}
+	fieldNames := make(map[string]bool)
+	for _, field := range structType.Fields.List {
+		if strings.HasSuffix(getTypeName(code, field.Type), "."+usecaseName) {
+			return code, false, nil
+		}
+		for _, name := range field.Names {
+			fieldNames[name.Name] = true
+		}
+	}
+	if fieldNames["uc"] {
+		return code, false, nil
+	}
+	var literal *ast.CompositeLit
+	for _, stmt := range constructor.Body.List {
+		returnStmt, ok := stmt.(*ast.ReturnStmt)
+		if !ok || len(returnStmt.Results) != 1 {
+			continue
+		}
+		if unaryExpr, ok := returnStmt.Results[0].(*ast.UnaryExpr); ok && unaryExpr.Op == token.AND {
+			literal, _ = unaryExpr.X.(*ast.CompositeLit)
+		}
+	}
+	if literal == nil {
+		return code, false, nil
+	}
+	for _, elt := range literal.Elts {
+		if _, ok := elt.(*ast.KeyValueExpr); !ok {
+			return code, false, nil
+		}
+	}
+
+	takenNames := importPathMap(astFile)
+	bizName, ok := importNameMap(astFile)[bizPkgPath]
+	imports := make(map[string]string)
+	if !ok {
+		bizName = pickImportName(takenNames, path.Base(bizPkgPath), path.Base(bizPkgPath))
+		imports[bizPkgPath] = bizName
+	}
+	usecaseType := "*" + bizName + "." + usecaseName
+
+	edits := []*textEdit{{pos: structType.Fields.Closing, end: structType.Fields.Closing, text: "\tuc " + usecaseType + "\n"}}
+	if fields := structType.Fields.List; len(fields) > 0 {
+		edits[0] = &textEdit{pos: fields[len(fields)-1].End(), end: fields[len(fields)-1].End(), text: "\n\tuc " + usecaseType}
+	}
+	params := constructor.Type.Params
+	if len(params.List) > 0 {
+		edits = append(edits, &textEdit{pos: params.Closing, end: params.Closing, text: ", uc " + usecaseType})
+	} else {
+		edits = append(edits, &textEdit{pos: params.Closing, end: params.Closing, text: "uc " + usecaseType})
+	}
+	if len(literal.Elts) > 0 {
+		edits = append(edits, &textEdit{pos: literal.Elts[len(literal.Elts)-1].End(), end: literal.Elts[len(literal.Elts)-1].End(), text: ", uc: uc"})
+	} else {
+		edits = append(edits, &textEdit{pos: literal.Rbrace, end: literal.Rbrace, text: "uc: uc"})
+	}
+	newCode, err := addNamedImports(applyTextEdits(code, edits), imports)
+	if err != nil {
+		return nil, false, err
+	}
+	return newCode, true, nil
+}
@@ -0,0 +1,177 @@
+package synckratos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestInjectUsecase tests injecting usecase into service struct and its constructor
+// TestInjectUsecase 测试将用例注入服务 struct 及其构造函数
+func TestInjectUsecase(t *testing.T) {
+	code := `package service
+
+import (
+	pb "demo/api/user/v1"
+)
+
+type UserService struct {
+	pb.UnimplementedUserServer
+}
+
+func NewUserService() *UserService {
+	return &UserService{}
+}
+`
+	newCode, injected, err := injectUsecase([]byte(code), "UserService", "UserUsecase", "demo/internal/biz")
+	require.NoError(t, err)
+	require.True(t, injected)
+	t.Log(string(newCode))
+	require.Contains(t, string(newCode), "\tpb.UnimplementedUserServer\n\tuc *biz.UserUsecase\n}")
+	require.Contains(t, string(newCode), "func NewUserService(uc *biz.UserUsecase) *UserService {\n\treturn &UserService{uc: uc}\n}")
+	require.Contains(t, string(newCode), `"demo/internal/biz"`)
+
+	// Injected code is skipped
+	// 已注入的代码会被跳过
+	_, injected, err = injectUsecase(newCode, "UserService", "UserUsecase", "demo/internal/biz")
+	require.NoError(t, err)
+	require.False(t, injected)
+}
+
+// TestSyncServicesLayers tests scaffolding biz and data layers of new services, with built-in and custom templates
+// TestSyncServicesLayers 测试使用内置和自定义模板为新服务生成 biz 和 data 分层代码
+func TestSyncServicesLayers(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_layers_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	writeFile := func(path string, content string) {
+		path = filepath.Join(tempRoot, path)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+	}
+	readFile := func(path string) string {
+		return string(rese.V1(os.ReadFile(filepath.Join(tempRoot, path))))
+	}
+	writeFile("go.mod", "module demo\n\ngo 1.22\n")
+	writeFile("api/user/v1/user.proto", `syntax = "proto3";
+package user.v1;
+option go_package = "demo/api/user/v1;v1";
+service User {
+  rpc GetUser (GetUserRequest) returns (GetUserReply);
+}
+message GetUserRequest {}
+message GetUserReply {}
+`)
+	writeFile("api/order/v1/order.proto", `syntax = "proto3";
+package order.v1;
+option go_package = "demo/api/order/v1;v1";
+service Order {
+  rpc GetOrder (GetOrderRequest) returns (GetOrderReply);
+}
+message GetOrderRequest {}
+message GetOrderReply {}
+`)
+	writeFile("internal/service/service.go", `package service
+
+import "github.com/google/wire"
+
+// ProviderSet is service providers.
+var ProviderSet = wire.NewSet()
+`)
+	writeFile("internal/biz/biz.go", `package biz
+
+import "github.com/google/wire"
+
+// ProviderSet is biz providers.
+var ProviderSet = wire.NewSet()
+`)
+	writeFile("internal/data/data.go", `package data
+
+import "github.com/google/wire"
+
+// ProviderSet is data providers.
+var ProviderSet = wire.NewSet(NewData)
+
+// Data .
+type Data struct{}
+
+// NewData .
+func NewData() *Data {
+	return &Data{}
+}
+`)
+	// Name taken in data package, so data layer of Order is skipped
+	// 名称在 data 包中已被占用，因此跳过 Order 的 data 层
+	writeFile("internal/data/legacy.go", `package data
+
+type orderRepo struct{}
+`)
+	writeFile("templates/biz.tmpl", `package {{ .BizName }}
+
+// {{ .Service }}Usecase is custom.
+type {{ .Service }}Usecase struct{}
+
+func New{{ .Service }}Usecase() *{{ .Service }}Usecase {
+	return &{{ .Service }}Usecase{}
+}
+`)
+
+	report, err := SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, Layers: true})
+	require.NoError(t, err)
+	report.WriteText(os.Stdout)
+	require.Equal(t, []*LayerChange{
+		{Service: "Order", Created: []string{"internal/biz/order.go"}, Injected: true, Providers: []string{"NewOrderUsecase", "NewOrderService"}},
+		{Service: "User", Created: []string{"internal/biz/user.go", "internal/data/user.go"}, Injected: true, Providers: []string{"NewUserUsecase", "NewUserRepo", "NewUserService"}},
+	}, report.Layers)
+	require.True(t, report.WireGen)
+
+	require.Contains(t, readFile("internal/biz/user.go"), "func NewUserUsecase(repo UserRepo) *UserUsecase {")
+	require.Contains(t, readFile("internal/data/user.go"), "func NewUserRepo(data *Data) biz.UserRepo {")
+	require.Contains(t, readFile("internal/data/user.go"), `"demo/internal/biz"`)
+	require.Contains(t, readFile("internal/service/user.go"), "func NewUserService(uc *biz.UserUsecase) *UserService {")
+	require.Contains(t, readFile("internal/service/order.go"), "\tuc *biz.OrderUsecase\n")
+	require.Contains(t, readFile("internal/biz/biz.go"), "var ProviderSet = wire.NewSet(NewOrderUsecase, NewUserUsecase)\n")
+	require.Contains(t, readFile("internal/data/data.go"), "var ProviderSet = wire.NewSet(NewData, NewUserRepo)\n")
+	require.Contains(t, readFile("internal/service/service.go"), "var ProviderSet = wire.NewSet(NewOrderService, NewUserService)\n")
+	require.NoFileExists(t, filepath.Join(tempRoot, "internal/data/order.go"))
+
+	// Custom template applies to services created later
+	// 自定义模板作用于之后新建的服务
+	writeFile("api/shop/v1/shop.proto", `syntax = "proto3";
+package shop.v1;
+option go_package = "demo/api/shop/v1;v1";
+service Shop {
+  rpc GetShop (GetShopRequest) returns (GetShopReply);
+}
+message GetShopRequest {}
+message GetShopReply {}
+`)
+	report, err = SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, Layers: true, Templates: &Templates{Biz: "templates/biz.tmpl"}})
+	require.NoError(t, err)
+	require.Len(t, report.Layers, 1)
+	require.Equal(t, "Shop", report.Layers[0].Service)
+	require.Contains(t, readFile("internal/biz/shop.go"), "// ShopUsecase is custom.\n")
+
+	// Bad template fails before writing
+	// 错误的模板在写入前失败
+	writeFile("templates/bad.tmpl", "package {{ .Missing")
+	writeFile("api/cart/v1/cart.proto", `syntax = "proto3";
+package cart.v1;
+option go_package = "demo/api/cart/v1;v1";
+service Cart {
+  rpc GetCart (GetCartRequest) returns (GetCartReply);
+}
+message GetCartRequest {}
+message GetCartReply {}
+`)
+	_, err = SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, Layers: true, Templates: &Templates{Data: "templates/bad.tmpl"}})
+	require.True(t, IsErrorKind(err, ErrorKindBadOption))
+	require.NoFileExists(t, filepath.Join(tempRoot, "internal/service/cart.go"))
+}
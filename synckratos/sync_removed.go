@@ -0,0 +1,212 @@
+package synckratos
+
+import (
+	"go/ast"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/printgo"
+	"github.com/yyle88/syntaxgo/syntaxgo_astnode"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// RemovedMethodPolicy tells how to handle methods whose proto functions are deleted
+// RemovedMethodPolicy 表示如何处理 proto 函数已删除的方法
+type RemovedMethodPolicy string
+
+const (
+	RemovedMethodUnexport   RemovedMethodPolicy = "unexport"     // Lowercase first letter of method name (default) // 方法名首字母小写（默认）
+	RemovedMethodCommentOut RemovedMethodPolicy = "comment-out"  // Comment out method code // 注释掉方法代码
+	RemovedMethodMoveToFile RemovedMethodPolicy = "move-to-file" // Move method into <service>_deprecated.go behind build tag // 将方法移到带构建标签的 <service>_deprecated.go 中
+	RemovedMethodDelete     RemovedMethodPolicy = "delete"       // Delete method code // 删除方法代码
+	RemovedMethodKeep       RemovedMethodPolicy = "keep"         // Keep method as it is // 保持方法不变
+)
+
+// DeprecatedBuildTag is the build tag guarding methods moved via RemovedMethodMoveToFile
+// Build with -tags orzkratos_deprecated to compile them
+//
+// DeprecatedBuildTag 是 RemovedMethodMoveToFile 移出的方法所使用的构建标签
+// 使用 -tags orzkratos_deprecated 构建才会编译这些方法
+const DeprecatedBuildTag = "orzkratos_deprecated"
+
+// RemovedMethodPolicies lists the supported policies
+// RemovedMethodPolicies 列出支持的策略
+var RemovedMethodPolicies = []RemovedMethodPolicy{
+	RemovedMethodUnexport,
+	RemovedMethodCommentOut,
+	RemovedMethodMoveToFile,
+	RemovedMethodDelete,
+	RemovedMethodKeep,
+}
+
+// handleRemovedMethods handles methods whose proto functions are deleted via removed method policy
+// Returns the service file after changes
+//
+// handleRemovedMethods 按已删除方法策略处理 proto 函数已删除的方法
+// 返回改动后的服务文件
+func (run *syncRun) handleRemovedMethods(change *FileChange, oldFile *ServiceFile, newFile *ServiceFile) (*ServiceFile, error) {
+	removedMethods := searchRemovedMethods(oldFile, newFile)
+	if len(removedMethods) == 0 {
+		return oldFile, nil
+	}
+	policy := run.options.RemovedMethodPolicy
+	if policy == "" {
+		policy = RemovedMethodUnexport
+	}
+	zaplog.LOG.Debug("handle removed methods", zap.String("file", filepath.Base(oldFile.path)), zap.String("policy", string(policy)), zap.Int("count", len(removedMethods)))
+
+	var names []string
+	for _, method := range removedMethods {
+		names = append(names, method.Name.Name)
+	}
+
+	switch policy {
+	case RemovedMethodKeep:
+		return oldFile, nil
+	case RemovedMethodUnexport:
+		unexportedNames, err := run.unexportedNames(oldFile, removedMethods)
+		if err != nil {
+			return nil, err
+		}
+		changedCode, renames := unexportMethods(oldFile, removedMethods, unexportedNames)
+		change.Unexported = append(change.Unexported, renames...)
+		return run.writeStoreFile(oldFile.path, changedCode)
+	case RemovedMethodCommentOut:
+		change.Removed = append(change.Removed, names...)
+		change.RemovedPolicy = policy
+		return run.writeStoreFile(oldFile.path, commentOutMethods(oldFile, removedMethods))
+	case RemovedMethodDelete:
+		changedCode, _ := cutMethods(oldFile, removedMethods)
+		change.Removed = append(change.Removed, names...)
+		change.RemovedPolicy = policy
+		return run.writeStoreFile(oldFile.path, changedCode)
+	case RemovedMethodMoveToFile:
+		changedCode, movedCode := cutMethods(oldFile, removedMethods)
+		deprecatedPath := strings.TrimSuffix(oldFile.path, ".go") + "_deprecated.go"
+		if err := run.appendDeprecatedCode(deprecatedPath, oldFile, removedMethods, movedCode); err != nil {
+			return nil, err
+		}
+		change.Removed = append(change.Removed, names...)
+		change.RemovedPolicy = policy
+		change.MovedTo = run.relPath(deprecatedPath)
+		return run.writeStoreFile(oldFile.path, changedCode)
+	default:
+		return nil, newSyncError(ErrorKindBadOption, "removed-method-policy", erero.Errorf("unknown policy %q", policy))
+	}
+}
+
+// checkRemovedMethodPolicy checks policy is blank (default) or supported
+// checkRemovedMethodPolicy 检查策略为空（默认）或受支持
+func checkRemovedMethodPolicy(policy RemovedMethodPolicy) error {
+	if policy == "" || slices.Contains(RemovedMethodPolicies, policy) {
+		return nil
+	}
+	return newSyncError(ErrorKindBadOption, "removed-method-policy", erero.Errorf("unknown policy %q", policy))
+}
+
+// methodNode returns node of method, starts at doc comment if exists
+// methodNode 返回方法的节点，有文档注释时从注释开始
+func methodNode(method *ast.FuncDecl) *syntaxgo_astnode.Node {
+	node := syntaxgo_astnode.NewNode(method.Pos(), method.End())
+	if method.Doc != nil {
+		checkDocPos(method)
+		node.SetPos(method.Doc.Pos())
+	}
+	return node
+}
+
+// commentOutMethods comments out code of methods, keeps doc comments as they are
+// commentOutMethods 注释掉方法的代码，文档注释保持不变
+func commentOutMethods(oldFile *ServiceFile, methods []*ast.FuncDecl) []byte {
+	edits := make([]*textEdit, 0, len(methods))
+	for _, method := range methods {
+		lines := strings.Split(oldFile.GetNode(method), "\n")
+		for idx, line := range lines {
+			lines[idx] = strings.TrimRight("// "+line, " ")
+		}
+		edits = append(edits, &textEdit{
+			pos:  method.Pos(),
+			end:  method.End(),
+			text: strings.Join(lines, "\n"),
+		})
+	}
+	return applyTextEdits(oldFile.code, edits)
+}
+
+// cutMethods removes methods with doc comments from code
+// Returns changed code and code of removed methods
+//
+// cutMethods 从代码中删除方法及其文档注释
+// 返回改动后的代码和被删除方法的代码
+func cutMethods(oldFile *ServiceFile, methods []*ast.FuncDecl) ([]byte, string) {
+	ptx := printgo.NewPTX()
+	edits := make([]*textEdit, 0, len(methods))
+	for _, method := range methods {
+		node := methodNode(method)
+		ptx.Println(syntaxgo_astnode.GetText(oldFile.code, node))
+		ptx.Println()
+		edits = append(edits, &textEdit{
+			pos:  node.Pos(),
+			end:  node.End(),
+			text: "",
+		})
+	}
+	return applyTextEdits(oldFile.code, edits), ptx.String()
+}
+
+// appendDeprecatedCode appends moved methods into deprecated file behind build tag
+// Creates the file with package clause when missing, then imports packages the methods use
+//
+// appendDeprecatedCode 将移出的方法追加到带构建标签的废弃文件中
+// 文件不存在时创建并写入包声明，然后导入方法用到的包
+func (run *syncRun) appendDeprecatedCode(path string, oldFile *ServiceFile, methods []*ast.FuncDecl, movedCode string) error {
+	var code []byte
+	if run.store.exists(path) {
+		existingCode, err := run.store.read(path)
+		if err != nil {
+			return err
+		}
+		code = existingCode
+	} else {
+		code = []byte("//go:build " + DeprecatedBuildTag + "\n\npackage " + oldFile.astFile.Name.Name + "\n")
+	}
+	code = []byte(string(code) + "\n" + movedCode)
+
+	// Import packages referenced in moved methods, via import names of old file
+	// 按旧文件的导入名称，导入移出方法中引用的包
+	oldImportPaths := importPathMap(oldFile.astFile)
+	imports := make(map[string]string)
+	for _, method := range methods {
+		ast.Inspect(method, func(node ast.Node) bool {
+			if selectorExpr, ok := node.(*ast.SelectorExpr); ok {
+				if ident, ok := selectorExpr.X.(*ast.Ident); ok {
+					if pkgPath, ok := oldImportPaths[ident.Name]; ok {
+						imports[pkgPath] = ident.Name
+					}
+				}
+			}
+			return true
+		})
+	}
+	deprecatedFile, err := parseServiceCode(path, code)
+	if err != nil {
+		return err
+	}
+	for pkgPath := range importNameMap(deprecatedFile.astFile) {
+		delete(imports, pkgPath)
+	}
+	code, err = addNamedImports(code, imports)
+	if err != nil {
+		return newSyncError(ErrorKindParseFailure, path, err)
+	}
+
+	zaplog.LOG.Debug("move removed methods", zap.String("file", filepath.Base(path)), zap.Int("count", len(methods)))
+	if !run.store.exists(path) {
+		run.store.create(path, code)
+		return nil
+	}
+	return run.store.write(path, code)
+}
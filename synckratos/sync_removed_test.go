@@ -0,0 +1,121 @@
+package synckratos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestHandleRemovedMethods tests each removed method policy on a service with a deleted RPC
+// TestHandleRemovedMethods 测试各个已删除方法策略对删除了 RPC 的服务的处理
+func TestHandleRemovedMethods(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_removed_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	oldContent := `package service
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	pb "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
+}
+
+// SayBye says goodbye
+func (s *GreeterService) SayBye(ctx context.Context, req *emptypb.Empty) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+`
+	newContent := `package service
+
+import (
+	"context"
+
+	pb "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return nil, nil
+}
+`
+	servicePath := filepath.Join(tempRoot, "internal/service/greeter.go")
+	must.Done(os.MkdirAll(filepath.Dir(servicePath), 0755))
+	must.Done(os.WriteFile(servicePath, []byte(oldContent), 0644))
+	newFile, err := parseServiceCode("new_greeter.go", []byte(newContent))
+	require.NoError(t, err)
+
+	handle := func(policy RemovedMethodPolicy) (*syncRun, *FileChange, string) {
+		run := newSyncRun(tempRoot, &SyncOptions{DryRun: true, RemovedMethodPolicy: policy})
+		oldFile, err := run.parseStoreFile(servicePath)
+		require.NoError(t, err)
+		change := run.change(filepath.Join(tempRoot, "api/helloworld/v1/greeter.proto"), servicePath)
+		oldFile, err = run.handleRemovedMethods(change, oldFile, newFile)
+		require.NoError(t, err)
+		return run, change, string(oldFile.code)
+	}
+
+	t.Run("unexport", func(t *testing.T) {
+		_, change, code := handle("")
+		require.Equal(t, []*MethodRename{{From: "SayBye", To: "sayBye"}}, change.Unexported)
+		require.Contains(t, code, "func (s *GreeterService) sayBye(")
+	})
+
+	t.Run("comment-out", func(t *testing.T) {
+		_, change, code := handle(RemovedMethodCommentOut)
+		require.Equal(t, []string{"SayBye"}, change.Removed)
+		require.Equal(t, RemovedMethodCommentOut, change.RemovedPolicy)
+		require.Contains(t, code, "// SayBye says goodbye\n// func (s *GreeterService) SayBye(")
+		require.Contains(t, code, "// \treturn &emptypb.Empty{}, nil\n// }")
+		require.NotContains(t, code, `"google.golang.org/protobuf/types/known/emptypb"`)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		_, change, code := handle(RemovedMethodDelete)
+		require.Equal(t, []string{"SayBye"}, change.Removed)
+		require.NotContains(t, code, "SayBye")
+		require.Contains(t, code, "func (s *GreeterService) SayHello(")
+	})
+
+	t.Run("move-to-file", func(t *testing.T) {
+		run, change, code := handle(RemovedMethodMoveToFile)
+		require.Equal(t, []string{"SayBye"}, change.Removed)
+		require.Equal(t, "internal/service/greeter_deprecated.go", change.MovedTo)
+		require.NotContains(t, code, "SayBye")
+
+		deprecatedCode := string(rese.V1(run.store.read(filepath.Join(tempRoot, "internal/service/greeter_deprecated.go"))))
+		t.Log(deprecatedCode)
+		require.Contains(t, deprecatedCode, "//go:build "+DeprecatedBuildTag)
+		require.Contains(t, deprecatedCode, `"google.golang.org/protobuf/types/known/emptypb"`)
+		require.Contains(t, deprecatedCode, "// SayBye says goodbye\nfunc (s *GreeterService) SayBye(")
+	})
+
+	t.Run("keep", func(t *testing.T) {
+		_, change, code := handle(RemovedMethodKeep)
+		require.False(t, change.HasChanges())
+		require.Equal(t, oldContent, code)
+	})
+
+	t.Run("bad-option", func(t *testing.T) {
+		err := checkRemovedMethodPolicy("drop")
+		require.True(t, IsErrorKind(err, ErrorKindBadOption))
+	})
+}
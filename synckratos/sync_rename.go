@@ -0,0 +1,175 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"unicode"
+
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// renameMethods renames existing methods in place when proto RPC is renamed
+// Pairs removed and added methods via explicit renames (old name to new name) first,
+// then via matching param and result types, when the match is unique
+// Keeps method body and doc comment, so business logic follows the new name
+// Returns changed code and renamed methods
+//
+// renameMethods 当 proto RPC 改名时原地重命名现有方法
+// 优先按显式改名（旧名到新名）配对删除和新增的方法，
+// 然后在匹配唯一时按参数和返回值类型配对
+// 保留方法体和文档注释，使业务逻辑跟随新名称
+// 返回改动后的代码和被重命名的方法
+func renameMethods(oldFile *ServiceFile, newFile *ServiceFile, renames map[string]string) ([]byte, []*MethodRename) {
+	rename := importRenameMap(oldFile, newFile)
+
+	var edits []*textEdit
+	var results []*MethodRename
+	for structName, newServiceStruct := range newFile.serviceStructMap {
+		oldServiceStruct := findOldStruct(oldFile, newFile, structName)
+		if oldServiceStruct == nil {
+			continue
+		}
+
+		// Removed: exported old methods not in proto, added: proto methods not in old struct
+		// 删除的：proto 中没有的旧导出方法，新增的：旧 struct 中没有的 proto 方法
+		var removedMethods []*ast.FuncDecl
+		for _, method := range oldServiceStruct.methods {
+			if _, ok := newServiceStruct.methodsMap[method.Name.Name]; !ok && ast.IsExported(method.Name.Name) {
+				removedMethods = append(removedMethods, method)
+			}
+		}
+		var addedMethods []*ast.FuncDecl
+		for _, method := range newServiceStruct.methods {
+			if _, ok := oldServiceStruct.methodsMap[method.Name.Name]; !ok {
+				addedMethods = append(addedMethods, method)
+			}
+		}
+		if len(removedMethods) == 0 || len(addedMethods) == 0 {
+			continue
+		}
+
+		pairs := make(map[*ast.FuncDecl]*ast.FuncDecl) // Old method to new method // 旧方法到新方法
+		paired := make(map[*ast.FuncDecl]bool)         // New methods already paired // 已配对的新方法
+
+		// Pair via explicit renames
+		// 按显式改名配对
+		for _, oldMethod := range removedMethods {
+			newName, ok := renames[oldMethod.Name.Name]
+			if !ok {
+				continue
+			}
+			for _, newMethod := range addedMethods {
+				if newMethod.Name.Name == newName && !paired[newMethod] {
+					pairs[oldMethod] = newMethod
+					paired[newMethod] = true
+					break
+				}
+			}
+		}
+
+		// Pair via types, only when each side has exactly one candidate
+		// 按类型配对，仅当双方都恰好只有一个候选时
+		oldKeys := make(map[*ast.FuncDecl]string, len(removedMethods))
+		oldKeyCounts := make(map[string]int)
+		for _, oldMethod := range removedMethods {
+			if _, ok := pairs[oldMethod]; !ok {
+				oldKeys[oldMethod] = signatureKey(oldFile.code, oldMethod.Type, nil)
+				oldKeyCounts[oldKeys[oldMethod]]++
+			}
+		}
+		newKeys := make(map[*ast.FuncDecl]string, len(addedMethods))
+		newKeyCounts := make(map[string]int)
+		for _, newMethod := range addedMethods {
+			if !paired[newMethod] {
+				newKeys[newMethod] = signatureKey(newFile.code, newMethod.Type, rename)
+				newKeyCounts[newKeys[newMethod]]++
+			}
+		}
+		for _, oldMethod := range removedMethods {
+			key, ok := oldKeys[oldMethod]
+			if !ok || oldKeyCounts[key] != 1 || newKeyCounts[key] != 1 {
+				continue
+			}
+			for _, newMethod := range addedMethods {
+				if newKeys[newMethod] == key && !paired[newMethod] {
+					pairs[oldMethod] = newMethod
+					paired[newMethod] = true
+					break
+				}
+			}
+		}
+
+		// Rename in old method sequence, keeps the result stable
+		// 按旧方法顺序重命名，保持结果稳定
+		for _, oldMethod := range removedMethods {
+			newMethod, ok := pairs[oldMethod]
+			if !ok {
+				continue
+			}
+			oldName := oldMethod.Name.Name
+			newName := newMethod.Name.Name
+			zaplog.LOG.Debug("rename method", zap.String("struct", structName), zap.String("from", oldName), zap.String("to", newName))
+			edits = append(edits, &textEdit{
+				pos:  oldMethod.Name.Pos(),
+				end:  oldMethod.Name.End(),
+				text: newName,
+			})
+			edits = append(edits, renameDocEdits(oldMethod, oldName, newName)...)
+			results = append(results, &MethodRename{From: oldName, To: newName})
+		}
+	}
+	if len(edits) == 0 {
+		return []byte{}, nil
+	}
+	return applyTextEdits(oldFile.code, edits), results
+}
+
+// signatureKey builds text of param and result types, skips param names
+// signatureKey 构建参数和返回值类型的文本，忽略参数名
+func signatureKey(code []byte, funcType *ast.FuncType, rename map[string]string) string {
+	var parts []string
+	for _, fieldList := range []*ast.FieldList{funcType.Params, funcType.Results} {
+		var types []string
+		if fieldList != nil {
+			for _, field := range fieldList.List {
+				typeText := compactText(qualifyExprText(code, field.Type, rename))
+				for idx := 0; idx < max(1, len(field.Names)); idx++ {
+					types = append(types, typeText)
+				}
+			}
+		}
+		parts = append(parts, "("+strings.Join(types, ",")+")")
+	}
+	return strings.Join(parts, "")
+}
+
+// renameDocEdits switches method name at the start of doc comment lines
+// renameDocEdits 替换文档注释行开头的方法名
+func renameDocEdits(method *ast.FuncDecl, oldName string, newName string) []*textEdit {
+	if method.Doc == nil {
+		return nil
+	}
+	var edits []*textEdit
+	for _, comment := range method.Doc.List {
+		text := comment.Text
+		if !strings.HasPrefix(text, "// "+oldName) {
+			continue
+		}
+		// Skip when old name is just a prefix of a longer word
+		// 旧名只是更长单词的前缀时跳过
+		if rest := text[len("// "+oldName):]; rest != "" {
+			if char := rune(rest[0]); unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_' {
+				continue
+			}
+		}
+		pos := comment.Pos() + 3
+		edits = append(edits, &textEdit{
+			pos:  pos,
+			end:  pos + token.Pos(len(oldName)),
+			text: newName,
+		})
+	}
+	return edits
+}
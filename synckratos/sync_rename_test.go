@@ -0,0 +1,84 @@
+package synckratos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenameMethods tests renaming methods in place via matching types and explicit renames
+// TestRenameMethods 测试按类型匹配和显式改名原地重命名方法
+func TestRenameMethods(t *testing.T) {
+	oldContent := `package service
+
+import (
+	"context"
+
+	pb "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	pb.UnimplementedGreeterServer
+}
+
+// SayHello greets the caller
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
+}
+
+func (s *GreeterService) GetA(ctx context.Context, req *pb.Empty) (*pb.Empty, error) {
+	return &pb.Empty{}, nil
+}
+
+func (s *GreeterService) GetB(ctx context.Context, req *pb.Empty) (*pb.Empty, error) {
+	return &pb.Empty{}, nil
+}
+`
+	newContent := `package service
+
+import (
+	"context"
+
+	v1 "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	v1.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) Greet(ctx context.Context, in *v1.HelloRequest) (*v1.HelloReply, error) {
+	return nil, nil
+}
+
+func (s *GreeterService) GetX(ctx context.Context, in *v1.Empty) (*v1.Empty, error) {
+	return nil, nil
+}
+
+func (s *GreeterService) GetY(ctx context.Context, in *v1.Empty) (*v1.Empty, error) {
+	return nil, nil
+}
+`
+	oldFile, err := parseServiceCode("old_greeter.go", []byte(oldContent))
+	require.NoError(t, err)
+	newFile, err := parseServiceCode("new_greeter.go", []byte(newContent))
+	require.NoError(t, err)
+
+	// SayHello pairs with Greet via types, GetA/GetB are ambiguous and stay
+	// SayHello 按类型与 Greet 配对，GetA/GetB 有歧义保持不变
+	changedCode, renames := renameMethods(oldFile, newFile, nil)
+	require.Equal(t, []*MethodRename{{From: "SayHello", To: "Greet"}}, renames)
+	result := string(changedCode)
+	t.Log(result)
+	require.Contains(t, result, "// Greet greets the caller")
+	require.Contains(t, result, "func (s *GreeterService) Greet(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {\n\treturn &pb.HelloReply{Message: req.Name}, nil")
+	require.Contains(t, result, "func (s *GreeterService) GetA(")
+
+	// Explicit renames resolve the ambiguous ones
+	// 显式改名解决有歧义的方法
+	changedCode, renames = renameMethods(oldFile, newFile, map[string]string{"GetA": "GetY", "GetB": "GetX"})
+	require.Equal(t, []*MethodRename{{From: "SayHello", To: "Greet"}, {From: "GetA", To: "GetY"}, {From: "GetB", To: "GetX"}}, renames)
+	result = string(changedCode)
+	require.Contains(t, result, "func (s *GreeterService) GetY(")
+	require.Contains(t, result, "func (s *GreeterService) GetX(")
+	require.NotContains(t, result, "GetA")
+}
@@ -0,0 +1,506 @@
+package synckratos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/eroticgo"
+)
+
+// MatchedBy tells how a service file is matched with regenerated service code
+// MatchedBy 表示服务文件与重新生成的服务代码的匹配方式
+type MatchedBy string
+
+const (
+	MatchedByMaskType MatchedBy = "mask-type" // Matched via embedded Unimplemented*Server type // 按嵌入的 Unimplemented*Server 类型匹配
+	MatchedByFilename MatchedBy = "filename"  // Matched via service filename // 按服务文件名匹配
+)
+
+// SyncReport describes what one sync run changed, grouped by proto
+// SyncReport 描述一次同步过程所做的变更，按 proto 分组
+type SyncReport struct {
+	DryRun  bool            `json:"dry_run"` // Changes are planned, not written // 变更只是计划，未写入
+	Protos  []*ProtoReport  `json:"protos"`  // Protos in processing sequence // 按处理顺序排列的 proto
+	Servers []*ServerChange `json:"servers"` // Server files with registrations changed or stale // 注册有变更或已过时的服务器文件
+
+	Layers    []*LayerChange  `json:"layers"`    // Layers scaffolded for new services // 为新服务生成的分层代码
+	Providers *ProviderChange `json:"providers"` // Wire ProviderSet changed or stale, nil when neither // Wire ProviderSet 有变更或已过时，都没有时为 nil
+	WireGen   bool            `json:"wire_gen"`  // Wire providers changed, "wire gen" needs rerunning // Wire 提供者有变更，需要重新运行 "wire gen"
+}
+
+// ProtoReport describes service files synced with one proto
+// ProtoReport 描述与单个 proto 同步的服务文件
+type ProtoReport struct {
+	Path     string        `json:"path"`     // Proto path relative to project root // 相对于项目根 DIR 的 proto 路径
+	Services []string      `json:"services"` // Services defined in proto // proto 中定义的服务
+	Files    []*FileChange `json:"files"`    // Service files created or matched // 新建或匹配到的服务文件
+}
+
+// MethodRename records an existing method renamed in place, to follow proto RPC rename or to unexport
+// MethodRename 记录原地重命名的现有方法，用于跟随 proto RPC 改名或转为非导出
+type MethodRename struct {
+	From string `json:"from"` // Method name before rename // 改名前的方法名
+	To   string `json:"to"`   // Method name after rename // 改名后的方法名
+}
+
+// MethodSwitch records a method whose RPC switched between unary and streaming kinds
+// The method is marked with a TODO comment and needs manual migration
+//
+// MethodSwitch 记录 RPC 在一元和流式类型之间切换的方法
+// 该方法会被标记 TODO 注释，需要手动迁移
+type MethodSwitch struct {
+	Name string `json:"name"` // Method name // 方法名
+	From string `json:"from"` // RPC kind of existing method, e.g. "unary" // 现有方法的 RPC 类型，例如 "unary"
+	To   string `json:"to"`   // RPC kind in proto, e.g. "bidi-streaming" // proto 中的 RPC 类型，例如 "bidi-streaming"
+}
+
+// FileChange records the sync steps applied to one service file
+// FileChange 记录应用到单个服务文件的同步步骤
+type FileChange struct {
+	Path          string              `json:"path"`                     // Service file path relative to project root // 相对于项目根 DIR 的服务文件路径
+	MatchedBy     MatchedBy           `json:"matched_by,omitempty"`     // How the file is matched, blank when just created // 文件的匹配方式，仅新建时为空
+	Created       bool                `json:"created"`                  // File created in sync from proto // 文件在同步中根据 proto 新建
+	Renamed       []*MethodRename     `json:"renamed"`                  // Methods renamed in place // 原地重命名的方法
+	Added         []string            `json:"added"`                    // Added method names // 新增的方法名
+	Signatures    []string            `json:"signatures"`               // Method names with rewritten signatures // 签名被重写的方法名
+	Switched      []*MethodSwitch     `json:"switched"`                 // Methods needing manual migration after RPC kind switch // RPC 类型切换后需要手动迁移的方法
+	Unexported    []*MethodRename     `json:"unexported"`               // Unexported methods, with suffixed names on collision // 被非导出的方法，冲突时使用带后缀的名称
+	Removed       []string            `json:"removed"`                  // Removed method names, handled via RemovedPolicy // 按 RemovedPolicy 处理的已删除方法名
+	RemovedPolicy RemovedMethodPolicy `json:"removed_policy,omitempty"` // Policy applied to Removed // 应用于 Removed 的策略
+	MovedTo       string              `json:"moved_to,omitempty"`       // File holding moved methods, relative to project root // 存放移出方法的文件，相对于项目根 DIR
+	Reordered     bool                `json:"reordered"`                // Methods reordered to match proto // 方法已按 proto 重新排序
+	Tests         []string            `json:"tests"`                    // Test skeletons added to <service>_test.go // 添加到 <service>_test.go 的测试骨架
+	TestRenames   []*MethodRename     `json:"test_renames"`             // Tests renamed with their methods // 随方法重命名的测试
+}
+
+// HasChanges checks if the file is created or modified
+// HasChanges 检查文件是否被新建或修改
+func (change *FileChange) HasChanges() bool {
+	return change.Created || len(change.Renamed) > 0 || len(change.Added) > 0 || len(change.Signatures) > 0 || len(change.Switched) > 0 || len(change.Unexported) > 0 || len(change.Removed) > 0 || change.Reordered || len(change.Tests) > 0 || len(change.TestRenames) > 0
+}
+
+// HasChanges checks if any service file is created or modified, any server file registers services, or ProviderSet changes
+// Lets CI fail when proto changes land without their service changes
+//
+// HasChanges 检查是否有服务文件被新建或修改、有服务器文件注册了服务，或 ProviderSet 有变更
+// 让 CI 在 proto 变更未附带服务变更时失败
+func (report *SyncReport) HasChanges() bool {
+	for _, proto := range report.Protos {
+		for _, change := range proto.Files {
+			if change.HasChanges() {
+				return true
+			}
+		}
+	}
+	for _, server := range report.Servers {
+		if len(server.Registered) > 0 {
+			return true
+		}
+	}
+	if providers := report.Providers; providers != nil && (len(providers.Added) > 0 || len(providers.Removed) > 0) {
+		return true
+	}
+	for _, layer := range report.Layers {
+		if len(layer.Created) > 0 || layer.Injected || len(layer.Providers) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes report as indented JSON
+// WriteJSON 将报告写为缩进的 JSON
+func (report *SyncReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(report); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// WriteText writes what the sync renamed, added, rewrote, removed and reordered per proto and file
+// WriteText 按 proto 和文件写出同步重命名、新增、重写、删除和重新排序的内容
+func (report *SyncReport) WriteText(w io.Writer) {
+	prefix := "synced"
+	if report.DryRun {
+		prefix = "dry-run"
+	}
+	if !report.HasChanges() {
+		_, _ = fmt.Fprintln(w, prefix+": no changes")
+		report.writeWiring(w, prefix)
+		return
+	}
+	defer report.writeWiring(w, prefix)
+	for _, proto := range report.Protos {
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(prefix+": "+proto.Path))
+		for _, change := range proto.Files {
+			if !change.HasChanges() {
+				continue
+			}
+			_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint("  "+change.Path))
+			if change.Created {
+				_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    create file"))
+			}
+			for _, item := range change.Renamed {
+				_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    rename method: "+item.From+" -> "+item.To))
+			}
+			for _, name := range change.Added {
+				_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    add method: "+name))
+			}
+			for _, name := range change.Signatures {
+				_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint("    update signature: "+name))
+			}
+			for _, item := range change.Switched {
+				_, _ = fmt.Fprintln(w, eroticgo.RED.Sprint("    migrate by hand: "+item.Name+" ("+item.From+" -> "+item.To+")"))
+			}
+			for _, item := range change.Unexported {
+				_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint("    unexport method: "+item.From+" -> "+item.To))
+			}
+			for _, name := range change.Removed {
+				switch change.RemovedPolicy {
+				case RemovedMethodCommentOut:
+					_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint("    comment out method: "+name))
+				case RemovedMethodMoveToFile:
+					_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint("    move method: "+name+" -> "+change.MovedTo))
+				default:
+					_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint("    delete method: "+name))
+				}
+			}
+			if change.Reordered {
+				_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint("    reorder methods"))
+			}
+			for _, name := range change.Tests {
+				_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    add test: "+name))
+			}
+			for _, item := range change.TestRenames {
+				_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint("    rename test: "+item.From+" -> "+item.To))
+			}
+		}
+	}
+}
+
+// writeWiring writes scaffolded layers, registered and stale services per server file, then ProviderSet changes and wire gen hint
+// writeWiring 写出生成的分层代码、按服务器文件写出已注册和已过时的服务，然后写出 ProviderSet 变更和 wire gen 提示
+func (report *SyncReport) writeWiring(w io.Writer, prefix string) {
+	for _, layer := range report.Layers {
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(prefix+": layers of "+layer.Service))
+		for _, path := range layer.Created {
+			_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    create file: "+path))
+		}
+		if layer.Injected {
+			_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    inject usecase: "+layer.Service+"Usecase"))
+		}
+		for _, name := range layer.Providers {
+			_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    add provider: "+name))
+		}
+	}
+	for _, server := range report.Servers {
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(prefix+": "+server.Path))
+		for _, name := range server.Registered {
+			_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    register service: "+name))
+		}
+		for _, name := range server.Stale {
+			_, _ = fmt.Fprintln(w, eroticgo.RED.Sprint("    stale registration: "+name+" (not in any proto)"))
+		}
+	}
+	if providers := report.Providers; providers != nil {
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(prefix+": "+providers.Path))
+		for _, name := range providers.Added {
+			_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("    add provider: "+name))
+		}
+		for _, name := range providers.Removed {
+			_, _ = fmt.Fprintln(w, eroticgo.RED.Sprint("    remove provider: "+name))
+		}
+		for _, name := range providers.Stale {
+			_, _ = fmt.Fprintln(w, eroticgo.RED.Sprint("    stale provider: "+name+" (not in any proto)"))
+		}
+	}
+	if report.WireGen {
+		_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint(prefix+": rerun wire gen to refresh wire_gen.go"))
+	}
+}
+
+// WriteSummary writes one line per changed service file, used in watch mode
+// WriteSummary 为每个变更的服务文件写出一行，用于 watch 模式
+func (report *SyncReport) WriteSummary(w io.Writer) {
+	prefix := "synced"
+	if report.DryRun {
+		prefix = "dry-run"
+	}
+	for _, proto := range report.Protos {
+		if !slices.ContainsFunc(proto.Files, (*FileChange).HasChanges) {
+			_, _ = fmt.Fprintln(w, prefix+": "+proto.Path+": no changes")
+			continue
+		}
+		for _, change := range proto.Files {
+			if !change.HasChanges() {
+				continue
+			}
+			_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(prefix+": "+change.Path+": "+strings.Join(change.summaryParts(), ", ")))
+		}
+	}
+	for _, server := range report.Servers {
+		var parts []string
+		if len(server.Registered) > 0 {
+			parts = append(parts, "registered "+strings.Join(server.Registered, " "))
+		}
+		if len(server.Stale) > 0 {
+			parts = append(parts, "stale "+strings.Join(server.Stale, " "))
+		}
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(prefix+": "+server.Path+": "+strings.Join(parts, ", ")))
+	}
+	for _, layer := range report.Layers {
+		var parts []string
+		if len(layer.Created) > 0 {
+			parts = append(parts, "created "+strings.Join(layer.Created, " "))
+		}
+		if layer.Injected {
+			parts = append(parts, "injected "+layer.Service+"Usecase")
+		}
+		if len(layer.Providers) > 0 {
+			parts = append(parts, "providers "+strings.Join(layer.Providers, " "))
+		}
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(prefix+": layers of "+layer.Service+": "+strings.Join(parts, ", ")))
+	}
+	if providers := report.Providers; providers != nil {
+		var parts []string
+		if len(providers.Added) > 0 {
+			parts = append(parts, "added "+strings.Join(providers.Added, " "))
+		}
+		if len(providers.Removed) > 0 {
+			parts = append(parts, "removed "+strings.Join(providers.Removed, " "))
+		}
+		if len(providers.Stale) > 0 {
+			parts = append(parts, "stale "+strings.Join(providers.Stale, " "))
+		}
+		_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(prefix+": "+providers.Path+": "+strings.Join(parts, ", ")))
+	}
+	if report.WireGen {
+		_, _ = fmt.Fprintln(w, eroticgo.YELLOW.Sprint(prefix+": rerun wire gen"))
+	}
+}
+
+// summaryParts returns short descriptions of each sync step applied to file
+// summaryParts 返回应用到文件的各同步步骤的简短描述
+func (change *FileChange) summaryParts() []string {
+	var parts []string
+	if change.Created {
+		parts = append(parts, "created")
+	}
+	if len(change.Renamed) > 0 {
+		parts = append(parts, "renamed "+joinRenames(change.Renamed))
+	}
+	if len(change.Added) > 0 {
+		parts = append(parts, "added "+strings.Join(change.Added, " "))
+	}
+	if len(change.Signatures) > 0 {
+		parts = append(parts, "updated "+strings.Join(change.Signatures, " "))
+	}
+	if len(change.Switched) > 0 {
+		items := make([]string, 0, len(change.Switched))
+		for _, item := range change.Switched {
+			items = append(items, item.Name+"("+item.From+"->"+item.To+")")
+		}
+		parts = append(parts, "migrate by hand "+strings.Join(items, " "))
+	}
+	if len(change.Unexported) > 0 {
+		parts = append(parts, "unexported "+joinRenames(change.Unexported))
+	}
+	if len(change.Removed) > 0 {
+		parts = append(parts, string(change.RemovedPolicy)+" "+strings.Join(change.Removed, " "))
+	}
+	if change.Reordered {
+		parts = append(parts, "reordered")
+	}
+	if len(change.Tests) > 0 {
+		parts = append(parts, "tests "+strings.Join(change.Tests, " "))
+	}
+	if len(change.TestRenames) > 0 {
+		parts = append(parts, "renamed tests "+joinRenames(change.TestRenames))
+	}
+	return parts
+}
+
+// joinRenames joins renames as "From->To" items
+// joinRenames 将重命名拼接为 "From->To" 形式
+func joinRenames(renames []*MethodRename) string {
+	items := make([]string, 0, len(renames))
+	for _, item := range renames {
+		items = append(items, item.From+"->"+item.To)
+	}
+	return strings.Join(items, " ")
+}
+
+// syncRun holds state shared across the steps of one sync run
+// syncRun 保存一次同步过程中各步骤共享的状态
+type syncRun struct {
+	projectRoot   string                // Project root path // 项目根路径
+	options       *SyncOptions          // Sync options // 同步选项
+	store         *codeStore            // Service file contents // 服务文件内容
+	report        *SyncReport           // Changes of this run // 本次同步的变更
+	stagingProtos map[string]string     // Staging file path via stagingKey to proto path map // 通过 stagingKey 得到的暂存文件路径到 proto 路径的映射
+	stagingDirs   map[string]string     // Proto path to its staging sub DIR map // proto 路径到其暂存子 DIR 的映射
+	protoFiles    map[string]*protoFile // Proto path to parsed proto // proto 路径到已解析 proto 的映射
+	protoServices map[string]bool       // Services defined in walked protos, ignored ones included // 遍历到的 proto 中定义的服务，包括被忽略的 proto
+	includeRoots  []string              // DIRs of ProtoIncludes // ProtoIncludes 对应的 DIR
+	resolver      *protoResolver        // Resolves imports of protos // 解析 proto 的导入
+}
+
+// newSyncRun creates a syncRun with empty store and report
+// newSyncRun 创建带有空存储和空报告的 syncRun
+func newSyncRun(projectRoot string, options *SyncOptions) *syncRun {
+	return &syncRun{
+		projectRoot:   projectRoot,
+		options:       options,
+		store:         newCodeStore(),
+		report:        &SyncReport{DryRun: options.DryRun, Protos: []*ProtoReport{}, Servers: []*ServerChange{}, Layers: []*LayerChange{}},
+		stagingProtos: make(map[string]string),
+		stagingDirs:   make(map[string]string),
+		protoFiles:    make(map[string]*protoFile),
+		protoServices: make(map[string]bool),
+		resolver:      newProtoResolver(protoImportRoots(projectRoot, options, nil)),
+	}
+}
+
+// relPath converts path to slash path relative to project root
+// relPath 将路径转换为相对于项目根 DIR 的斜杠路径
+func (run *syncRun) relPath(path string) string {
+	if rel, err := filepath.Rel(run.projectRoot, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+// stagingDir returns the staging sub DIR of proto, picks the next number on first call
+// Each proto generates into its own sub DIR, so services of the same name in different protos do not collide
+//
+// stagingDir 返回 proto 的暂存子 DIR，首次调用时选择下一个编号
+// 每个 proto 生成到各自的子 DIR 中，使不同 proto 中同名的服务不会冲突
+func (run *syncRun) stagingDir(protoPath string) string {
+	if dir, ok := run.stagingDirs[protoPath]; ok {
+		return dir
+	}
+	dir := strconv.Itoa(len(run.stagingDirs) + 1)
+	run.stagingDirs[protoPath] = dir
+	return dir
+}
+
+// stagingKey returns staging file path of service in proto, relative to staging DIR, e.g. "2/user.go"
+// Staging file is named via lowercase service name, same as kratos
+//
+// stagingKey 返回 proto 中服务的暂存文件路径，相对于暂存 DIR，例如 "2/user.go"
+// 暂存文件名与 kratos 一致为小写服务名
+func (run *syncRun) stagingKey(protoPath string, serviceName string) string {
+	return run.stagingDir(protoPath) + "/" + strings.ToLower(serviceName) + ".go"
+}
+
+// stagingProto returns proto path of staging file under staging DIR, false when no service is recorded
+// stagingProto 返回暂存 DIR 下暂存文件对应的 proto 路径，没有记录服务时返回 false
+func (run *syncRun) stagingProto(stagingRoot string, path string) (string, bool) {
+	rel, err := filepath.Rel(stagingRoot, path)
+	if err != nil {
+		return "", false
+	}
+	protoPath, ok := run.stagingProtos[filepath.ToSlash(rel)]
+	return protoPath, ok
+}
+
+// protoReport returns the report of proto, creates it on first call
+// protoReport 返回 proto 的报告，首次调用时创建
+func (run *syncRun) protoReport(protoPath string) *ProtoReport {
+	path := run.relPath(protoPath)
+	for _, proto := range run.report.Protos {
+		if proto.Path == path {
+			return proto
+		}
+	}
+	proto := &ProtoReport{Path: path, Services: []string{}, Files: []*FileChange{}}
+	run.report.Protos = append(run.report.Protos, proto)
+	return proto
+}
+
+// change returns the change record of file synced with proto, creates it on first call
+// change 返回与 proto 同步的文件的变更记录，首次调用时创建
+func (run *syncRun) change(protoPath string, path string) *FileChange {
+	proto := run.protoReport(protoPath)
+	path = run.relPath(path)
+	for _, change := range proto.Files {
+		if change.Path == path {
+			return change
+		}
+	}
+	change := &FileChange{Path: path, Renamed: []*MethodRename{}, Added: []string{}, Signatures: []string{}, Switched: []*MethodSwitch{}, Unexported: []*MethodRename{}, Removed: []string{}, Tests: []string{}, TestRenames: []*MethodRename{}}
+	proto.Files = append(proto.Files, change)
+	return change
+}
+
+// finish writes changes to disk, skips writing in dry-run mode
+// Verifies changed files and writes unified diff first when diff output is set,
+// snapshots the files into BackupRoot before writing, drops the snapshot when writing fails,
+// prunes snapshots beyond KeepBackups after writing
+//
+// finish 将变更写入磁盘，dry-run 模式下跳过写入
+// 先校验有改动的文件，设置了 diff 输出时先写出统一 diff，
+// 写入前将文件快照到 BackupRoot，写入失败时丢弃该快照，
+// 写入后清理超出 KeepBackups 的快照
+func (run *syncRun) finish() error {
+	if err := run.store.verify(); err != nil {
+		return err
+	}
+	if run.options.DiffOutput != nil {
+		if err := writeUnifiedDiff(run.options.DiffOutput, resolveRoot(run.projectRoot, run.options.DiffRoot, "."), run.store.changedFiles()); err != nil {
+			return newSyncError(ErrorKindWriteFailure, "diff-output", err)
+		}
+	}
+	if run.options.DryRun {
+		return nil
+	}
+	manifest, err := run.backup()
+	if err != nil {
+		return err
+	}
+	if err := run.store.flush(); err != nil {
+		if manifest != nil {
+			removeBackup(run.projectRoot, manifest)
+		}
+		return err
+	}
+	if manifest != nil && run.options.KeepBackups > 0 {
+		pruneBackups(run.projectRoot, run.options.KeepBackups)
+	}
+	return nil
+}
+
+// messageOutput returns where to print messages
+// Uses stderr when diff goes to stdout, keeps diff clean to pipe into git apply
+//
+// messageOutput 返回打印消息的位置
+// diff 输出到 stdout 时使用 stderr，使 diff 可以直接通过管道传给 git apply
+func messageOutput(options *SyncOptions) io.Writer {
+	if options.DiffOutput == os.Stdout {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// showResult prints planned changes in dry-run mode, then success message
+// showResult 在 dry-run 模式下打印计划的变更，然后打印成功消息
+func showResult(report *SyncReport, options *SyncOptions) {
+	w := messageOutput(options)
+	if report.DryRun {
+		report.WriteText(w)
+	}
+	if w != os.Stdout {
+		_, _ = fmt.Fprintln(w, eroticgo.GREEN.Sprint("SUCCESS"))
+		return
+	}
+	eroticgo.GREEN.ShowMessage("SUCCESS")
+}
@@ -0,0 +1,44 @@
+package synckratos
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSyncReport tests change detection and JSON output of report
+// TestSyncReport 测试报告的变更检测和 JSON 输出
+func TestSyncReport(t *testing.T) {
+	run := newSyncRun("/demo", &SyncOptions{MaskMode: true})
+	proto := run.protoReport("/demo/api/helloworld/v1/greeter.proto")
+	proto.Services = append(proto.Services, "Greeter")
+
+	change := run.change("/demo/api/helloworld/v1/greeter.proto", "/demo/internal/service/greeter.go")
+	change.MatchedBy = MatchedByMaskType
+	require.False(t, run.report.HasChanges())
+
+	// Same proto and path returns same record
+	// 相同的 proto 和路径返回同一记录
+	run.change("/demo/api/helloworld/v1/greeter.proto", "/demo/internal/service/greeter.go").Added = []string{"SayWorld"}
+	require.True(t, run.report.HasChanges())
+
+	var buffer bytes.Buffer
+	require.NoError(t, run.report.WriteJSON(&buffer))
+	t.Log(buffer.String())
+
+	var report SyncReport
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &report))
+	require.Len(t, report.Protos, 1)
+	require.Equal(t, "api/helloworld/v1/greeter.proto", report.Protos[0].Path)
+	require.Equal(t, []string{"Greeter"}, report.Protos[0].Services)
+	require.Len(t, report.Protos[0].Files, 1)
+	require.Equal(t, "internal/service/greeter.go", report.Protos[0].Files[0].Path)
+	require.Equal(t, MatchedByMaskType, report.Protos[0].Files[0].MatchedBy)
+	require.Equal(t, []string{"SayWorld"}, report.Protos[0].Files[0].Added)
+
+	buffer.Reset()
+	run.report.WriteSummary(&buffer)
+	require.Contains(t, buffer.String(), "synced: internal/service/greeter.go: added SayWorld")
+}
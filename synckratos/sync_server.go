@@ -0,0 +1,368 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/orzkratos/orzkratos/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexistpath/ossoftexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+	"golang.org/x/mod/modfile"
+)
+
+// ServerChange records service registrations of one server file, e.g. internal/server/grpc.go
+// ServerChange 记录单个服务器文件中的服务注册，例如 internal/server/grpc.go
+type ServerChange struct {
+	Path       string   `json:"path"`       // Server file path relative to project root // 相对于项目根 DIR 的服务器文件路径
+	Registered []string `json:"registered"` // Services registered in this sync // 本次同步注册的服务
+	Stale      []string `json:"stale"`      // Registered services defined in no proto // 没有 proto 定义的已注册服务
+}
+
+// serverConstructors maps Kratos server constructor to suffix of register functions it calls
+// e.g. NewGRPCServer calls v1.RegisterGreeterServer, NewHTTPServer calls v1.RegisterGreeterHTTPServer
+//
+// serverConstructors 将 Kratos 服务器构造函数映射到其调用的注册函数的后缀
+// 例如 NewGRPCServer 调用 v1.RegisterGreeterServer，NewHTTPServer 调用 v1.RegisterGreeterHTTPServer
+var serverConstructors = map[string]string{
+	"NewGRPCServer": "Server",
+	"NewHTTPServer": "HTTPServer",
+}
+
+// createdService is a service created in this sync, to register in server constructors and scaffold layers
+// createdService 是本次同步新建的服务，需要注册到服务器构造函数并生成分层代码
+type createdService struct {
+	path       string // Service file path // 服务文件路径
+	name       string // Service name, e.g. "User" // 服务名，例如 "User"
+	structName string // Service struct name, e.g. "UserService" // 服务 struct 名，例如 "UserService"
+	pbPath     string // Go import path of proto // proto 的 Go 导入路径
+	protoPkg   string // Proto package, gives the import name when taken // proto 包名，导入名称被占用时用于生成导入名称
+	http       bool   // Proto has google.api.http rules in service // proto 中该服务带有 google.api.http 规则
+}
+
+// registerServices registers services created in this sync in server constructors of server DIR
+// Adds constructor param and register call, HTTP ones only when the service has google.api.http rules
+// With checkStale, records registrations of project services defined in no proto, without changing them
+// Skips when server DIR does not exist
+//
+// registerServices 将本次同步新建的服务注册到服务器 DIR 中的服务器构造函数
+// 添加构造函数参数和注册调用，只有服务带有 google.api.http 规则时才注册 HTTP
+// 设置 checkStale 时，记录没有 proto 定义的项目服务的注册，但不修改它们
+// 服务器 DIR 不存在时跳过
+func (run *syncRun) registerServices(checkStale bool) error {
+	serverRoot := run.options.serverRoot(run.projectRoot)
+	if !ossoftexist.IsRoot(serverRoot) {
+		zaplog.LOG.Debug("server DIR not found, skip registering services", zap.String("root", serverRoot))
+		return nil
+	}
+	services, err := run.createdServices()
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 && !checkStale {
+		return nil
+	}
+	servicePkgPath, err := goPackagePath(run.options.serviceRoot(run.projectRoot))
+	if err != nil {
+		return err
+	}
+	var knownServices map[string]bool
+	if checkStale {
+		knownServices = run.protoServices
+	}
+	return utils.WalkFiles(serverRoot, utils.NewSuffixPattern([]string{".go"}), func(path string, info os.FileInfo) error {
+		if strings.HasSuffix(info.Name(), "_test.go") {
+			return nil
+		}
+		code, err := run.store.read(path)
+		if err != nil {
+			return err
+		}
+		newCode, registered, stale, err := registerServerCode(code, services, servicePkgPath, knownServices)
+		if err != nil {
+			return newSyncError(ErrorKindParseFailure, path, err)
+		}
+		if len(registered) > 0 {
+			if err := run.store.write(path, newCode); err != nil {
+				return err
+			}
+			run.report.WireGen = true
+			zaplog.LOG.Debug("registered services", zap.String("file", info.Name()), zap.Strings("services", registered))
+		}
+		if len(registered) > 0 || len(stale) > 0 {
+			run.report.Servers = append(run.report.Servers, &ServerChange{Path: run.relPath(path), Registered: registered, Stale: stale})
+		}
+		return nil
+	})
+}
+
+// recordIgnoredServices records services of ignored proto, so their registrations are not stale
+// Parse failures are logged and skipped, ignored protos may be broken
+//
+// recordIgnoredServices 记录被忽略的 proto 中的服务，使其注册不被视为过时
+// 解析失败时记录日志并跳过，被忽略的 proto 可能是损坏的
+func (run *syncRun) recordIgnoredServices(protoPath string) {
+	protoFile, err := parseProtoPath(protoPath)
+	if err != nil {
+		zaplog.LOG.Debug("ignored proto not parsed", zap.String("proto", protoPath), zap.Error(err))
+		return
+	}
+	for _, service := range protoFile.services {
+		run.protoServices[goCamelCase(service.name)] = true
+	}
+}
+
+// createdServices returns services of service files created in this sync, in report sequence
+// createdServices 按报告顺序返回本次同步新建的服务文件中的服务
+func (run *syncRun) createdServices() ([]*createdService, error) {
+	var services []*createdService
+	for _, proto := range run.report.Protos {
+		// Services are looked up in the proto of the report, since protos may define services of the same name
+		// 在报告对应的 proto 中查找服务，因为不同 proto 可能定义同名的服务
+		var protoFile *protoFile
+		for protoPath, file := range run.protoFiles {
+			if run.relPath(protoPath) == proto.Path {
+				protoFile = file
+			}
+		}
+		if protoFile == nil {
+			continue
+		}
+		for _, change := range proto.Files {
+			if !change.Created {
+				continue
+			}
+			servicePath := filepath.Join(run.projectRoot, filepath.FromSlash(change.Path))
+			svcFile, err := run.parseStoreFile(servicePath)
+			if err != nil {
+				return nil, err
+			}
+			maskMap := buildStructMaskMap(svcFile)
+			for _, decl := range svcFile.astFile.Decls {
+				genDecl, ok := decl.(*ast.GenDecl)
+				if !ok || genDecl.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range genDecl.Specs {
+					structName := spec.(*ast.TypeSpec).Name.Name
+					maskType, ok := maskMap[structName]
+					if !ok {
+						continue
+					}
+					serviceName := strings.TrimSuffix(strings.TrimPrefix(maskType, "Unimplemented"), "Server")
+					for _, protoService := range protoFile.services {
+						if goCamelCase(protoService.name) == serviceName {
+							services = append(services, &createdService{path: servicePath, name: serviceName, structName: structName, pbPath: protoFile.goImportPath(), protoPkg: protoFile.pkg, http: protoService.hasHTTP()})
+						}
+					}
+				}
+			}
+		}
+	}
+	return services, nil
+}
+
+// registerServerCode adds services into server constructors of code, see registerServices
+// knownServices is nil when stale registrations are not checked
+// Returns changed code, registered services and stale services
+//
+// registerServerCode 将服务添加到代码中的服务器构造函数，参见 registerServices
+// 不检查过时的注册时 knownServices 为 nil
+// 返回改动后的代码、已注册的服务和过时的服务
+func registerServerCode(code []byte, services []*createdService, servicePkgPath string, knownServices map[string]bool) ([]byte, []string, []string, error) {
+	astFile, err := parser.ParseFile(token.NewFileSet(), "", code, parser.ParseComments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	existingNames := importNameMap(astFile) // Import path to import name // 导入路径到导入名称的映射
+	takenNames := importPathMap(astFile)    // Import name to import path // 导入名称到导入路径的映射
+	imports := make(map[string]string)      // Import path to import name of added imports // 新增导入的路径到名称的映射
+	importAs := func(importPath string, pkgName string, baseName string) string {
+		if name, ok := existingNames[importPath]; ok {
+			return name
+		}
+		if name, ok := imports[importPath]; ok {
+			return name
+		}
+		name := pickImportName(takenNames, pkgName, baseName)
+		takenNames[name] = importPath
+		imports[importPath] = name
+		return name
+	}
+	servicePkgName, ok := existingNames[servicePkgPath]
+	if !ok {
+		servicePkgName = path.Base(servicePkgPath)
+	}
+
+	var edits []*textEdit
+	registered := []string{}
+	stale := []string{}
+	for _, decl := range astFile.Decls {
+		function, ok := decl.(*ast.FuncDecl)
+		if !ok || function.Recv != nil || function.Body == nil {
+			continue
+		}
+		suffix, ok := serverConstructors[function.Name.Name]
+		if !ok {
+			continue
+		}
+		registerPattern := regexp.MustCompile(`^Register(\w+)` + suffix + `$`)
+
+		// Params: name of each service param via its type, and names taken
+		// 参数：按类型记录每个服务参数的名称，以及已占用的名称
+		paramNames := make(map[string]bool)
+		paramTypes := make(map[string]string) // Param name to type text // 参数名到类型文本的映射
+		var loggerParam *ast.Field
+		for _, field := range function.Type.Params.List {
+			typeText := getTypeName(code, field.Type)
+			if typeText == "log.Logger" && loggerParam == nil {
+				loggerParam = field
+			}
+			for _, name := range field.Names {
+				paramNames[name.Name] = true
+				paramTypes[name.Name] = typeText
+			}
+		}
+
+		// Register calls at top level of body, e.g. v1.RegisterGreeterServer(srv, greeter)
+		// 方法体顶层的注册调用，例如 v1.RegisterGreeterServer(srv, greeter)
+		registeredSet := make(map[string]bool)
+		var lastRegister *ast.ExprStmt
+		var returnStmt *ast.ReturnStmt
+		for _, stmt := range function.Body.List {
+			switch stmt := stmt.(type) {
+			case *ast.ReturnStmt:
+				returnStmt = stmt
+			case *ast.ExprStmt:
+				callExpr, ok := stmt.X.(*ast.CallExpr)
+				if !ok {
+					continue
+				}
+				selectorExpr, ok := callExpr.Fun.(*ast.SelectorExpr)
+				if !ok {
+					continue
+				}
+				match := registerPattern.FindStringSubmatch(selectorExpr.Sel.Name)
+				if match == nil {
+					continue
+				}
+				registeredSet[match[1]] = true
+				lastRegister = stmt
+				if knownServices == nil || len(callExpr.Args) != 2 || knownServices[match[1]] {
+					continue
+				}
+				// Only registrations of project services count, e.g. health servers are skipped
+				// 只计入项目服务的注册，例如跳过健康检查服务
+				if ident, ok := callExpr.Args[1].(*ast.Ident); ok && strings.HasPrefix(paramTypes[ident.Name], "*"+servicePkgName+".") {
+					zaplog.LOG.Debug("stale registration", zap.String("function", function.Name.Name), zap.String("service", match[1]))
+					stale = append(stale, match[1])
+				}
+			}
+		}
+		serverArg := "srv"
+		if lastRegister != nil {
+			serverArg = getTypeName(code, lastRegister.X.(*ast.CallExpr).Args[0])
+		} else if returnStmt != nil && len(returnStmt.Results) > 0 {
+			if ident, ok := returnStmt.Results[0].(*ast.Ident); ok {
+				serverArg = ident.Name
+			}
+		}
+		if lastRegister == nil && returnStmt == nil {
+			zaplog.LOG.Warn("server constructor without return, skip registering", zap.String("function", function.Name.Name))
+			continue
+		}
+
+		var newParams []string
+		var newStmts []string
+		for _, service := range services {
+			if registeredSet[service.name] || (suffix == "HTTPServer" && !service.http) {
+				continue
+			}
+			serviceType := "*" + importAs(servicePkgPath, path.Base(servicePkgPath), path.Base(servicePkgPath)) + "." + service.structName
+			paramName := ""
+			for name, typeText := range paramTypes {
+				if typeText == serviceType {
+					paramName = name
+				}
+			}
+			if paramName == "" {
+				paramName = utils.LowerFirstChar(service.name)
+				for idx := 1; paramNames[paramName] || takenNames[paramName] != "" || token.IsKeyword(paramName); idx++ {
+					paramName = utils.LowerFirstChar(service.structName)
+					if idx > 1 {
+						paramName += strconv.Itoa(idx)
+					}
+				}
+				paramNames[paramName] = true
+				paramTypes[paramName] = serviceType
+				newParams = append(newParams, paramName+" "+serviceType)
+			}
+			pkgName := strings.NewReplacer("-", "_", ".", "_").Replace(path.Base(service.pbPath))
+			pbName := importAs(service.pbPath, pkgName, strings.ReplaceAll(service.protoPkg, ".", ""))
+			newStmts = append(newStmts, pbName+".Register"+service.name+suffix+"("+serverArg+", "+paramName+")")
+			registered = append(registered, service.name)
+		}
+
+		// Service params go before logger, same as Kratos layout
+		// 服务参数放在 logger 之前，与 Kratos 布局一致
+		params := function.Type.Params
+		switch {
+		case len(newParams) == 0:
+		case loggerParam != nil:
+			edits = append(edits, &textEdit{pos: loggerParam.Pos(), end: loggerParam.Pos(), text: strings.Join(newParams, ", ") + ", "})
+		case len(params.List) > 0:
+			edits = append(edits, &textEdit{pos: params.Closing, end: params.Closing, text: ", " + strings.Join(newParams, ", ")})
+		default:
+			edits = append(edits, &textEdit{pos: params.Closing, end: params.Closing, text: strings.Join(newParams, ", ")})
+		}
+		switch {
+		case len(newStmts) == 0:
+		case lastRegister != nil:
+			edits = append(edits, &textEdit{pos: lastRegister.End(), end: lastRegister.End(), text: "\n\t" + strings.Join(newStmts, "\n\t")})
+		default:
+			edits = append(edits, &textEdit{pos: returnStmt.Pos(), end: returnStmt.Pos(), text: strings.Join(newStmts, "\n\t") + "\n\t"})
+		}
+	}
+	if len(edits) == 0 {
+		return code, registered, stale, nil
+	}
+	newCode, err := addNamedImports(applyTextEdits(code, edits), imports)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return newCode, registered, stale, nil
+}
+
+// goPackagePath returns Go import path of DIR, via module path in the nearest go.mod
+// goPackagePath 通过最近的 go.mod 中的模块路径返回 DIR 的 Go 导入路径
+func goPackagePath(root string) (string, error) {
+	for moduleRoot := root; ; moduleRoot = filepath.Dir(moduleRoot) {
+		modPath := filepath.Join(moduleRoot, "go.mod")
+		if ossoftexist.IsFile(modPath) {
+			data, err := os.ReadFile(modPath)
+			if err != nil {
+				return "", newSyncError(ErrorKindReadFailure, modPath, err)
+			}
+			modulePath := modfile.ModulePath(data)
+			if modulePath == "" {
+				return "", newSyncError(ErrorKindParseFailure, modPath, erero.New("module path not found"))
+			}
+			rel, err := filepath.Rel(moduleRoot, root)
+			if err != nil {
+				return "", newSyncError(ErrorKindPathNotFound, root, err)
+			}
+			return path.Join(modulePath, filepath.ToSlash(rel)), nil
+		}
+		if filepath.Dir(moduleRoot) == moduleRoot {
+			return "", newSyncError(ErrorKindPathNotFound, root, erero.New("go.mod not found"))
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package synckratos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestRegisterServerCode tests registering services in constructor without logger param or register calls
+// TestRegisterServerCode 测试在没有 logger 参数和注册调用的构造函数中注册服务
+func TestRegisterServerCode(t *testing.T) {
+	code := `package server
+
+import (
+	"github.com/go-kratos/kratos/v2/transport/grpc"
+)
+
+func NewGRPCServer(user string) *grpc.Server {
+	server := grpc.NewServer()
+	return server
+}
+`
+	services := []*createdService{
+		{name: "User", structName: "UserService", pbPath: "demo/api/user/v1", protoPkg: "user.v1"},
+	}
+	newCode, registered, stale, err := registerServerCode([]byte(code), services, "demo/internal/service", nil)
+	require.NoError(t, err)
+	t.Log(string(newCode))
+	require.Equal(t, []string{"User"}, registered)
+	require.Empty(t, stale)
+	require.Contains(t, string(newCode), "func NewGRPCServer(user string, userService *service.UserService) *grpc.Server {")
+	require.Contains(t, string(newCode), "\tv1.RegisterUserServer(server, userService)\n\treturn server\n")
+	require.Contains(t, string(newCode), `"demo/internal/service"`)
+	require.Contains(t, string(newCode), `"demo/api/user/v1"`)
+
+	// Registered ones are skipped
+	// 已注册的服务会被跳过
+	_, registered, _, err = registerServerCode(newCode, services, "demo/internal/service", nil)
+	require.NoError(t, err)
+	require.Empty(t, registered)
+}
+
+// TestSyncServicesRegisterServers tests new services registered in grpc.go and http.go, and stale registrations reported
+// TestSyncServicesRegisterServers 测试新服务注册到 grpc.go 和 http.go，并报告过时的注册
+func TestSyncServicesRegisterServers(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_server_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	writeFile := func(path string, content string) {
+		path = filepath.Join(tempRoot, path)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+	}
+	writeFile("go.mod", "module demo\n\ngo 1.22\n")
+	writeFile("api/helloworld/v1/greeter.proto", `syntax = "proto3";
+package helloworld.v1;
+option go_package = "demo/api/helloworld/v1;v1";
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+}
+message HelloRequest {}
+message HelloReply {}
+`)
+	writeFile("api/user/v1/user.proto", `syntax = "proto3";
+package user.v1;
+import "google/api/annotations.proto";
+option go_package = "demo/api/user/v1;v1";
+service User {
+  rpc GetUser (GetUserRequest) returns (GetUserReply) {
+    option (google.api.http) = { get: "/v1/users/{id}" };
+  }
+}
+message GetUserRequest { int64 id = 1; }
+message GetUserReply {}
+`)
+	writeFile("api/order/v1/order.proto", `syntax = "proto3";
+package order.v1;
+option go_package = "demo/api/order/v1;v1";
+service Order {
+  rpc GetOrder (GetOrderRequest) returns (GetOrderReply);
+}
+message GetOrderRequest {}
+message GetOrderReply {}
+`)
+	writeFile("internal/service/greeter.go", `package service
+
+import (
+	"context"
+
+	v1 "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	v1.UnimplementedGreeterServer
+}
+
+func NewGreeterService() *GreeterService {
+	return &GreeterService{}
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *v1.HelloRequest) (*v1.HelloReply, error) {
+	return &v1.HelloReply{}, nil
+}
+`)
+	writeFile("internal/server/grpc.go", `package server
+
+import (
+	v1 "demo/api/helloworld/v1"
+	legacyv1 "demo/api/legacy/v1"
+	"demo/internal/conf"
+	"demo/internal/service"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// NewGRPCServer new a gRPC server.
+func NewGRPCServer(c *conf.Server, greeter *service.GreeterService, legacy *service.LegacyService, logger log.Logger) *grpc.Server {
+	var opts = []grpc.ServerOption{}
+	srv := grpc.NewServer(opts...)
+	v1.RegisterGreeterServer(srv, greeter)
+	legacyv1.RegisterLegacyServer(srv, legacy)
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	return srv
+}
+`)
+	writeFile("internal/server/http.go", `package server
+
+import (
+	v1 "demo/api/helloworld/v1"
+	"demo/internal/conf"
+	"demo/internal/service"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// NewHTTPServer new an HTTP server.
+func NewHTTPServer(c *conf.Server, greeter *service.GreeterService, logger log.Logger) *http.Server {
+	var opts = []http.ServerOption{}
+	srv := http.NewServer(opts...)
+	v1.RegisterGreeterHTTPServer(srv, greeter)
+	return srv
+}
+`)
+
+	report, err := SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, RegisterServers: true})
+	require.NoError(t, err)
+	report.WriteText(os.Stdout)
+	require.Equal(t, []*ServerChange{
+		{Path: "internal/server/grpc.go", Registered: []string{"Order", "User"}, Stale: []string{"Legacy"}},
+		{Path: "internal/server/http.go", Registered: []string{"User"}, Stale: []string{}},
+	}, report.Servers)
+
+	grpcCode := string(rese.V1(os.ReadFile(filepath.Join(tempRoot, "internal/server/grpc.go"))))
+	t.Log(grpcCode)
+	require.Contains(t, grpcCode, "func NewGRPCServer(c *conf.Server, greeter *service.GreeterService, legacy *service.LegacyService, order *service.OrderService, user *service.UserService, logger log.Logger) *grpc.Server {")
+	require.Contains(t, grpcCode, "\tgrpc_health_v1.RegisterHealthServer(srv, health.NewServer())\n\torderv1.RegisterOrderServer(srv, order)\n\tuserv1.RegisterUserServer(srv, user)\n\treturn srv\n")
+	require.Contains(t, grpcCode, `orderv1 "demo/api/order/v1"`)
+	require.Contains(t, grpcCode, `userv1 "demo/api/user/v1"`)
+
+	httpCode := string(rese.V1(os.ReadFile(filepath.Join(tempRoot, "internal/server/http.go"))))
+	t.Log(httpCode)
+	require.Contains(t, httpCode, "func NewHTTPServer(c *conf.Server, greeter *service.GreeterService, user *service.UserService, logger log.Logger) *http.Server {")
+	require.Contains(t, httpCode, "\tv1.RegisterGreeterHTTPServer(srv, greeter)\n\tuserv1.RegisterUserHTTPServer(srv, user)\n")
+	require.NotContains(t, httpCode, "Order")
+
+	// Next sync registers nothing, stale one is still reported
+	// 下次同步不再注册，过时的注册仍会被报告
+	report, err = SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, RegisterServers: true})
+	require.NoError(t, err)
+	require.False(t, report.HasChanges())
+	require.Equal(t, []*ServerChange{
+		{Path: "internal/server/grpc.go", Registered: []string{}, Stale: []string{"Legacy"}},
+	}, report.Servers)
+}
@@ -6,29 +6,28 @@
 package synckratos
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
-	"go/token"
+	"io"
+	"maps"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
-	"time"
 
-	"github.com/orzkratos/astkratos"
 	"github.com/orzkratos/orzkratos/internal/utils"
-	"github.com/yyle88/eroticgo"
+	"github.com/yyle88/erero"
 	"github.com/yyle88/must"
 	"github.com/yyle88/neatjson/neatjsons"
-	"github.com/yyle88/osexec"
-	"github.com/yyle88/osexistpath/osmustexist"
 	"github.com/yyle88/osexistpath/ossoftexist"
 	"github.com/yyle88/printgo"
 	"github.com/yyle88/rese"
-	"github.com/yyle88/sortx"
 	"github.com/yyle88/syntaxgo/syntaxgo_ast"
 	"github.com/yyle88/syntaxgo/syntaxgo_astnode"
 	"github.com/yyle88/syntaxgo/syntaxgo_search"
+	"github.com/yyle88/tern"
 	"github.com/yyle88/zaplog"
 	"go.uber.org/zap"
 )
@@ -37,139 +36,491 @@ import (
 // SyncOptions 定义服务同步中使用的选项
 type SyncOptions struct {
 	MaskMode bool // Match via Unimplemented*Server type instead of filename // 按 Unimplemented*Server 类型匹配而非文件名
+	DryRun   bool // Plan changes without writing service files // 只计划变更而不写入服务文件
+
+	// UseKratosCLI generates service code via "kratos proto server" instead of native generation
+	// UseKratosCLI 使用 "kratos proto server" 生成服务代码，而非内置生成
+	UseKratosCLI bool
+
+	// ProtoRoot, ServiceRoot, ServerRoot and StagingRoot set DIRs of protos, service files, server files and staging
+	// Relative paths are joined with project root, blank means "api", "internal/service", "internal/server" and OS temp DIR
+	//
+	// ProtoRoot、ServiceRoot、ServerRoot 和 StagingRoot 设置 proto、服务文件、服务器文件和暂存的 DIR
+	// 相对路径会拼接到项目根 DIR，为空时分别使用 "api"、"internal/service"、"internal/server" 和系统临时 DIR
+	ProtoRoot   string
+	ServiceRoot string
+	ServerRoot  string
+	StagingRoot string
+
+	// RegisterServers registers services created in sync in NewGRPCServer and NewHTTPServer of ServerRoot
+	// Full sync also reports registrations of services defined in no proto
+	//
+	// RegisterServers 将同步中新建的服务注册到 ServerRoot 中的 NewGRPCServer 和 NewHTTPServer
+	// 全量同步还会报告没有 proto 定义的服务的注册
+	RegisterServers bool
+
+	// Layers scaffolds biz and data files of services created in sync, injects the usecase and wires ProviderSets
+	// BizRoot and DataRoot set DIRs of the layers, blank means "biz" and "data" next to ServiceRoot
+	//
+	// Layers 为同步中新建的服务生成 biz 和 data 文件，注入用例并装配 ProviderSet
+	// BizRoot 和 DataRoot 设置分层的 DIR，为空时使用与 ServiceRoot 同级的 "biz" 和 "data"
+	Layers   bool
+	BizRoot  string
+	DataRoot string
+
+	// Templates replaces built-in templates of generated code, nil means built-in
+	// Templates 替换生成代码的内置模板，为 nil 时使用内置模板
+	Templates *Templates
+
+	// SyncProviders appends constructors of service structs missing in "var ProviderSet = wire.NewSet(...)" of service package
+	// Full sync also reports constructors of services defined in no proto, PruneProviders removes them
+	//
+	// SyncProviders 将服务包的 "var ProviderSet = wire.NewSet(...)" 中缺失的服务 struct 构造函数追加进去
+	// 全量同步还会报告没有 proto 定义的服务的构造函数，PruneProviders 会删除它们
+	SyncProviders  bool
+	PruneProviders bool
+
+	// ProtoIncludes adds proto roots outside the project, e.g. a shared api module
+	// Each entry is a DIR (relative to project root or absolute) or a Go module path required in go.mod
+	// Their protos sync services already in project, matched via Unimplemented*Server type, never create new ones
+	// Imports are resolved across include roots, proto DIR, third_party and project root
+	//
+	// ProtoIncludes 添加项目之外的 proto 根 DIR，例如共享的 api 模块
+	// 每个条目是 DIR（相对于项目根 DIR 或绝对路径）或 go.mod 中依赖的 Go 模块路径
+	// 其中的 proto 只同步项目中已有的服务，按 Unimplemented*Server 类型匹配，从不新建服务
+	// 导入会在包含的根 DIR、proto DIR、third_party 和项目根 DIR 中解析
+	ProtoIncludes []string
+
+	// IgnoreGlobs skips protos whose path relative to project root matches, "**" matches any DIRs
+	// Protos of include roots match via path relative to their include root
+	//
+	// IgnoreGlobs 跳过相对于项目根 DIR 的路径匹配的 proto，"**" 匹配任意层 DIR
+	// 包含的根 DIR 中的 proto 按相对于其根 DIR 的路径匹配
+	IgnoreGlobs []string
+
+	// Renames maps old method name to new method name when proto RPC is renamed
+	// Methods with matching types are paired without it, when the match is unique
+	//
+	// Renames 在 proto RPC 改名时将旧方法名映射到新方法名
+	// 类型匹配且唯一的方法无需配置即可配对
+	Renames map[string]string
+
+	// RemovedMethodPolicy tells how to handle methods whose proto functions are deleted
+	// Blank means RemovedMethodUnexport
+	//
+	// RemovedMethodPolicy 表示如何处理 proto 函数已删除的方法
+	// 为空时使用 RemovedMethodUnexport
+	RemovedMethodPolicy RemovedMethodPolicy
+
+	// TestSkeletons creates or extends <service>_test.go with a skipped table-driven test per method added in sync
+	// Tests named Test<Struct>_<Method> are renamed with methods renamed or unexported in sync
+	//
+	// TestSkeletons 为同步中新增的每个方法在 <service>_test.go 中创建或追加一个跳过的表驱动测试
+	// 名为 Test<Struct>_<Method> 的测试随同步中重命名或非导出的方法一起重命名
+	TestSkeletons bool
+
+	// SortStructs sorts service structs sharing a file to match service sequence in proto
+	// SortStructs 按 proto 中的服务顺序排序共用文件的服务 struct
+	SortStructs bool
+
+	// ImportRewrites holds rules applied when fixing placeholders of generated code, nil means none
+	// ImportRewrites 保存修复生成代码中占位符时应用的规则，为 nil 表示没有规则
+	ImportRewrites *ImportRewrites
+
+	// DiffOutput receives unified diff of service file changes, nil to skip
+	// DiffRoot sets DIR that diff paths are relative to, blank means project root, SyncApps uses monorepo root
+	//
+	// DiffOutput 接收服务文件变更的统一 diff，为 nil 时跳过
+	// DiffRoot 设置 diff 路径所相对的 DIR，为空时使用项目根 DIR，SyncApps 使用 monorepo 根 DIR
+	DiffOutput io.Writer
+	DiffRoot   string
+
+	// KeepBackups keeps the last N backup snapshots, older ones are pruned after each backup, 0 keeps all
+	// The zero value keeps all, while NewConfig and the CLI default to 20
+	//
+	// KeepBackups 保留最近 N 个备份快照，每次备份后清理更早的快照，为 0 时全部保留
+	// 零值表示全部保留，而 NewConfig 和命令行默认保留 20 个
+	KeepBackups int
+}
+
+// protoRoot returns DIR of proto files
+// protoRoot 返回 proto 文件的 DIR
+func (options *SyncOptions) protoRoot(projectRoot string) string {
+	return resolveRoot(projectRoot, options.ProtoRoot, "api")
+}
+
+// serviceRoot returns DIR of service files
+// serviceRoot 返回服务文件的 DIR
+func (options *SyncOptions) serviceRoot(projectRoot string) string {
+	return resolveRoot(projectRoot, options.ServiceRoot, "internal/service")
+}
+
+// bizRoot returns DIR of biz layer, next to service DIR by default
+// bizRoot 返回 biz 层的 DIR，默认与服务 DIR 同级
+func (options *SyncOptions) bizRoot(projectRoot string) string {
+	if options.BizRoot == "" {
+		return filepath.Join(filepath.Dir(options.serviceRoot(projectRoot)), "biz")
+	}
+	return resolveRoot(projectRoot, options.BizRoot, "")
+}
+
+// dataRoot returns DIR of data layer, next to service DIR by default
+// dataRoot 返回 data 层的 DIR，默认与服务 DIR 同级
+func (options *SyncOptions) dataRoot(projectRoot string) string {
+	if options.DataRoot == "" {
+		return filepath.Join(filepath.Dir(options.serviceRoot(projectRoot)), "data")
+	}
+	return resolveRoot(projectRoot, options.DataRoot, "")
+}
+
+// serverRoot returns DIR of server files
+// serverRoot 返回服务器文件的 DIR
+func (options *SyncOptions) serverRoot(projectRoot string) string {
+	return resolveRoot(projectRoot, options.ServerRoot, "internal/server")
+}
+
+// resolveRoot joins relative path with project root, uses defaultPath when blank
+// resolveRoot 将相对路径拼接到项目根 DIR，为空时使用 defaultPath
+func resolveRoot(projectRoot string, path string, defaultPath string) string {
+	if path == "" {
+		path = defaultPath
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(projectRoot, path)
 }
 
 // GenServicesCode syncs each service file in project with proto definitions
-// Scans api/ DIR, generates missing services, and syncs existing ones
+// Thin wrapper of SyncServices, panics on failure and prints the result
 //
 // GenServicesCode 将项目中的所有服务文件与 proto 定义同步
-// 扫描 api/ DIR，生成缺失的服务，并同步现有服务
+// SyncServices 的简单封装，失败时 panic 并打印结果
 func GenServicesCode(projectRoot string, options *SyncOptions) {
-	zaplog.LOG.Debug("sync all services", zap.String("project", projectRoot), zap.Bool("mask-mode", options.MaskMode))
-
-	protoVolume := filepath.Join(projectRoot, "api")
-	serviceTypes := astkratos.ListGrpcServices(protoVolume)
-	zaplog.SUG.Debugln("found gRPC services:", eroticgo.BLUE.Sprint(neatjsons.S(serviceTypes)))
-
-	oldServiceRoot := filepath.Join(projectRoot, "internal/service")
-	newServiceTemp := filepath.Join(oldServiceRoot, "tmp")
-	newServiceRoot := filepath.Join(newServiceTemp, time.Now().Format("20060102150405"))
-
-	must.Done(utils.WalkFiles(protoVolume, utils.NewSuffixPattern([]string{".proto"}), func(protoPath string, info os.FileInfo) error {
-		createNewService(&createNewServiceParam{
-			projectRoot:    projectRoot,
-			protoPath:      protoPath,
-			serviceTypes:   serviceTypes,
-			oldServiceRoot: oldServiceRoot,
-			newServiceRoot: newServiceRoot,
-			syncOptions:    options,
-		})
-		return nil
-	}))
+	report := rese.P1(SyncServices(context.Background(), projectRoot, options))
+	showResult(report, options)
+}
 
-	writeServiceCode(oldServiceRoot, newServiceRoot, options)
+// GenServicesOnce syncs service files with a single proto file
+// Thin wrapper of SyncServicesOnce, panics on failure and prints the result
+//
+// GenServicesOnce 将服务文件与单个 proto 文件同步
+// SyncServicesOnce 的简单封装，失败时 panic 并打印结果
+func GenServicesOnce(projectRoot string, protoPath string, options *SyncOptions) {
+	report := rese.P1(SyncServicesOnce(context.Background(), projectRoot, protoPath, options))
+	showResult(report, options)
+}
+
+// SyncServices syncs each service file in project with proto definitions
+// Scans proto DIR (api/ by default), generates missing services, and syncs existing ones
+// Returns SyncError on failure, service files stay untouched when failing before write
+//
+// SyncServices 将项目中的所有服务文件与 proto 定义同步
+// 扫描 proto DIR（默认为 api/），生成缺失的服务，并同步现有服务
+// 失败时返回 SyncError，在写入前失败时服务文件保持不变
+func SyncServices(ctx context.Context, projectRoot string, options *SyncOptions) (*SyncReport, error) {
+	zaplog.LOG.Debug("sync all services", zap.String("project", projectRoot), zap.Bool("mask-mode", options.MaskMode), zap.Bool("dry-run", options.DryRun))
+
+	if err := checkRemovedMethodPolicy(options.RemovedMethodPolicy); err != nil {
+		return nil, err
+	}
+	if err := checkImportRewrites(options.ImportRewrites); err != nil {
+		return nil, err
+	}
+	if !ossoftexist.IsRoot(projectRoot) {
+		return nil, newSyncError(ErrorKindPathNotFound, projectRoot, erero.New("project root not found"))
+	}
+	includeRoots, err := options.protoIncludeRoots(ctx, projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	// Proto DIR may be absent when each proto comes from include roots
+	// 当所有 proto 都来自包含的根 DIR 时，proto DIR 可以不存在
+	protoVolume := options.protoRoot(projectRoot)
+	walkRoots := includeRoots
+	if ossoftexist.IsRoot(protoVolume) {
+		walkRoots = append([]string{protoVolume}, includeRoots...)
+	} else if len(includeRoots) == 0 {
+		return nil, newSyncError(ErrorKindPathNotFound, protoVolume, erero.New("proto DIR not found"))
+	}
 
-	if path := newServiceTemp; ossoftexist.IsRoot(path) {
-		exist := rese.V1(utils.HasFiles(path))
-		if !exist {
-			must.Done(os.RemoveAll(path)) // Complete, remove redundant DIR // 完成时删除多余的 DIR
+	oldServiceRoot := options.serviceRoot(projectRoot)
+	newServiceTemp, err := newServiceTempRoot(projectRoot, options)
+	if err != nil {
+		return nil, err
+	}
+	newServiceRoot := filepath.Join(newServiceTemp, "service")
+	defer removeServiceTemp(newServiceTemp)
+
+	run := newSyncRun(projectRoot, options)
+	run.setIncludeRoots(includeRoots)
+	walkedProtos := make(map[string]bool)
+	for _, walkRoot := range walkRoots {
+		// Ignore globs match path relative to project root, or to include root
+		// 忽略通配符匹配相对于项目根 DIR 的路径，或相对于包含的根 DIR 的路径
+		ignoreRoot := tern.BVV(walkRoot == protoVolume, projectRoot, walkRoot)
+		if err := utils.WalkFiles(walkRoot, utils.NewSuffixPattern([]string{".proto"}), func(protoPath string, info os.FileInfo) error {
+			if walkedProtos[protoPath] {
+				return nil
+			}
+			walkedProtos[protoPath] = true
+			if isIgnored(ignoreRoot, protoPath, options.IgnoreGlobs) {
+				zaplog.LOG.Debug("proto ignored, skip", zap.String("proto", protoPath))
+				run.recordIgnoredServices(protoPath)
+				return nil
+			}
+			protoFile, err := parseProtoPath(protoPath)
+			if err != nil {
+				return err
+			}
+			return createNewService(ctx, &createNewServiceParam{
+				projectRoot:    projectRoot,
+				protoFile:      protoFile,
+				oldServiceRoot: oldServiceRoot,
+				newServiceRoot: newServiceRoot,
+				syncRun:        run,
+			})
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeServiceCode(run, oldServiceRoot, newServiceRoot); err != nil {
+		return nil, err
+	}
+	if options.TestSkeletons {
+		if err := run.writeTestSkeletons(); err != nil {
+			return nil, err
+		}
+	}
+	if options.Layers {
+		if err := run.scaffoldLayers(); err != nil {
+			return nil, err
+		}
+	}
+	if options.RegisterServers {
+		if err := run.registerServices(true); err != nil {
+			return nil, err
+		}
+	}
+	if options.SyncProviders {
+		if err := run.syncProviders(true); err != nil {
+			return nil, err
 		}
 	}
+	if err := run.finish(); err != nil {
+		return nil, err
+	}
 
 	zaplog.LOG.Debug("sync all done")
-	eroticgo.GREEN.ShowMessage("SUCCESS")
+	return run.report, nil
 }
 
-// GenServicesOnce syncs service files with a single proto file
+// SyncServicesOnce syncs service files with a single proto file
 // Generates missing service and syncs existing one based on specified proto
+// Returns SyncError on failure, service files stay untouched when failing before write
 //
-// GenServicesOnce 将服务文件与单个 proto 文件同步
+// SyncServicesOnce 将服务文件与单个 proto 文件同步
 // 根据指定的 proto 生成缺失的服务并同步现有服务
-func GenServicesOnce(projectRoot string, protoPath string, options *SyncOptions) {
-	zaplog.LOG.Debug("sync single proto", zap.String("project", projectRoot), zap.String("proto", protoPath), zap.Bool("mask-mode", options.MaskMode))
+// 失败时返回 SyncError，在写入前失败时服务文件保持不变
+func SyncServicesOnce(ctx context.Context, projectRoot string, protoPath string, options *SyncOptions) (*SyncReport, error) {
+	zaplog.LOG.Debug("sync single proto", zap.String("project", projectRoot), zap.String("proto", protoPath), zap.Bool("mask-mode", options.MaskMode), zap.Bool("dry-run", options.DryRun))
 
-	osmustexist.MustRoot(projectRoot)
-	osmustexist.MustFile(protoPath)
-	protoVolume := filepath.Dir(protoPath)
-	serviceTypes := astkratos.ListGrpcServices(protoVolume)
-	zaplog.SUG.Debugln("found gRPC services:", eroticgo.BLUE.Sprint(neatjsons.S(serviceTypes)))
+	if err := checkRemovedMethodPolicy(options.RemovedMethodPolicy); err != nil {
+		return nil, err
+	}
+	if err := checkImportRewrites(options.ImportRewrites); err != nil {
+		return nil, err
+	}
+	if !ossoftexist.IsRoot(projectRoot) {
+		return nil, newSyncError(ErrorKindPathNotFound, projectRoot, erero.New("project root not found"))
+	}
+	// Relative proto path is based on project root, same as running kratos in project root
+	// 相对的 proto 路径基于项目根 DIR，与在项目根 DIR 执行 kratos 一致
+	if !filepath.IsAbs(protoPath) {
+		protoPath = filepath.Join(projectRoot, protoPath)
+	}
+	if !ossoftexist.IsFile(protoPath) {
+		return nil, newSyncError(ErrorKindPathNotFound, protoPath, erero.New("proto file not found"))
+	}
+	protoFile, err := parseProtoPath(protoPath)
+	if err != nil {
+		return nil, err
+	}
+	includeRoots, err := options.protoIncludeRoots(ctx, projectRoot)
+	if err != nil {
+		return nil, err
+	}
 
-	oldServiceRoot := filepath.Join(projectRoot, "internal/service")
-	newServiceRoot := filepath.Join(oldServiceRoot, "tmp", time.Now().Format("20060102150405"))
+	oldServiceRoot := options.serviceRoot(projectRoot)
+	newServiceTemp, err := newServiceTempRoot(projectRoot, options)
+	if err != nil {
+		return nil, err
+	}
+	newServiceRoot := filepath.Join(newServiceTemp, "service")
+	defer removeServiceTemp(newServiceTemp)
 
-	createNewService(&createNewServiceParam{
+	run := newSyncRun(projectRoot, options)
+	run.setIncludeRoots(includeRoots)
+	if err := createNewService(ctx, &createNewServiceParam{
 		projectRoot:    projectRoot,
-		protoPath:      protoPath,
-		serviceTypes:   serviceTypes,
+		protoFile:      protoFile,
 		oldServiceRoot: oldServiceRoot,
 		newServiceRoot: newServiceRoot,
-		syncOptions:    options,
-	})
+		syncRun:        run,
+	}); err != nil {
+		return nil, err
+	}
 
-	writeServiceCode(oldServiceRoot, newServiceRoot, options)
+	if err := writeServiceCode(run, oldServiceRoot, newServiceRoot); err != nil {
+		return nil, err
+	}
+	// Other protos are not read, so stale registrations and providers are not checked
+	// 不读取其它 proto，因此不检查过时的注册和提供者
+	if options.TestSkeletons {
+		if err := run.writeTestSkeletons(); err != nil {
+			return nil, err
+		}
+	}
+	if options.Layers {
+		if err := run.scaffoldLayers(); err != nil {
+			return nil, err
+		}
+	}
+	if options.RegisterServers {
+		if err := run.registerServices(false); err != nil {
+			return nil, err
+		}
+	}
+	if options.SyncProviders {
+		if err := run.syncProviders(false); err != nil {
+			return nil, err
+		}
+	}
+	if err := run.finish(); err != nil {
+		return nil, err
+	}
 
 	zaplog.LOG.Debug("sync single done")
-	eroticgo.GREEN.ShowMessage("SUCCESS")
+	return run.report, nil
+}
+
+// newServiceTempRoot creates the staging DIR of this run, holding regenerated services
+// Stages in OS temp DIR by default, so editors and "go build ./..." never see half-generated files
+//
+// newServiceTempRoot 创建本次同步的暂存 DIR，存放重新生成的服务
+// 默认在系统临时 DIR 中暂存，使编辑器和 "go build ./..." 不会看到生成一半的文件
+func newServiceTempRoot(projectRoot string, options *SyncOptions) (string, error) {
+	stagingRoot := os.TempDir()
+	if options.StagingRoot != "" {
+		stagingRoot = resolveRoot(projectRoot, options.StagingRoot, "")
+		if err := os.MkdirAll(stagingRoot, 0755); err != nil {
+			return "", newSyncError(ErrorKindWriteFailure, stagingRoot, err)
+		}
+	}
+	path, err := os.MkdirTemp(stagingRoot, "orzkratos_staging_*")
+	if err != nil {
+		return "", newSyncError(ErrorKindWriteFailure, stagingRoot, err)
+	}
+	return path, nil
+}
+
+// removeServiceTemp removes staging DIR of this run
+// Failures are logged, they do not affect the synced service files
+//
+// removeServiceTemp 删除本次同步的暂存 DIR
+// 失败只记录日志，不影响已同步的服务文件
+func removeServiceTemp(newServiceTemp string) {
+	if err := os.RemoveAll(newServiceTemp); err != nil {
+		zaplog.LOG.Warn("remove staging DIR failed", zap.String("path", newServiceTemp), zap.Error(err))
+	}
 }
 
 // createNewServiceParam holds params needed to create and regenerate service files
 // createNewServiceParam 保存创建和重新生成服务文件所需的参数
 type createNewServiceParam struct {
-	projectRoot    string                          // Project root path // 项目根路径
-	protoPath      string                          // Proto file path // Proto 文件路径
-	serviceTypes   []*astkratos.GrpcTypeDefinition // gRPC service type definitions // gRPC 服务类型定义
-	oldServiceRoot string                          // Existing service DIR // 现有服务 DIR
-	newServiceRoot string                          // Staging DIR to regenerate services // 重新生成服务的暂存 DIR
-	syncOptions    *SyncOptions                    // Sync options // 同步选项
+	projectRoot    string     // Project root path // 项目根路径
+	protoFile      *protoFile // Parsed proto file // 已解析的 proto 文件
+	oldServiceRoot string     // Existing service DIR // 现有服务 DIR
+	newServiceRoot string     // Staging DIR to regenerate services // 重新生成服务的暂存 DIR
+	syncRun        *syncRun   // Sync run state // 同步过程状态
 }
 
 // createNewService creates and regenerates service based on proto definition
+// Protos of include roots only regenerate services present in project, matched via mask type
+//
 // createNewService 根据 proto 定义创建和重新生成服务
-func createNewService(param *createNewServiceParam) {
-	zaplog.LOG.Debug("processing proto file", zap.String("proto", param.protoPath), zap.Bool("mask-mode", param.syncOptions.MaskMode))
+// 包含的根 DIR 中的 proto 只重新生成项目中已有的服务，按嵌入类型匹配
+func createNewService(ctx context.Context, param *createNewServiceParam) error {
+	options := param.syncRun.options
+	protoPath := param.protoFile.path
+	included := isIncludedProto(protoPath, param.syncRun.includeRoots)
+	zaplog.LOG.Debug("processing proto file", zap.String("proto", protoPath), zap.Bool("mask-mode", options.MaskMode), zap.Bool("included", included))
+	if len(param.protoFile.services) == 0 {
+		zaplog.LOG.Debug("no service in proto, skip")
+		return nil
+	}
+	param.syncRun.protoFiles[protoPath] = param.protoFile
+	for _, service := range param.protoFile.services {
+		param.syncRun.protoServices[goCamelCase(service.name)] = true
+	}
 	anyMissing := false
 	anyPresent := false
 
 	// In mask mode, build mask type map to check service existence
+	// Protos of include roots always match via mask type, their filenames say nothing about the project
+	//
 	// 在 mask 模式下，构建嵌入类型映射来检查服务是否存在
+	// 包含的根 DIR 中的 proto 始终按嵌入类型匹配，其文件名与项目无关
+	useMask := options.MaskMode || included
 	var maskMap map[string]string
-	if param.syncOptions.MaskMode {
-		maskMap = buildMaskTypeMap(param.oldServiceRoot)
+	if useMask {
+		var err error
+		if maskMap, err = buildMaskTypeMap(param.syncRun.store, param.oldServiceRoot); err != nil {
+			return err
+		}
 	}
 
-	protoCode := string(rese.V1(os.ReadFile(param.protoPath)))
-	for _, serviceType := range param.serviceTypes {
-		must.OK(serviceType.Name)
-		zaplog.LOG.Debug("checking service", zap.String("name", serviceType.Name))
-
-		if !strings.Contains(protoCode, fmt.Sprintf("service %s {", serviceType.Name)) {
-			zaplog.LOG.Debug("service not in this proto, skip")
-			continue
-		}
-		zaplog.LOG.Debug("service defined in proto", zap.String("name", serviceType.Name))
+	for _, service := range param.protoFile.services {
+		serviceName := goCamelCase(service.name)
+		must.OK(serviceName)
+		zaplog.LOG.Debug("service defined in proto", zap.String("name", serviceName))
 
 		// Check if service exists
 		// 检查服务是否存在
 		var serviceExists bool
-		if param.syncOptions.MaskMode {
+		if useMask {
 			// Mask mode: check via mask type (Unimplemented*Server, without package prefix)
 			// Mask 模式：按嵌入类型检查（不带包前缀）
-			maskTypeName := fmt.Sprintf("Unimplemented%sServer", serviceType.Name)
+			maskTypeName := fmt.Sprintf("Unimplemented%sServer", serviceName)
 			_, serviceExists = maskMap[maskTypeName]
 			zaplog.LOG.Debug("mask mode check", zap.String("type", maskTypeName), zap.Bool("exists", serviceExists))
 		} else {
 			// Default mode: check via filename
 			// 默认模式：按文件名检查
-			serviceFileName := strings.ToLower(serviceType.Name) + ".go"
-			serviceFilePath := filepath.Join(param.projectRoot, "internal/service", serviceFileName)
-			serviceExists = ossoftexist.IsFile(serviceFilePath)
+			serviceFileName := strings.ToLower(serviceName) + ".go"
+			serviceFilePath := filepath.Join(param.oldServiceRoot, serviceFileName)
+			serviceExists = param.syncRun.store.exists(serviceFilePath)
+		}
+
+		if !serviceExists && included {
+			// Shared protos hold services of other projects too, never create them
+			// 共享的 proto 也包含其它项目的服务，从不新建
+			zaplog.LOG.Debug("service of include root not in project, skip", zap.String("name", serviceName))
+			continue
 		}
 
+		// Record service in proto report, and its staging file in the staging sub DIR of proto
+		// 在 proto 报告中记录服务，并在 proto 的暂存子 DIR 中记录其暂存文件
+		protoReport := param.syncRun.protoReport(protoPath)
+		protoReport.Services = append(protoReport.Services, serviceName)
+		param.syncRun.stagingProtos[param.syncRun.stagingKey(protoPath, serviceName)] = protoPath
+
 		if !serviceExists {
-			zaplog.LOG.Debug("service not found", zap.String("name", serviceType.Name))
+			zaplog.LOG.Debug("service not found", zap.String("name", serviceName))
 			anyMissing = true
 		} else {
-			zaplog.LOG.Debug("service exists", zap.String("name", serviceType.Name))
+			zaplog.LOG.Debug("service exists", zap.String("name", serviceName))
 			anyPresent = true
 		}
 	}
@@ -177,63 +528,131 @@ func createNewService(param *createNewServiceParam) {
 	zaplog.LOG.Debug("check result", zap.Bool("any-missing", anyMissing), zap.Bool("any-present", anyPresent))
 	if anyMissing {
 		// Create new service when at least one service is missing
+		// Generate to staging DIR, then create into store, so dry-run writes nothing
+		//
 		// 只要有1个 service 缺失就新建服务
-		zaplog.LOG.Debug("creating new service", zap.String("path", param.oldServiceRoot))
-		out := rese.V1(osexec.ExecInPath(param.projectRoot, "kratos", "proto", "server", param.protoPath, "-t", param.oldServiceRoot))
-		zaplog.SUG.Debugln("kratos output:", string(out))
+		// 先生成到暂存 DIR，再创建到存储中，使 dry-run 不写入任何文件
+		createRoot := param.newServiceRoot + "_create"
+		zaplog.LOG.Debug("creating new service", zap.String("path", param.oldServiceRoot), zap.String("temp", createRoot))
+		defer func() {
+			if err := os.RemoveAll(createRoot); err != nil {
+				zaplog.LOG.Warn("remove staging DIR failed", zap.String("path", createRoot), zap.Error(err))
+			}
+		}()
+		if err := generateServiceCode(ctx, param, filepath.Join(createRoot, param.syncRun.stagingDir(protoPath)), true); err != nil {
+			return err
+		}
+		if err := replaceProtoImports(param.syncRun, createRoot); err != nil {
+			return err
+		}
+
+		if err := utils.WalkFiles(createRoot, utils.NewSuffixPattern([]string{".go"}), func(path string, info os.FileInfo) error {
+			code, err := os.ReadFile(path)
+			if err != nil {
+				return newSyncError(ErrorKindReadFailure, path, err)
+			}
+			servicePath := filepath.Join(param.oldServiceRoot, info.Name())
+			if param.syncRun.store.create(servicePath, code) {
+				param.syncRun.change(protoPath, servicePath).Created = true
+				zaplog.LOG.Debug("created new service", zap.String("file", info.Name()))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
 	}
 
 	if anyPresent {
 		// Regenerate to staging DIR when at least one service exists
 		// 只要有1个 service 已存在就重建到暂存 DIR 以便对比
 		zaplog.LOG.Debug("regenerate to temp", zap.String("path", param.newServiceRoot))
-		must.Done(os.MkdirAll(param.newServiceRoot, 0755))
-		out := rese.V1(osexec.ExecInPath(param.projectRoot, "kratos", "proto", "server", param.protoPath, "-t", param.newServiceRoot))
-		zaplog.SUG.Debugln("kratos output:", string(out))
+		if err := generateServiceCode(ctx, param, filepath.Join(param.newServiceRoot, param.syncRun.stagingDir(protoPath)), false); err != nil {
+			return err
+		}
 	}
 	zaplog.LOG.Debug("proto processing done")
+	return nil
+}
+
+// generateServiceCode generates service code of proto into target DIR
+// Uses native generation by default, "kratos proto server" when UseKratosCLI is set
+// Custom service template applies when create is set, custom method template applies always
+// Existing files in target DIR are kept, same as kratos
+//
+// generateServiceCode 将 proto 的服务代码生成到目标 DIR
+// 默认使用内置生成，设置 UseKratosCLI 时使用 "kratos proto server"
+// 设置 create 时使用自定义服务模板，自定义方法模板始终生效
+// 目标 DIR 中已存在的文件保持不变，与 kratos 一致
+func generateServiceCode(ctx context.Context, param *createNewServiceParam, targetRoot string, create bool) error {
+	if err := os.MkdirAll(targetRoot, 0755); err != nil {
+		return newSyncError(ErrorKindWriteFailure, targetRoot, err)
+	}
+	options := param.syncRun.options
+	if options.UseKratosCLI {
+		if templates := options.Templates; templates != nil && (templates.Service != "" || templates.Method != "") {
+			return newSyncError(ErrorKindBadOption, "templates", erero.New("service and method templates need native generation, not kratos-cli"))
+		}
+		return execKratosProtoServer(ctx, param.projectRoot, param.protoFile.path, targetRoot)
+	}
+	templates, err := loadStubTemplates(param.projectRoot, options.Templates, create)
+	if err != nil {
+		return err
+	}
+	stubs, err := generateServiceStubs(param.protoFile, param.syncRun.resolver, templates)
+	if err != nil {
+		return err
+	}
+	for name, code := range stubs {
+		path := filepath.Join(targetRoot, name)
+		if ossoftexist.IsFile(path) {
+			zaplog.LOG.Debug("service already exists, skip", zap.String("path", path))
+			continue
+		}
+		if err := os.WriteFile(path, code, 0644); err != nil {
+			return newSyncError(ErrorKindWriteFailure, path, err)
+		}
+	}
+	return nil
 }
 
-// writeServiceCode writes synced service code back to source location
-// writeServiceCode 将同步后的服务代码写回源位置
-func writeServiceCode(oldServiceRoot string, newServiceRoot string, options *SyncOptions) {
+// execKratosProtoServer runs "kratos proto server" to generate services into target DIR
+// Returns missing-tool when kratos is not installed, tool-failure when it fails
+//
+// execKratosProtoServer 执行 "kratos proto server" 将服务生成到目标 DIR
+// 未安装 kratos 时返回 missing-tool，执行失败时返回 tool-failure
+func execKratosProtoServer(ctx context.Context, projectRoot string, protoPath string, targetRoot string) error {
+	kratosPath, err := exec.LookPath("kratos")
+	if err != nil {
+		return newSyncError(ErrorKindMissingTool, "kratos", err)
+	}
+	command := exec.CommandContext(ctx, kratosPath, "proto", "server", protoPath, "-t", targetRoot)
+	command.Dir = projectRoot
+	out, err := command.CombinedOutput()
+	zaplog.SUG.Debugln("kratos output:", string(out))
+	if err != nil {
+		return newSyncError(ErrorKindToolFailure, protoPath, erero.Errorf("kratos proto server: %v: %s", err, strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// writeServiceCode syncs service code in store with regenerated staging code
+// writeServiceCode 将存储中的服务代码与重新生成的暂存代码同步
+func writeServiceCode(run *syncRun, oldServiceRoot string, newServiceRoot string) error {
 	zaplog.LOG.Debug("writing service code", zap.String("old", oldServiceRoot), zap.String("new", newServiceRoot))
 	if path := newServiceRoot; ossoftexist.IsRoot(path) {
 		// Replace proto imports
 		// 替换 proto 引用
-		replaceProtoImports(path)
+		if err := replaceProtoImports(run, path); err != nil {
+			return err
+		}
 
 		// Sync service code
 		// 同步服务代码
-		syncServicesCode(oldServiceRoot, path, options)
-
-		// Remove temp DIR when done
-		// 完成后删除临时 DIR
-		must.Done(os.RemoveAll(path))
-	}
-}
-
-// replaceProtoImports fixes generated proto imports to use standard protobuf types
-// replaceProtoImports 修复生成的 proto 引用以使用标准 protobuf 类型
-func replaceProtoImports(newServiceRoot string) {
-	zaplog.LOG.Debug("replacing proto imports", zap.String("root", newServiceRoot))
-	rep := strings.NewReplacer(
-		"pb.google_protobuf_StringValue", "wrapperspb.StringValue", //pb.google_protobuf_StringValue -> wrapperspb.StringValue
-		"pb.google_protobuf_Empty", "emptypb.Empty", //pb.google_protobuf_Empty -> emptypb.Empty
-	)
-
-	must.Done(utils.WalkFiles(newServiceRoot, utils.NewSuffixPattern([]string{".go"}), func(path string, info os.FileInfo) error {
-		srcContent := string(rese.V1(os.ReadFile(path)))
-		newContent := rep.Replace(srcContent)
-		if newContent != srcContent {
-			newSource := syntaxgo_ast.InjectImports([]byte(newContent), []string{
-				"google.golang.org/protobuf/types/known/wrapperspb",
-				"google.golang.org/protobuf/types/known/emptypb",
-			})
-			utils.FormatAndWriteCode(path, newSource)
+		if err := syncServicesCode(run, oldServiceRoot, path); err != nil {
+			return err
 		}
-		return nil
-	}))
+	}
+	return nil
 }
 
 // syncServicesCode syncs old service code with new generated service code
@@ -241,30 +660,50 @@ func replaceProtoImports(newServiceRoot string) {
 //
 // syncServicesCode 将旧服务代码与新生成的服务代码同步
 // 添加缺失的方法、非导出已删除的方法、排序现有方法
-func syncServicesCode(oldServiceRoot string, newServiceRoot string, options *SyncOptions) {
+func syncServicesCode(run *syncRun, oldServiceRoot string, newServiceRoot string) error {
+	options := run.options
 	zaplog.LOG.Debug("syncing service code", zap.String("old", oldServiceRoot), zap.String("new", newServiceRoot), zap.Bool("mask-mode", options.MaskMode))
 
 	// In mask mode, build mask type to file path map based on old service files
 	// 在 mask 模式下，根据旧服务文件构建嵌入类型到文件路径的映射
 	var maskMap map[string]string
-	if options.MaskMode {
-		maskMap = buildMaskTypeMap(oldServiceRoot)
+	if options.MaskMode || len(run.includeRoots) > 0 {
+		var err error
+		if maskMap, err = buildMaskTypeMap(run.store, oldServiceRoot); err != nil {
+			return err
+		}
 		zaplog.SUG.Debugln("mask type map:", neatjsons.S(maskMap))
 	}
 
-	must.Done(utils.WalkFiles(newServiceRoot, utils.NewSuffixPattern([]string{".go"}), func(path string, info os.FileInfo) error {
+	syncedFiles := make(map[string]string) // Old file path to proto path // 旧文件路径到 proto 路径的映射
+	err := utils.WalkFiles(newServiceRoot, utils.NewSuffixPattern([]string{".go"}), func(path string, info os.FileInfo) error {
 		zaplog.SUG.Debugln("---")
 
+		// Services of include roots not in project are not recorded, skip their staging files
+		// 包含的根 DIR 中项目没有的服务不会被记录，跳过其暂存文件
+		protoPath, ok := run.stagingProto(newServiceRoot, path)
+		if !ok {
+			zaplog.LOG.Debug("staging file without service in project, skip", zap.String("file", info.Name()))
+			return nil
+		}
+
 		// Parse new service file first
 		// 首先解析新服务文件
 		zaplog.LOG.Debug("parsing new service file", zap.String("file", info.Name()))
-		vNew := parseServiceFile(path)
+		vNew, err := parseServiceFile(path)
+		if err != nil {
+			return err
+		}
 		zaplog.SUG.Debugln("---")
 
 		// Find old service file path
 		// 查找旧服务文件路径
+		// Staging files of include roots always match via mask type
+		// 包含的根 DIR 的暂存文件始终按嵌入类型匹配
+		included := isIncludedProto(protoPath, run.includeRoots)
 		var oldFilePath string
-		if options.MaskMode {
+		matchedBy := MatchedByFilename
+		if options.MaskMode || included {
 			// Mask mode: match via Unimplemented*Server type
 			// Mask 模式：按嵌入的 Unimplemented*Server 类型匹配
 			maskTypes := extractMaskTypes(vNew)
@@ -272,6 +711,7 @@ func syncServicesCode(oldServiceRoot string, newServiceRoot string, options *Syn
 				maskType := maskTypes[0]
 				if foundPath, ok := maskMap[maskType]; ok {
 					oldFilePath = foundPath
+					matchedBy = MatchedByMaskType
 					zaplog.LOG.Debug("mask mode matched", zap.String("type", maskType), zap.String("path", oldFilePath))
 				}
 			}
@@ -288,58 +728,141 @@ func syncServicesCode(oldServiceRoot string, newServiceRoot string, options *Syn
 		}
 
 		zaplog.LOG.Debug("parsing old service file", zap.String("file", filepath.Base(oldFilePath)))
-		vOld := parseServiceFile(oldFilePath)
+		vOld, err := run.parseStoreFile(oldFilePath)
+		if err != nil {
+			return err
+		}
 		zaplog.SUG.Debugln("---")
 
-		if missingCode := searchMissingMethods(vOld, vNew); len(missingCode) > 0 {
-			changedCode := []byte(string(vOld.code) + "\n" + missingCode)
-			utils.FormatAndWriteCode(vOld.path, changedCode)
-			vOld = parseServiceFile(vOld.path)
+		change := run.change(protoPath, oldFilePath)
+		change.MatchedBy = matchedBy
+		syncedFiles[oldFilePath] = protoPath
+
+		if changedCode, renames := renameMethods(vOld, vNew, run.options.Renames); len(changedCode) > 0 {
+			if vOld, err = run.writeStoreFile(vOld.path, changedCode); err != nil {
+				return err
+			}
+			change.Renamed = append(change.Renamed, renames...)
+			zaplog.LOG.Debug("renamed methods", zap.String("file", filepath.Base(vOld.path)))
+		}
+
+		if missingCode, names := searchMissingMethods(vOld, vNew); len(missingCode) > 0 {
+			changedCode, err := importUsedPackages([]byte(string(vOld.code)+"\n"+missingCode), vNew)
+			if err != nil {
+				return newSyncError(ErrorKindParseFailure, vOld.path, err)
+			}
+			if vOld, err = run.writeStoreFile(vOld.path, changedCode); err != nil {
+				return err
+			}
+			change.Added = append(change.Added, names...)
 			zaplog.LOG.Debug("added missing methods", zap.String("file", filepath.Base(vOld.path)))
 		}
 
-		if changedCode := unexportMethods(vOld, vNew); len(changedCode) > 0 {
-			utils.FormatAndWriteCode(vOld.path, changedCode)
-			vOld = parseServiceFile(vOld.path)
-			zaplog.LOG.Debug("unexported removed methods", zap.String("file", filepath.Base(vOld.path)))
+		if changedCode, switches := flagSwitchedMethods(vOld, vNew); len(switches) > 0 || len(changedCode) > 0 {
+			if len(changedCode) > 0 {
+				if vOld, err = run.writeStoreFile(vOld.path, changedCode); err != nil {
+					return err
+				}
+			}
+			change.Switched = append(change.Switched, switches...)
+			zaplog.LOG.Debug("flagged switched methods", zap.String("file", filepath.Base(vOld.path)), zap.Int("switched", len(switches)))
 		}
 
-		sortServiceMethods(vOld, vNew)
+		changedCode, names, err := updateMethodSignatures(vOld, vNew)
+		if err != nil {
+			return err
+		}
+		if len(changedCode) > 0 {
+			if vOld, err = run.writeStoreFile(vOld.path, changedCode); err != nil {
+				return err
+			}
+			change.Signatures = append(change.Signatures, names...)
+			zaplog.LOG.Debug("updated method signatures", zap.String("file", filepath.Base(vOld.path)))
+		}
+
+		if vOld, err = run.handleRemovedMethods(change, vOld, vNew); err != nil {
+			return err
+		}
+
+		if changedCode := sortServiceMethods(vOld, vNew); len(changedCode) > 0 {
+			if _, err = run.writeStoreFile(vOld.path, changedCode); err != nil {
+				return err
+			}
+			change.Reordered = true
+			zaplog.LOG.Debug("sorted service methods", zap.String("file", filepath.Base(vOld.path)))
+		}
 		return nil
-	}))
+	})
+	if err != nil {
+		return err
+	}
+
+	// Structs are sorted once each of their staging files is synced
+	// 每个 struct 的暂存文件都同步后再排序 struct
+	if options.SortStructs {
+		for _, oldFilePath := range slices.Sorted(maps.Keys(syncedFiles)) {
+			protoPath := syncedFiles[oldFilePath]
+			vOld, err := run.parseStoreFile(oldFilePath)
+			if err != nil {
+				return err
+			}
+			if changedCode := sortServiceStructs(vOld, run.protoFiles[protoPath]); len(changedCode) > 0 {
+				if err := run.store.write(oldFilePath, changedCode); err != nil {
+					return err
+				}
+				run.change(protoPath, oldFilePath).Reordered = true
+				zaplog.LOG.Debug("sorted service structs", zap.String("file", filepath.Base(oldFilePath)))
+			}
+		}
+	}
+	return nil
+}
+
+// parseStoreFile parses service file content held in store
+// parseStoreFile 解析存储中保存的服务文件内容
+func (run *syncRun) parseStoreFile(path string) (*ServiceFile, error) {
+	code, err := run.store.read(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseServiceCode(path, code)
+}
+
+// writeStoreFile writes code into store and parses the written content
+// writeStoreFile 将代码写入存储并解析写入后的内容
+func (run *syncRun) writeStoreFile(path string, code []byte) (*ServiceFile, error) {
+	if err := run.store.write(path, code); err != nil {
+		return nil, err
+	}
+	return run.parseStoreFile(path)
 }
 
 // buildMaskTypeMap scans DIR and builds map from mask type to file path
-// Skips tmp/ sub-DIR to avoid scanning temp files
+// Reads files via store, so files created in this sync run are included
 // Supports multiple mask types in one file
 //
 // buildMaskTypeMap 扫描 DIR 并构建嵌入类型到文件路径的映射
-// 跳过 tmp/ 子 DIR 以避免扫描临时文件
+// 通过存储读取文件，因此包含本次同步中新建的文件
 // 支持单个文件有多个嵌入类型
-func buildMaskTypeMap(serviceRoot string) map[string]string {
+func buildMaskTypeMap(store *codeStore, serviceRoot string) (map[string]string, error) {
 	zaplog.LOG.Debug("building mask type map", zap.String("root", serviceRoot))
 	maskMap := make(map[string]string)
-	_ = filepath.Walk(serviceRoot, func(path string, info os.FileInfo, err error) error {
+	for _, path := range store.listGoFiles(serviceRoot) {
+		code, err := store.read(path)
 		if err != nil {
-			return nil
-		}
-		// Skip tmp DIR
-		// 跳过 tmp DIR
-		if info.IsDir() && info.Name() == "tmp" {
-			return filepath.SkipDir
+			return nil, err
 		}
-		if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") {
-			return nil
+		svcFile, err := parseServiceCode(path, code)
+		if err != nil {
+			return nil, err
 		}
-		svcFile := parseServiceFile(path)
 		maskTypes := extractMaskTypes(svcFile)
 		for _, maskType := range maskTypes {
 			maskMap[maskType] = path
-			zaplog.LOG.Debug("found mask type", zap.String("type", maskType), zap.String("file", info.Name()))
+			zaplog.LOG.Debug("found mask type", zap.String("type", maskType), zap.String("file", filepath.Base(path)))
 		}
-		return nil
-	})
-	return maskMap
+	}
+	return maskMap, nil
 }
 
 // extractMaskTypes extracts Unimplemented*Server mask types from ServiceFile
@@ -378,18 +901,34 @@ func getTypeName(code []byte, expr ast.Expr) string {
 	return strings.TrimSpace(syntaxgo_astnode.GetText(code, expr))
 }
 
+// methodCodeText returns source text of method with its doc comment, package names switched via rename
+// methodCodeText 返回带有文档注释的方法源码文本，包名通过 rename 切换
+func methodCodeText(file *ServiceFile, method *ast.FuncDecl, rename map[string]string) string {
+	code := qualifyExprText(file.code, method, rename)
+	if method.Doc != nil {
+		code = string(file.code[method.Doc.Pos()-1:method.Doc.End()-1]) + "\n" + code
+	}
+	return code
+}
+
 // searchMissingMethods detects missing methods when proto adds new functions
 // In mask mode, match structs via mask type and swap the method's struct name
+// Returns missing code and names of missing methods
 //
 // searchMissingMethods 检测 proto 增加函数时服务代码中缺失的方法
 // 在 mask 模式下，按嵌入类型匹配 struct 并替换方法的 struct 名
-func searchMissingMethods(oldFile *ServiceFile, newFile *ServiceFile) string {
+// 返回缺失的代码和缺失方法的名称
+func searchMissingMethods(oldFile *ServiceFile, newFile *ServiceFile) (string, []string) {
 	ptx := printgo.NewPTX()
+	var names []string
 
 	// Build mask type to struct name map based on old file
 	// 根据旧文件构建嵌入类型到 struct 名的映射
 	oldMaskToStruct := buildStructMaskMap(oldFile)
 	newMaskToStruct := buildStructMaskMap(newFile)
+	// Package names in method code follow old file, e.g. "pb" -> "v1"
+	// 方法代码中的包名跟随旧文件，例如 "pb" -> "v1"
+	rename := importRenameMap(oldFile, newFile)
 
 	for structName, newServiceStruct := range newFile.serviceStructMap {
 		zaplog.SUG.Debugln("---")
@@ -419,7 +958,8 @@ func searchMissingMethods(oldFile *ServiceFile, newFile *ServiceFile) string {
 		if serviceStruct == nil {
 			ptx.Println("type", structName, newFile.GetNode(newServiceStruct.structType))
 			for _, method := range newServiceStruct.methods {
-				ptx.Println(newFile.GetNode(method))
+				ptx.Println(methodCodeText(newFile, method, rename))
+				names = append(names, method.Name.Name)
 			}
 			continue
 		}
@@ -431,18 +971,19 @@ func searchMissingMethods(oldFile *ServiceFile, newFile *ServiceFile) string {
 				zaplog.LOG.Debug("to add", zap.String("method", method.Name.Name))
 				// Swap struct name in method if names mismatch
 				// 如果 struct 名不同，替换方法中的 struct 名
-				methodCode := newFile.GetNode(method)
+				methodCode := methodCodeText(newFile, method, rename)
 				if structName != oldStructName {
 					methodCode = strings.Replace(methodCode, "*"+structName, "*"+oldStructName, 1)
 				}
 				ptx.Println(methodCode)
+				names = append(names, method.Name.Name)
 				continue
 			}
 			zaplog.LOG.Debug("exists", zap.String("method", oldMethod.Name.Name))
 		}
 	}
 	missingCode := strings.TrimSpace(ptx.String())
-	return missingCode
+	return missingCode, names
 }
 
 // buildStructMaskMap builds struct name to mask type map
@@ -469,12 +1010,14 @@ func buildStructMaskMap(svcFile *ServiceFile) map[string]string {
 	return result
 }
 
-// unexportMethods converts deleted proto functions to unexported
+// searchRemovedMethods finds exported methods whose proto functions are deleted
 // In mask mode, match structs via mask type
+// Skips unexported methods, which are helpers or handled in past sync runs
 //
-// unexportMethods 当 proto 删除函数时自动转换为非导出
+// searchRemovedMethods 查找 proto 函数已删除的导出方法
 // 在 mask 模式下，按嵌入类型匹配 struct
-func unexportMethods(oldFile *ServiceFile, newFile *ServiceFile) []byte {
+// 跳过非导出方法，它们是辅助方法或已在之前的同步中处理
+func searchRemovedMethods(oldFile *ServiceFile, newFile *ServiceFile) []*ast.FuncDecl {
 	var removedMethods []*ast.FuncDecl
 
 	// Build mask type to struct name map
@@ -535,155 +1078,38 @@ func unexportMethods(oldFile *ServiceFile, newFile *ServiceFile) []byte {
 			zaplog.LOG.Debug("retained", zap.String("method", newMethod.Name.Name))
 		}
 	}
-	if len(removedMethods) == 0 {
-		return []byte{}
-	}
-
-	source := utils.CopyBytes(oldFile.code)
-	changed := false // Track if any change made, skip write if unchanged // 跟踪是否有改动，无改动则跳过写入
+	var exportedMethods []*ast.FuncDecl
 	for _, method := range removedMethods {
-		name := method.Name.Name
-		zaplog.LOG.Debug("convert to unexported", zap.String("name", name))
-		if utils.IsFirstCharUpper(name) {
-			newName := []byte(utils.LowerFirstChar(name))
-			oldName := syntaxgo_astnode.GetCode(source, method.Name)
-			must.Same(len(newName), len(oldName))
-			copy(oldName, newName) // Same length allows in-place update // 长度相同可直接原地替换
-			changed = true
+		if utils.IsFirstCharUpper(method.Name.Name) {
+			exportedMethods = append(exportedMethods, method)
 		}
 	}
-	if changed {
-		return source
-	}
-	return []byte{}
+	return exportedMethods
 }
 
-// sortServiceMethods sorts methods to match proto definition sequence
-// Treats each method with its post code as a block, sorts via method name
-// In mask mode, match structs via mask type
+// unexportMethods converts removed methods to unexported, using names picked via unexportedNames
+// Returns changed code and renamed methods
 //
-// sortServiceMethods 按 proto 定义顺序排序服务方法
-// 把每个方法及其后续代码作为代码块，按方法名排序
-// 在 mask 模式下，按嵌入类型匹配 struct
-func sortServiceMethods(oldFile *ServiceFile, newFile *ServiceFile) {
-	// Build mask type to struct name map
-	// 构建嵌入类型到 struct 名的映射
-	oldMaskToStruct := buildStructMaskMap(oldFile)
-	newMaskToStruct := buildStructMaskMap(newFile)
-
-	for structName, newServiceStruct := range newFile.serviceStructMap {
-		zaplog.SUG.Debugln("---")
-		zaplog.LOG.Debug("sort methods", zap.String("struct", structName))
-
-		// Find matching struct via name first, then via mask type
-		// 首先按名字查找，然后按嵌入类型查找
-		oldServiceStruct, ok := oldFile.serviceStructMap[structName]
-		if !ok {
-			newMaskType := newMaskToStruct[structName]
-			if newMaskType != "" {
-				for oldName, oldMask := range oldMaskToStruct {
-					if oldMask == newMaskType {
-						oldServiceStruct = oldFile.serviceStructMap[oldName]
-						zaplog.LOG.Debug("mask mode sort match", zap.String("new", structName), zap.String("old", oldName), zap.String("via", newMaskType))
-						break
-					}
-				}
-			}
-		}
-		if oldServiceStruct == nil {
-			continue
-		}
-
-		// Collect valid old methods to sort based on new file index
-		// 收集有效的旧方法列表，根据新文件索引排序
-		var methods []*ast.FuncDecl
-		for _, method := range oldServiceStruct.methods {
-			_, ok := newServiceStruct.methodsMap[method.Name.Name]
-			if ok {
-				methods = append(methods, method)
-			}
-		}
-		for _, method := range methods {
-			zaplog.LOG.Debug("to sort", zap.String("method", method.Name.Name))
-		}
-		zaplog.SUG.Debugln("---")
-
-		if len(methods) == 0 {
-			// Use return instead of continue: single struct file is the common case
-			// 使用 return 而非 continue：单 struct 文件是常见情况
-			return // No methods to sort // 没有方法需要排序
-		}
-
-		ptx := printgo.NewPTX()
-
-		// Head block: code before first method (package, imports, struct, init)
-		// 头部块：第一个方法前的代码（包名、引用、结构体、初始化）
-		headNode := syntaxgo_astnode.NewNode(1, methods[0].Pos())
-		if methods[0].Doc != nil {
-			checkDocPos(methods[0])
-			headNode.SetEnd(methods[0].Doc.Pos()) // End at doc comment if exists // 有注释则截取到注释前
-		}
-		ptx.Println(syntaxgo_astnode.GetText(oldFile.code, headNode))
-
-		type MethodBlock struct {
-			Node *syntaxgo_astnode.Node
-			Name string
-		}
-
-		// Method blocks: each method with its code up to next method
-		// E.g., new has A/B and old has A/F/B, then A+F is one block, B is one block
-		//
-		// 方法代码块：每个方法及其代码直到下个方法
-		// 例如：新服务有 A/B，旧服务有 A/F/B，则 A+F 是一块，B 是一块
-		methodBlocks := make([]*MethodBlock, 0, len(methods))
-		for idx, method := range methods {
-			node := syntaxgo_astnode.NewNode(method.Pos(), token.Pos(1+len(oldFile.code)))
-			if method.Doc != nil {
-				checkDocPos(method)
-				node.SetPos(method.Doc.Pos()) // Start from doc comment if exists // 有注释则从注释位置开始
-			}
-
-			if nextIdx := idx + 1; nextIdx < len(methods) {
-				nextMethod := methods[nextIdx]
-				node.SetEnd(nextMethod.Pos()) // Next method start is current method end // 下个方法的起始位置即当前方法的结束位置
-				if nextMethod.Doc != nil {
-					checkDocPos(nextMethod)
-					node.SetEnd(nextMethod.Doc.Pos()) // Or next doc comment start // 或下个方法注释的起始位置
-				}
-			}
-
-			zaplog.SUG.Debugln(eroticgo.BLUE.Sprint(syntaxgo_astnode.GetText(oldFile.code, node)))
-
-			methodBlocks = append(methodBlocks, &MethodBlock{
-				Node: node,
-				Name: method.Name.Name,
-			})
-		}
-		must.Same(len(methods), len(methodBlocks))
-
-		compareLess := func(i, j int) bool {
-			a := methodBlocks[i]
-			b := methodBlocks[j]
-			idxA := newServiceStruct.methodsIdx[a.Name] // Index in new file (proto order) // 在新文件中的序号（proto 顺序）
-			idxB := newServiceStruct.methodsIdx[b.Name] // Index in new file // 在新文件中的序号
-			return idxA < idxB
-		}
-		if sort.SliceIsSorted(methodBlocks, compareLess) {
-			return // Skip if sorted // 已排序则跳过
-		}
-
-		sortx.SortByIndex(methodBlocks, compareLess)
-
-		// Concatenate sorted blocks
-		// 拼接排序后的代码块
-		for _, methodBlock := range methodBlocks {
-			ptx.Println(syntaxgo_astnode.GetText(oldFile.code, methodBlock.Node))
-		}
+// unexportMethods 使用 unexportedNames 选择的名称将已删除的方法转换为非导出
+// 返回改动后的代码和被重命名的方法
+func unexportMethods(oldFile *ServiceFile, removedMethods []*ast.FuncDecl, names map[*ast.FuncDecl]string) ([]byte, []*MethodRename) {
+	if len(removedMethods) == 0 {
+		return []byte{}, nil
+	}
 
-		// Format and write back
-		// 格式化并写回文件
-		utils.FormatAndWriteCode(oldFile.path, ptx.Bytes())
+	edits := make([]*textEdit, 0, len(removedMethods))
+	renames := make([]*MethodRename, 0, len(removedMethods))
+	for _, method := range removedMethods {
+		name := method.Name.Name
+		zaplog.LOG.Debug("convert to unexported", zap.String("name", name), zap.String("to", names[method]))
+		edits = append(edits, &textEdit{
+			pos:  method.Name.Pos(),
+			end:  method.Name.End(),
+			text: names[method],
+		})
+		renames = append(renames, &MethodRename{From: name, To: names[method]})
 	}
+	return applyTextEdits(oldFile.code, edits), renames
 }
 
 // checkDocPos validates doc comment position is before function declaration
@@ -697,9 +1123,21 @@ func checkDocPos(method *ast.FuncDecl) {
 
 // parseServiceFile parses Go service file and extracts struct and method info
 // parseServiceFile 解析 Go 服务文件并提取结构体和方法信息
-func parseServiceFile(path string) *ServiceFile {
-	code := rese.V1(os.ReadFile(path))
-	astBundle := rese.P1(syntaxgo_ast.NewAstBundleV1(code))
+func parseServiceFile(path string) (*ServiceFile, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newSyncError(ErrorKindReadFailure, path, err)
+	}
+	return parseServiceCode(path, code)
+}
+
+// parseServiceCode parses Go service code and extracts struct and method info
+// parseServiceCode 解析 Go 服务代码并提取结构体和方法信息
+func parseServiceCode(path string, code []byte) (*ServiceFile, error) {
+	astBundle, err := syntaxgo_ast.NewAstBundleV1(code)
+	if err != nil {
+		return nil, newSyncError(ErrorKindParseFailure, path, err)
+	}
 	astFile, _ := astBundle.GetBundle()
 	structTypes := syntaxgo_search.MapStructTypesByName(astFile)
 
@@ -730,8 +1168,9 @@ func parseServiceFile(path string) *ServiceFile {
 	return &ServiceFile{
 		path:             path,
 		code:             code,
+		astFile:          astFile,
 		serviceStructMap: serviceStructMap,
-	}
+	}, nil
 }
 
 // ServiceFile represents a parsed Go service file with its structs and methods
@@ -739,6 +1178,7 @@ func parseServiceFile(path string) *ServiceFile {
 type ServiceFile struct {
 	path             string                    // File path // 文件路径
 	code             []byte                    // Source code content // 源代码内容
+	astFile          *ast.File                 // Parsed AST file // 已解析的 AST 文件
 	serviceStructMap map[string]*ServiceStruct // Struct name to ServiceStruct map // 结构体名到 ServiceStruct 的映射
 }
 
@@ -1,8 +1,10 @@
 package synckratos
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -37,7 +39,8 @@ func (s *GreeterService) SayWorld(ctx context.Context, in *v1.HelloRequest) (*v1
 
 	// Test parseServiceFile
 	// 测试 parseServiceFile
-	serviceFile := parseServiceFile(testFile)
+	serviceFile, err := parseServiceFile(testFile)
+	require.NoError(t, err)
 	require.NotNil(t, serviceFile)
 	require.Equal(t, testFile, serviceFile.path)
 	require.NotEmpty(t, serviceFile.serviceStructMap)
@@ -92,15 +95,219 @@ func (s *GreeterService) SayWorld(ctx context.Context, in *v1.HelloRequest) (*v1
 
 	// Parse both files
 	// 解析两个文件
-	oldService := parseServiceFile(oldFile)
-	newService := parseServiceFile(newFile)
+	oldService := rese.P1(parseServiceFile(oldFile))
+	newService := rese.P1(parseServiceFile(newFile))
 
 	// Detect missing methods
 	// 检测缺失的方法
-	missingCode := searchMissingMethods(oldService, newService)
+	missingCode, names := searchMissingMethods(oldService, newService)
 	require.NotEmpty(t, missingCode)
+	require.Equal(t, []string{"SayWorld"}, names)
 
 	// Should contain SayWorld method
 	// 应该包含 SayWorld 方法
 	t.Log("Missing methods found:", missingCode)
 }
+
+// TestSyncServicesCodeDryRun tests dry-run records planned changes without writing service files
+// TestSyncServicesCodeDryRun 测试 dry-run 记录计划的变更而不写入服务文件
+func TestSyncServicesCodeDryRun(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_dry_run_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	oldServiceRoot := filepath.Join(tempRoot, "service")
+	newServiceRoot := filepath.Join(tempRoot, "staging")
+	must.Done(os.MkdirAll(oldServiceRoot, 0755))
+	must.Done(os.MkdirAll(newServiceRoot, 0755))
+
+	// Old service has SayHello and SayBye, proto removed SayBye
+	// 旧服务有 SayHello 和 SayBye，proto 删除了 SayBye
+	oldContent := `package service
+
+type GreeterService struct{}
+
+func (s *GreeterService) SayHello(ctx context.Context, in *v1.HelloRequest) (*v1.HelloReply, error) {}
+
+func (s *GreeterService) SayBye(ctx context.Context, in *v1.HelloRequest) (*v1.HelloReply, error) {}
+`
+	oldFile := filepath.Join(oldServiceRoot, "greeter.go")
+	must.Done(os.WriteFile(oldFile, []byte(oldContent), 0644))
+
+	// New service adds SayWorld before SayHello
+	// 新服务在 SayHello 前新增 SayWorld
+	newContent := `package service
+
+type GreeterService struct{}
+
+func (s *GreeterService) SayWorld(ctx context.Context, in *v1.HelloRequest) (*v1.WorldReply, error) {}
+
+func (s *GreeterService) SayHello(ctx context.Context, in *v1.HelloRequest) (*v1.HelloReply, error) {}
+`
+	must.Done(os.WriteFile(filepath.Join(newServiceRoot, "greeter.go"), []byte(newContent), 0644))
+
+	run := newSyncRun(tempRoot, &SyncOptions{DryRun: true})
+	run.stagingProtos["greeter.go"] = filepath.Join(tempRoot, "api/greeter.proto")
+	require.NoError(t, syncServicesCode(run, oldServiceRoot, newServiceRoot))
+	require.NoError(t, run.finish())
+	run.report.WriteText(os.Stdout)
+
+	// Source file stays untouched
+	// 源文件保持不变
+	require.Equal(t, oldContent, string(rese.V1(os.ReadFile(oldFile))))
+
+	require.True(t, run.report.DryRun)
+	require.True(t, run.report.HasChanges())
+	require.Len(t, run.report.Protos, 1)
+	require.Equal(t, "api/greeter.proto", run.report.Protos[0].Path)
+	require.Len(t, run.report.Protos[0].Files, 1)
+	change := run.report.Protos[0].Files[0]
+	require.Equal(t, "service/greeter.go", change.Path)
+	require.Equal(t, MatchedByFilename, change.MatchedBy)
+	require.Equal(t, []string{"SayWorld"}, change.Added)
+	require.Equal(t, []*MethodRename{{From: "SayBye", To: "sayBye"}}, change.Unexported)
+	require.True(t, change.Reordered)
+
+	code := string(rese.V1(run.store.read(oldFile)))
+	require.Contains(t, code, "func (s *GreeterService) sayBye(")
+	require.Less(t, strings.Index(code, "SayWorld"), strings.Index(code, "SayHello"))
+}
+
+// TestSyncServicesErrors tests errors returned instead of panics
+// TestSyncServicesErrors 测试返回错误而非 panic
+func TestSyncServicesErrors(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_errors_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	t.Run("path-not-found", func(t *testing.T) {
+		_, err := SyncServices(context.Background(), filepath.Join(tempRoot, "not-exist"), &SyncOptions{})
+		require.True(t, IsErrorKind(err, ErrorKindPathNotFound))
+
+		_, err = SyncServicesOnce(context.Background(), tempRoot, filepath.Join(tempRoot, "not-exist.proto"), &SyncOptions{})
+		require.True(t, IsErrorKind(err, ErrorKindPathNotFound))
+	})
+
+	t.Run("missing-tool", func(t *testing.T) {
+		// Proto with generated grpc code but no service file, sync needs kratos to create it
+		// 有生成的 grpc 代码但没有服务文件的 proto，同步需要 kratos 来创建服务
+		protoRoot := filepath.Join(tempRoot, "api/helloworld/v1")
+		must.Done(os.MkdirAll(protoRoot, 0755))
+		must.Done(os.MkdirAll(filepath.Join(tempRoot, "internal/service"), 0755))
+		must.Done(os.WriteFile(filepath.Join(protoRoot, "greeter.proto"), []byte("syntax = \"proto3\";\n\nservice Greeter {\n}\n"), 0644))
+		must.Done(os.WriteFile(filepath.Join(protoRoot, "greeter_grpc.pb.go"), []byte("package v1\n\ntype UnimplementedGreeterServer struct{}\n"), 0644))
+
+		t.Setenv("PATH", "")
+		_, err := SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, UseKratosCLI: true})
+		require.True(t, IsErrorKind(err, ErrorKindMissingTool))
+		t.Log(err)
+	})
+}
+
+// TestSyncServicesNative tests sync with native generation, no kratos CLI in PATH
+// TestSyncServicesNative 测试使用内置生成进行同步，PATH 中没有 kratos 命令行
+func TestSyncServicesNative(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_native_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	protoContent := `syntax = "proto3";
+
+package helloworld.v1;
+
+import "google/protobuf/empty.proto";
+
+option go_package = "demo/api/helloworld/v1;v1";
+
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+  rpc SayBye (google.protobuf.Empty) returns (google.protobuf.Empty);
+}
+
+service Stream {
+  rpc Chat (stream HelloRequest) returns (stream HelloReply);
+}
+`
+	oldContent := `package service
+
+import (
+	"context"
+
+	pb "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
+}
+`
+	protoPath := filepath.Join(tempRoot, "api/helloworld/v1/greeter.proto")
+	servicePath := filepath.Join(tempRoot, "internal/service/greeter.go")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	must.Done(os.MkdirAll(filepath.Dir(servicePath), 0755))
+	must.Done(os.WriteFile(protoPath, []byte(protoContent), 0644))
+	must.Done(os.WriteFile(servicePath, []byte(oldContent), 0644))
+
+	t.Setenv("PATH", "")
+	report, err := SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{})
+	require.NoError(t, err)
+	report.WriteText(os.Stdout)
+
+	require.Len(t, report.Protos, 1)
+	require.Equal(t, []string{"Greeter", "Stream"}, report.Protos[0].Services)
+
+	code := string(rese.V1(os.ReadFile(servicePath)))
+	require.Contains(t, code, "func (s *GreeterService) SayBye(ctx context.Context, req *emptypb.Empty) (*emptypb.Empty, error) {")
+	require.Contains(t, code, `"google.golang.org/protobuf/types/known/emptypb"`)
+	require.NotContains(t, code, "wrapperspb")
+
+	streamCode := string(rese.V1(os.ReadFile(filepath.Join(tempRoot, "internal/service/stream.go"))))
+	require.Contains(t, streamCode, "func (s *StreamService) Chat(conn pb.Stream_ChatServer) error {")
+}
+
+// TestSyncServicesRoots tests custom proto, service and staging DIRs
+// TestSyncServicesRoots 测试自定义的 proto、服务和暂存 DIR
+func TestSyncServicesRoots(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_roots_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	protoContent := `syntax = "proto3";
+
+package user.v1;
+
+option go_package = "demo/proto/user/v1;v1";
+
+service User {
+  rpc GetUser (GetUserRequest) returns (GetUserReply);
+}
+`
+	protoPath := filepath.Join(tempRoot, "proto/user/v1/user.proto")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	must.Done(os.WriteFile(protoPath, []byte(protoContent), 0644))
+
+	options := &SyncOptions{
+		ProtoRoot:   "proto",
+		ServiceRoot: "app/user/service/internal/service",
+		StagingRoot: ".staging",
+	}
+	report, err := SyncServices(context.Background(), tempRoot, options)
+	require.NoError(t, err)
+	require.Equal(t, "proto/user/v1/user.proto", report.Protos[0].Path)
+	require.Equal(t, "app/user/service/internal/service/user.go", report.Protos[0].Files[0].Path)
+	require.FileExists(t, filepath.Join(tempRoot, "app/user/service/internal/service/user.go"))
+
+	// Staging DIR of the run is removed
+	// 本次同步的暂存 DIR 已删除
+	require.Empty(t, rese.V1(os.ReadDir(filepath.Join(tempRoot, ".staging"))))
+
+	_, err = SyncServices(context.Background(), tempRoot, &SyncOptions{ProtoRoot: "not-exist"})
+	require.True(t, IsErrorKind(err, ErrorKindPathNotFound))
+}
@@ -0,0 +1,210 @@
+package synckratos
+
+import (
+	"go/ast"
+	"strings"
+
+	"github.com/yyle88/syntaxgo/syntaxgo_astnode"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// updateMethodSignatures rewrites param and result types of methods whose proto types changed
+// Keeps param names and method body, uses package names imported in old file
+// Skips methods whose RPC switched between unary and streaming, see flagSwitchedMethods
+// Returns changed code and names of methods with rewritten signatures
+//
+// updateMethodSignatures 重写 proto 类型变化的方法的参数和返回值类型
+// 保留参数名和方法体，使用旧文件中导入的包名
+// 跳过 RPC 在一元和流式之间切换的方法，参见 flagSwitchedMethods
+// 返回改动后的代码和签名被重写的方法名
+func updateMethodSignatures(oldFile *ServiceFile, newFile *ServiceFile) ([]byte, []string, error) {
+	newImportPaths := importPathMap(newFile.astFile)
+	oldImportNames := importNameMap(oldFile.astFile)
+	rename := importRenameMap(oldFile, newFile)
+
+	var edits []*textEdit
+	var names []string
+	var newExprs []ast.Node // New type exprs copied into old file // 复制到旧文件中的新类型表达式
+	for structName, newServiceStruct := range newFile.serviceStructMap {
+		oldServiceStruct := findOldStruct(oldFile, newFile, structName)
+		if oldServiceStruct == nil {
+			continue
+		}
+		for _, newMethod := range newServiceStruct.methods {
+			oldMethod, ok := oldServiceStruct.methodsMap[newMethod.Name.Name]
+			if !ok {
+				continue
+			}
+			// Switched RPC kinds are flagged for manual migration, rewriting the signature would break the body
+			// 切换了 RPC 类型的方法会被标记为手动迁移，重写签名会破坏方法体
+			if !sameRPCKind(goMethodKind(oldMethod), goMethodKind(newMethod)) {
+				continue
+			}
+			paramEdits, paramExprs := diffParams(oldFile, newFile, oldMethod.Type, newMethod.Type, rename)
+			resultEdits, resultExprs := diffResults(oldFile, newFile, oldMethod.Type, newMethod.Type, rename)
+			if len(paramEdits)+len(resultEdits) == 0 {
+				continue
+			}
+			zaplog.LOG.Debug("update signature", zap.String("struct", structName), zap.String("method", newMethod.Name.Name))
+			edits = append(edits, paramEdits...)
+			edits = append(edits, resultEdits...)
+			newExprs = append(newExprs, paramExprs...)
+			newExprs = append(newExprs, resultExprs...)
+			names = append(names, newMethod.Name.Name)
+		}
+	}
+	if len(edits) == 0 {
+		return []byte{}, nil, nil
+	}
+
+	// Import packages used in new types but missing in old file
+	// 导入新类型中用到但旧文件中缺失的包
+	missingImports := make(map[string]string)
+	for _, expr := range newExprs {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			if selectorExpr, ok := node.(*ast.SelectorExpr); ok {
+				if ident, ok := selectorExpr.X.(*ast.Ident); ok {
+					if path, ok := newImportPaths[ident.Name]; ok {
+						if _, ok := oldImportNames[path]; !ok {
+							missingImports[path] = ident.Name
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	changedCode, err := addNamedImports(applyTextEdits(oldFile.code, edits), missingImports)
+	if err != nil {
+		return nil, nil, newSyncError(ErrorKindParseFailure, oldFile.path, err)
+	}
+	return changedCode, names, nil
+}
+
+// diffParams compares params of old and new method, returns edits on old code
+// Same shape: replaces changed types one by one, keeps param names
+// Other shape: replaces the whole param list with the new one
+//
+// diffParams 比较新旧方法的参数，返回对旧代码的编辑
+// 结构相同：逐个替换变化的类型，保留参数名
+// 结构不同：用新的参数列表替换整个参数列表
+func diffParams(oldFile *ServiceFile, newFile *ServiceFile, oldType *ast.FuncType, newType *ast.FuncType, rename map[string]string) ([]*textEdit, []ast.Node) {
+	if sameFieldShape(oldType.Params, newType.Params) {
+		return diffFieldTypes(oldFile, newFile, oldType.Params, newType.Params, rename)
+	}
+	return []*textEdit{{
+		pos:  oldType.Params.Pos(),
+		end:  oldType.Params.End(),
+		text: qualifyExprText(newFile.code, newType.Params, rename),
+	}}, []ast.Node{newType.Params}
+}
+
+// diffResults compares results of old and new method, returns edits on old code
+// diffResults 比较新旧方法的返回值，返回对旧代码的编辑
+func diffResults(oldFile *ServiceFile, newFile *ServiceFile, oldType *ast.FuncType, newType *ast.FuncType, rename map[string]string) ([]*textEdit, []ast.Node) {
+	switch {
+	case oldType.Results == nil && newType.Results == nil:
+		return nil, nil
+	case sameFieldShape(oldType.Results, newType.Results):
+		return diffFieldTypes(oldFile, newFile, oldType.Results, newType.Results, rename)
+	case oldType.Results == nil:
+		return []*textEdit{{
+			pos:  oldType.Params.End(),
+			end:  oldType.Params.End(),
+			text: " " + qualifyExprText(newFile.code, newType.Results, rename),
+		}}, []ast.Node{newType.Results}
+	case newType.Results == nil:
+		return []*textEdit{{
+			pos:  oldType.Params.End(),
+			end:  oldType.Results.End(),
+			text: "",
+		}}, nil
+	default:
+		return []*textEdit{{
+			pos:  oldType.Results.Pos(),
+			end:  oldType.Results.End(),
+			text: qualifyExprText(newFile.code, newType.Results, rename),
+		}}, []ast.Node{newType.Results}
+	}
+}
+
+// diffFieldTypes replaces types of old fields that differ from new fields
+// diffFieldTypes 替换与新字段不同的旧字段类型
+func diffFieldTypes(oldFile *ServiceFile, newFile *ServiceFile, oldList *ast.FieldList, newList *ast.FieldList, rename map[string]string) ([]*textEdit, []ast.Node) {
+	var edits []*textEdit
+	var newExprs []ast.Node
+	for idx, oldField := range oldList.List {
+		newField := newList.List[idx]
+		newText := qualifyExprText(newFile.code, newField.Type, rename)
+		oldText := syntaxgo_astnode.GetText(oldFile.code, oldField.Type)
+		if compactText(newText) == compactText(oldText) {
+			continue
+		}
+		edits = append(edits, &textEdit{
+			pos:  oldField.Type.Pos(),
+			end:  oldField.Type.End(),
+			text: newText,
+		})
+		newExprs = append(newExprs, newField.Type)
+	}
+	return edits, newExprs
+}
+
+// sameFieldShape checks if two field lists have same count of fields and names
+// sameFieldShape 检查两个字段列表的字段数量和名称数量是否相同
+func sameFieldShape(oldList *ast.FieldList, newList *ast.FieldList) bool {
+	if oldList == nil || newList == nil {
+		return oldList == nil && newList == nil
+	}
+	if len(oldList.List) != len(newList.List) {
+		return false
+	}
+	for idx, oldField := range oldList.List {
+		if len(oldField.Names) != len(newList.List[idx].Names) {
+			return false
+		}
+	}
+	return true
+}
+
+// compactText removes blanks, so format differences do not count as changes
+// compactText 删除空白字符，使格式差异不算作变化
+func compactText(text string) string {
+	return strings.Join(strings.Fields(text), "")
+}
+
+// importRenameMap switches package names of new file to the ones in old file, matched via import path
+// importRenameMap 通过导入路径匹配，将新文件的包名切换为旧文件中的包名
+func importRenameMap(oldFile *ServiceFile, newFile *ServiceFile) map[string]string {
+	oldImportNames := importNameMap(oldFile.astFile)
+	rename := make(map[string]string)
+	for name, path := range importPathMap(newFile.astFile) {
+		if oldName, ok := oldImportNames[path]; ok {
+			rename[name] = oldName
+		}
+	}
+	return rename
+}
+
+// findOldStruct finds struct in old file matching struct in new file
+// Matches via name first, then via mask type
+//
+// findOldStruct 在旧文件中查找与新文件 struct 匹配的 struct
+// 首先按名字匹配，然后按嵌入类型匹配
+func findOldStruct(oldFile *ServiceFile, newFile *ServiceFile, structName string) *ServiceStruct {
+	if serviceStruct, ok := oldFile.serviceStructMap[structName]; ok {
+		return serviceStruct
+	}
+	newMaskType := buildStructMaskMap(newFile)[structName]
+	if newMaskType == "" {
+		return nil
+	}
+	for oldName, oldMask := range buildStructMaskMap(oldFile) {
+		if oldMask == newMaskType {
+			return oldFile.serviceStructMap[oldName]
+		}
+	}
+	return nil
+}
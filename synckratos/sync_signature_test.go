@@ -0,0 +1,84 @@
+package synckratos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestUpdateMethodSignatures tests rewriting method signatures when proto types change
+// TestUpdateMethodSignatures 测试 proto 类型变化时重写方法签名
+func TestUpdateMethodSignatures(t *testing.T) {
+	// Old service uses pb alias and custom param names
+	// 旧服务使用 pb 别名和自定义参数名
+	oldContent := `package service
+
+import (
+	"context"
+
+	pb "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
+}
+
+func (s *GreeterService) SayWorld(ctx context.Context, req *pb.WorldRequest) (*pb.WorldReply, error) {
+	return &pb.WorldReply{}, nil
+}
+`
+	// New service changes SayHello request and reply types, imports emptypb
+	// 新服务改变 SayHello 的请求和响应类型，并导入 emptypb
+	newContent := `package service
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	v1 "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	v1.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, in *v1.HelloParam) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GreeterService) SayWorld(ctx context.Context, in *v1.WorldRequest) (*v1.WorldReply, error) {
+	return &v1.WorldReply{}, nil
+}
+`
+	oldFile, err := parseServiceCode("old_greeter.go", []byte(oldContent))
+	require.NoError(t, err)
+	newFile, err := parseServiceCode("new_greeter.go", []byte(newContent))
+	require.NoError(t, err)
+
+	changedCode, names, err := updateMethodSignatures(oldFile, newFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{"SayHello"}, names)
+
+	result := string(changedCode)
+	t.Log(result)
+	// Param name and body kept, types switched to pb alias
+	// 保留参数名和方法体，类型切换为 pb 别名
+	require.Contains(t, result, "SayHello(ctx context.Context, req *pb.HelloParam) (*emptypb.Empty, error)")
+	require.Contains(t, result, "return &pb.HelloReply{Message: req.Name}, nil")
+	require.Contains(t, result, `"google.golang.org/protobuf/types/known/emptypb"`)
+	require.Contains(t, result, "SayWorld(ctx context.Context, req *pb.WorldRequest) (*pb.WorldReply, error)")
+
+	// No changes when signatures match
+	// 签名一致时没有变化
+	sameFile, err := parseServiceCode("new_greeter.go", changedCode)
+	require.NoError(t, err)
+	changedCode, names, err = updateMethodSignatures(sameFile, newFile)
+	require.NoError(t, err)
+	require.Empty(t, changedCode)
+	require.Empty(t, names)
+}
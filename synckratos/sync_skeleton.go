@@ -0,0 +1,243 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// testSkeletonTemplate generates one table-driven test per method, skipped until cases are written
+// Unary methods get request and reply fields, streaming ones only the case name
+//
+// testSkeletonTemplate 为每个方法生成一个表驱动测试，在编写用例前跳过
+// 一元方法带有请求和响应字段，流式方法只有用例名称
+const testSkeletonTemplate = `{{ range . }}
+func {{ .Name }}(t *testing.T) {
+	t.Skip("TODO")
+	tests := []struct {
+		name    string
+		{{- if .Unary }}
+		req     {{ .Request }}
+		want    {{ .Reply }}
+		{{- end }}
+		wantErr bool
+	}{
+		// TODO: add test cases
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &{{ .Struct }}{}
+			{{- if .Unary }}
+			got, err := s.{{ .Method }}(context.Background(), tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("{{ .Method }}() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("{{ .Method }}() = %v, want %v", got, tt.want)
+			}
+			{{- else }}
+			// TODO: call s.{{ .Method }} with a stream
+			_ = s
+			{{- end }}
+		})
+	}
+}
+{{ end }}`
+
+// testSkeleton is the data of one test in testSkeletonTemplate
+// testSkeleton 是 testSkeletonTemplate 中单个测试的数据
+type testSkeleton struct {
+	Name    string // Test function name, e.g. "TestGreeterService_SayHello" // 测试函数名，例如 "TestGreeterService_SayHello"
+	Struct  string // Service struct name // 服务 struct 名
+	Method  string // Method name // 方法名
+	Unary   bool   // Method takes context and request, returns reply and error // 方法接收 context 和请求，返回响应和错误
+	Request string // Request type text, e.g. "*v1.HelloRequest" // 请求类型文本，例如 "*v1.HelloRequest"
+	Reply   string // Reply type text, e.g. "*v1.HelloReply" // 响应类型文本，例如 "*v1.HelloReply"
+}
+
+// writeTestSkeletons creates or extends <service>_test.go of each synced service file
+// Adds a test per method added in this sync, or per method of created service files
+// Test functions follow methods renamed or unexported in this sync
+//
+// writeTestSkeletons 创建或扩展每个已同步服务文件的 <service>_test.go
+// 为本次同步新增的每个方法，或新建服务文件的每个方法添加测试
+// 测试函数跟随本次同步中重命名或非导出的方法
+func (run *syncRun) writeTestSkeletons() error {
+	for _, proto := range run.report.Protos {
+		for _, change := range proto.Files {
+			renames := slices.Concat(change.Renamed, change.Unexported)
+			if !change.Created && len(change.Added) == 0 && len(renames) == 0 {
+				continue
+			}
+			path := filepath.Join(run.projectRoot, filepath.FromSlash(change.Path))
+			svcFile, err := run.parseStoreFile(path)
+			if err != nil {
+				return err
+			}
+			var methods []*ast.FuncDecl
+			for _, decl := range svcFile.astFile.Decls {
+				method, ok := decl.(*ast.FuncDecl)
+				if !ok || method.Recv == nil || svcFile.serviceStructMap[receiverName(method)] == nil {
+					continue
+				}
+				if (change.Created && method.Name.IsExported()) || slices.Contains(change.Added, method.Name.Name) {
+					methods = append(methods, method)
+				}
+			}
+			if len(methods) == 0 && len(renames) == 0 {
+				continue
+			}
+
+			testPath := strings.TrimSuffix(path, ".go") + "_test.go"
+			testCode := []byte("package " + svcFile.astFile.Name.Name + "\n")
+			exists := run.store.exists(testPath)
+			if exists {
+				if testCode, err = run.store.read(testPath); err != nil {
+					return err
+				}
+			}
+			newCode, tests, testRenames, err := testSkeletonCode(testCode, svcFile, methods, renames)
+			if err != nil {
+				return newSyncError(ErrorKindParseFailure, testPath, err)
+			}
+			if len(tests) == 0 && len(testRenames) == 0 {
+				continue
+			}
+			if exists {
+				err = run.store.write(testPath, newCode)
+			} else {
+				run.store.create(testPath, newCode)
+			}
+			if err != nil {
+				return err
+			}
+			change.Tests = append(change.Tests, tests...)
+			change.TestRenames = append(change.TestRenames, testRenames...)
+			zaplog.LOG.Debug("synced test skeletons", zap.String("file", filepath.Base(testPath)), zap.Strings("tests", tests))
+		}
+	}
+	return nil
+}
+
+// testSkeletonCode renames tests of renamed methods in test code, then appends tests of methods without one
+// Test of method M on struct S is named TestS_M, calls of M in its body are renamed too
+// Skips test code of another package, e.g. "service_test", which cannot reach unexported methods
+// Returns changed code, added tests and renamed tests
+//
+// testSkeletonCode 在测试代码中重命名已改名方法的测试，然后为没有测试的方法追加测试
+// struct S 的方法 M 的测试名为 TestS_M，其函数体中对 M 的调用也会被重命名
+// 跳过其它包的测试代码，例如 "service_test"，其无法访问非导出方法
+// 返回改动后的代码、新增的测试和重命名的测试
+func testSkeletonCode(testCode []byte, svcFile *ServiceFile, methods []*ast.FuncDecl, renames []*MethodRename) ([]byte, []string, []*MethodRename, error) {
+	astFile, err := parser.ParseFile(token.NewFileSet(), "", testCode, parser.ParseComments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if astFile.Name.Name != svcFile.astFile.Name.Name {
+		zaplog.LOG.Warn("test file of another package, skip test skeletons", zap.String("package", astFile.Name.Name))
+		return testCode, nil, nil, nil
+	}
+	testNames := make(map[string]bool)
+	for _, decl := range astFile.Decls {
+		if function, ok := decl.(*ast.FuncDecl); ok && function.Recv == nil {
+			testNames[function.Name.Name] = true
+		}
+	}
+
+	// Rename tests in lockstep with methods
+	// 与方法同步重命名测试
+	var edits []*textEdit
+	testRenames := []*MethodRename{}
+	for _, decl := range astFile.Decls {
+		function, ok := decl.(*ast.FuncDecl)
+		if !ok || function.Recv != nil {
+			continue
+		}
+		for _, rename := range renames {
+			structName, ok := strings.CutPrefix(function.Name.Name, "Test")
+			if !ok || !strings.HasSuffix(structName, "_"+rename.From) {
+				continue
+			}
+			structName = strings.TrimSuffix(structName, "_"+rename.From)
+			newName := "Test" + structName + "_" + rename.To
+			if svcFile.serviceStructMap[structName] == nil || testNames[newName] {
+				continue
+			}
+			testNames[newName] = true
+			edits = append(edits, &textEdit{pos: function.Name.Pos(), end: function.Name.End(), text: newName})
+			if function.Body != nil {
+				ast.Inspect(function.Body, func(node ast.Node) bool {
+					if selectorExpr, ok := node.(*ast.SelectorExpr); ok && selectorExpr.Sel.Name == rename.From {
+						edits = append(edits, &textEdit{pos: selectorExpr.Sel.Pos(), end: selectorExpr.Sel.End(), text: rename.To})
+					}
+					return true
+				})
+			}
+			testRenames = append(testRenames, &MethodRename{From: function.Name.Name, To: newName})
+		}
+	}
+	code := applyTextEdits(testCode, edits)
+
+	// Append tests of methods without one, with imports their types need
+	// 为没有测试的方法追加测试，并添加其类型所需的导入
+	var skeletons []*testSkeleton
+	tests := []string{}
+	imports := map[string]string{"testing": "testing"}
+	pkgPaths := importPathMap(svcFile.astFile)
+	for _, method := range methods {
+		skeleton := &testSkeleton{
+			Name:   "Test" + receiverName(method) + "_" + method.Name.Name,
+			Struct: receiverName(method),
+			Method: method.Name.Name,
+		}
+		if testNames[skeleton.Name] {
+			continue
+		}
+		testNames[skeleton.Name] = true
+		params, results := method.Type.Params.List, method.Type.Results
+		if len(params) == 2 && len(params[0].Names) <= 1 && getTypeName(svcFile.code, params[0].Type) == "context.Context" && results != nil && len(results.List) == 2 {
+			skeleton.Unary = true
+			skeleton.Request = getTypeName(svcFile.code, params[1].Type)
+			skeleton.Reply = getTypeName(svcFile.code, results.List[0].Type)
+			imports["context"] = "context"
+			imports["reflect"] = "reflect"
+			for _, expr := range []ast.Expr{params[1].Type, results.List[0].Type} {
+				ast.Inspect(expr, func(node ast.Node) bool {
+					if selectorExpr, ok := node.(*ast.SelectorExpr); ok {
+						if ident, ok := selectorExpr.X.(*ast.Ident); ok && pkgPaths[ident.Name] != "" {
+							imports[pkgPaths[ident.Name]] = ident.Name
+						}
+						return false
+					}
+					return true
+				})
+			}
+		}
+		skeletons = append(skeletons, skeleton)
+		tests = append(tests, skeleton.Name)
+	}
+	if len(skeletons) == 0 {
+		return code, tests, testRenames, nil
+	}
+	tmpl, err := template.New("test").Parse(testSkeletonTemplate)
+	if err != nil {
+		return nil, nil, nil, erero.Wro(err)
+	}
+	skeletonCode, err := executeTemplate(tmpl, skeletons)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	newCode, err := addNamedImports([]byte(strings.TrimRight(string(code), "\n")+"\n"+string(skeletonCode)), imports)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return newCode, tests, testRenames, nil
+}
@@ -0,0 +1,183 @@
+package synckratos
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestTestSkeletonCode tests appending test skeletons and renaming tests with their methods
+// TestTestSkeletonCode 测试追加测试骨架以及随方法重命名测试
+func TestTestSkeletonCode(t *testing.T) {
+	svcFile := rese.P1(parseServiceCode("greeter.go", []byte(`package service
+
+import (
+	"context"
+
+	pb "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{}, nil
+}
+
+func (s *GreeterService) StreamHello(stream pb.Greeter_StreamHelloServer) error {
+	return nil
+}
+`)))
+	methods := svcFile.serviceStructMap["GreeterService"].methods
+
+	testCode := `package service
+
+import "testing"
+
+func TestGreeterService_OldHello(t *testing.T) {
+	s := &GreeterService{}
+	_, _ = s.OldHello(nil, nil)
+}
+`
+	newCode, tests, testRenames, err := testSkeletonCode([]byte(testCode), svcFile, methods, []*MethodRename{{From: "OldHello", To: "oldHello"}})
+	require.NoError(t, err)
+	t.Log(string(newCode))
+	require.Equal(t, []string{"TestGreeterService_SayHello", "TestGreeterService_StreamHello"}, tests)
+	require.Equal(t, []*MethodRename{{From: "TestGreeterService_OldHello", To: "TestGreeterService_oldHello"}}, testRenames)
+	require.Contains(t, string(newCode), "func TestGreeterService_oldHello(t *testing.T) {\n\ts := &GreeterService{}\n\t_, _ = s.oldHello(nil, nil)\n}")
+	require.Contains(t, string(newCode), "\t\treq     *pb.HelloRequest\n\t\twant    *pb.HelloReply\n")
+	require.Contains(t, string(newCode), "got, err := s.SayHello(context.Background(), tt.req)")
+	require.Contains(t, string(newCode), "// TODO: call s.StreamHello with a stream")
+	require.Contains(t, string(newCode), `pb "demo/api/helloworld/v1"`)
+	require.Contains(t, string(newCode), `"reflect"`)
+	_, err = parser.ParseFile(token.NewFileSet(), "", newCode, 0)
+	require.NoError(t, err)
+
+	// Existing tests are kept as they are
+	// 已有的测试保持不变
+	sameCode, tests, testRenames, err := testSkeletonCode(newCode, svcFile, methods, nil)
+	require.NoError(t, err)
+	require.Empty(t, tests)
+	require.Empty(t, testRenames)
+	require.Equal(t, string(newCode), string(sameCode))
+
+	// Tests of another package are skipped
+	// 跳过其它包的测试
+	_, tests, _, err = testSkeletonCode([]byte("package service_test\n"), svcFile, methods, nil)
+	require.NoError(t, err)
+	require.Empty(t, tests)
+}
+
+// TestSyncServicesTestSkeletons tests test skeletons of created files and added methods, and tests renamed with unexported methods
+// TestSyncServicesTestSkeletons 测试新建文件和新增方法的测试骨架，以及随非导出方法重命名的测试
+func TestSyncServicesTestSkeletons(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_skeleton_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	writeFile := func(path string, content string) {
+		path = filepath.Join(tempRoot, path)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+	}
+	readFile := func(path string) string {
+		return string(rese.V1(os.ReadFile(filepath.Join(tempRoot, path))))
+	}
+	writeFile("api/helloworld/v1/greeter.proto", `syntax = "proto3";
+package helloworld.v1;
+option go_package = "demo/api/helloworld/v1;v1";
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+  rpc SayBye (ByeRequest) returns (ByeReply);
+}
+message HelloRequest {}
+message HelloReply {}
+message ByeRequest {}
+message ByeReply {}
+`)
+	writeFile("api/user/v1/user.proto", `syntax = "proto3";
+package user.v1;
+option go_package = "demo/api/user/v1;v1";
+service User {
+  rpc GetUser (GetUserRequest) returns (GetUserReply);
+}
+message GetUserRequest {}
+message GetUserReply {}
+`)
+	writeFile("internal/service/greeter.go", `package service
+
+import (
+	"context"
+
+	v1 "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	v1.UnimplementedGreeterServer
+}
+
+func NewGreeterService() *GreeterService {
+	return &GreeterService{}
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *v1.HelloRequest) (*v1.HelloReply, error) {
+	return &v1.HelloReply{}, nil
+}
+
+func (s *GreeterService) OldCall(ctx context.Context, req *v1.HelloRequest) (*v1.HelloReply, error) {
+	return &v1.HelloReply{}, nil
+}
+`)
+	writeFile("internal/service/greeter_test.go", `package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGreeterService_OldCall(t *testing.T) {
+	s := NewGreeterService()
+	_, _ = s.OldCall(context.Background(), nil)
+}
+`)
+
+	report, err := SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, TestSkeletons: true})
+	require.NoError(t, err)
+	report.WriteText(os.Stdout)
+	changes := map[string]*FileChange{}
+	for _, proto := range report.Protos {
+		for _, change := range proto.Files {
+			changes[change.Path] = change
+		}
+	}
+	require.Equal(t, []string{"TestGreeterService_SayBye"}, changes["internal/service/greeter.go"].Tests)
+	require.Equal(t, []*MethodRename{{From: "TestGreeterService_OldCall", To: "TestGreeterService_oldCall"}}, changes["internal/service/greeter.go"].TestRenames)
+	require.Equal(t, []string{"TestUserService_GetUser"}, changes["internal/service/user.go"].Tests)
+
+	code := readFile("internal/service/greeter_test.go")
+	t.Log(code)
+	require.Contains(t, code, "func TestGreeterService_oldCall(t *testing.T) {\n\ts := NewGreeterService()\n\t_, _ = s.oldCall(context.Background(), nil)\n}")
+	require.Contains(t, code, "func TestGreeterService_SayBye(t *testing.T) {\n\tt.Skip(\"TODO\")\n")
+	require.Contains(t, code, "\t\treq     *v1.ByeRequest\n")
+	require.Contains(t, code, `v1 "demo/api/helloworld/v1"`)
+	require.NotContains(t, code, "TestGreeterService_SayHello")
+	code = readFile("internal/service/user_test.go")
+	t.Log(code)
+	require.Contains(t, code, "got, err := s.GetUser(context.Background(), tt.req)")
+	require.Contains(t, code, `"demo/api/user/v1"`)
+
+	// Nothing changes once tests are in place
+	// 测试就位后不再有变更
+	report, err = SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, TestSkeletons: true})
+	require.NoError(t, err)
+	require.False(t, report.HasChanges())
+}
@@ -0,0 +1,249 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/yyle88/eroticgo"
+	"github.com/yyle88/sortx"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// codeBlock is code of a method or struct with its post code, moved as one piece when sorting
+// codeBlock 是方法或 struct 及其后续代码，排序时作为整体移动
+type codeBlock struct {
+	owner string    // Struct owning the block, blocks only move among ones of same owner // 代码块所属的 struct，只在同一 struct 的代码块之间移动
+	order int       // Index in proto sequence // 在 proto 顺序中的序号
+	pos   token.Pos // Start, at doc comment if exists // 起始位置，有文档注释时从注释开始
+	end   token.Pos // End, at start of next block or EOF // 结束位置，为下一代码块的起始位置或文件末尾
+}
+
+// sortServiceMethods sorts methods of each service struct in file to match proto definition sequence
+// Treats each method with its post code as a block, e.g. new has A/B and old has A/F/B, then A+F is one block
+// A block stops at type declarations and methods of other structs, so structs sharing a file keep their own code
+// Blocks of each struct are placed together at its first method, in proto sequence
+// In mask mode, match structs via mask type
+// Returns sorted code, empty when nothing to sort
+//
+// sortServiceMethods 按 proto 定义顺序排序文件中每个服务 struct 的方法
+// 把每个方法及其后续代码作为代码块，例如新服务有 A/B，旧服务有 A/F/B，则 A+F 是一块
+// 代码块在类型声明和其它 struct 的方法处结束，使共用文件的 struct 保留各自的代码
+// 每个 struct 的代码块按 proto 顺序集中放在其第一个方法的位置
+// 在 mask 模式下，按嵌入类型匹配 struct
+// 返回排序后的代码，无需排序时返回空
+func sortServiceMethods(oldFile *ServiceFile, newFile *ServiceFile) []byte {
+	// Methods to sort, with index in new file (proto order)
+	// 需要排序的方法，及其在新文件中的序号（proto 顺序）
+	orders := make(map[*ast.FuncDecl]int)
+	for structName, newServiceStruct := range newFile.serviceStructMap {
+		oldServiceStruct := findOldStruct(oldFile, newFile, structName)
+		if oldServiceStruct == nil {
+			continue
+		}
+		zaplog.LOG.Debug("sort methods", zap.String("struct", structName))
+		for _, method := range oldServiceStruct.methods {
+			if idx, ok := newServiceStruct.methodsIdx[method.Name.Name]; ok {
+				zaplog.LOG.Debug("to sort", zap.String("method", method.Name.Name))
+				orders[method] = idx
+			}
+		}
+	}
+	if len(orders) == 0 {
+		return []byte{} // No methods to sort // 没有方法需要排序
+	}
+
+	var blocks []*codeBlock
+	decls := oldFile.astFile.Decls
+	for idx := 0; idx < len(decls); idx++ {
+		method, ok := decls[idx].(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		order, ok := orders[method]
+		if !ok {
+			continue
+		}
+		block := &codeBlock{owner: receiverName(method), order: order, pos: declPos(method), end: token.Pos(1 + len(oldFile.code))}
+		// Post code: unsorted methods of same struct and non-type declarations, e.g. helper functions
+		// 后续代码：同一 struct 中无需排序的方法，以及非类型声明，例如辅助函数
+		for idx+1 < len(decls) && !stopsMethodBlock(decls[idx+1], block.owner, orders) {
+			idx++
+		}
+		if idx+1 < len(decls) {
+			block.end = declPos(decls[idx+1])
+		}
+		zaplog.SUG.Debugln(eroticgo.BLUE.Sprint(string(oldFile.code[block.pos-1 : block.end-1])))
+		blocks = append(blocks, block)
+	}
+
+	// Group blocks of each struct, skip when each group is together and sorted
+	// 按 struct 分组代码块，每组都相邻且有序时跳过
+	groups := make(map[string][]*codeBlock)
+	sorted := true
+	for idx, block := range blocks {
+		group := groups[block.owner]
+		if len(group) > 0 && (blocks[idx-1] != group[len(group)-1] || blocks[idx-1].end != block.pos || group[len(group)-1].order > block.order) {
+			sorted = false
+		}
+		groups[block.owner] = append(group, block)
+	}
+	if sorted {
+		return []byte{} // Skip if sorted // 已排序则跳过
+	}
+	for _, group := range groups {
+		sortx.SortByIndex(group, func(i, j int) bool {
+			return group[i].order < group[j].order
+		})
+	}
+
+	// Place each group at its first block, keep code between blocks in place
+	// 将每组放在其第一个代码块的位置，代码块之间的代码保持不动
+	var code strings.Builder
+	cursor := token.Pos(1)
+	placed := make(map[string]bool)
+	for _, block := range blocks {
+		code.Write(oldFile.code[cursor-1 : block.pos-1])
+		cursor = block.end
+		if placed[block.owner] {
+			continue
+		}
+		placed[block.owner] = true
+		for _, sortedBlock := range groups[block.owner] {
+			code.WriteString(blockText(oldFile.code, sortedBlock))
+		}
+	}
+	code.Write(oldFile.code[cursor-1:])
+	// Keep sorted code, caller formats and writes back
+	// 保存排序后的代码，由调用方格式化并写回
+	return []byte(code.String())
+}
+
+// stopsMethodBlock checks if declaration ends method block of owner
+// Type declarations, methods to sort and methods of other structs end it
+//
+// stopsMethodBlock 检查声明是否结束 owner 的方法代码块
+// 类型声明、需要排序的方法和其它 struct 的方法会结束代码块
+func stopsMethodBlock(decl ast.Decl, owner string, orders map[*ast.FuncDecl]int) bool {
+	switch decl := decl.(type) {
+	case *ast.GenDecl:
+		return decl.Tok == token.TYPE
+	case *ast.FuncDecl:
+		if decl.Recv == nil {
+			return false
+		}
+		_, ok := orders[decl]
+		return ok || receiverName(decl) != owner
+	}
+	return false
+}
+
+// sortServiceStructs sorts service structs in file to match service sequence in proto
+// Each struct with its post code (constructor, methods) up to next service struct is a block
+// Structs not defined in proto stay in place, skips when methods of a struct live outside its block
+// Returns sorted code, empty when nothing to sort
+//
+// sortServiceStructs 按 proto 中的服务顺序排序文件中的服务 struct
+// 每个 struct 及其后续代码（构造函数、方法）直到下一个服务 struct 为一个代码块
+// proto 中未定义的 struct 保持不动，某个 struct 的方法位于其代码块之外时跳过
+// 返回排序后的代码，无需排序时返回空
+func sortServiceStructs(oldFile *ServiceFile, file *protoFile) []byte {
+	serviceIdx := make(map[string]int, len(file.services))
+	for idx, service := range file.services {
+		serviceIdx[goCamelCase(service.name)] = idx
+	}
+	maskMap := buildStructMaskMap(oldFile)
+
+	// Block starts at each service struct, ones not in proto only end blocks
+	// 代码块从每个服务 struct 开始，不在 proto 中的 struct 只用于结束代码块
+	var blocks []*codeBlock
+	var ends []token.Pos
+	for _, decl := range oldFile.astFile.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			structName := spec.(*ast.TypeSpec).Name.Name
+			maskType, isService := maskMap[structName]
+			serviceName := strings.TrimSuffix(strings.TrimPrefix(maskType, "Unimplemented"), "Server")
+			if !isService {
+				serviceName = strings.TrimSuffix(structName, "Service")
+			}
+			if order, ok := serviceIdx[serviceName]; ok {
+				if len(genDecl.Specs) > 1 {
+					zaplog.LOG.Debug("struct in grouped type declaration, skip sorting structs", zap.String("struct", structName))
+					return []byte{}
+				}
+				blocks = append(blocks, &codeBlock{owner: structName, order: order, pos: declPos(genDecl)})
+				ends = append(ends, declPos(genDecl))
+			} else if isService {
+				ends = append(ends, declPos(genDecl))
+			}
+		}
+	}
+	if len(blocks) < 2 {
+		return []byte{}
+	}
+	for _, block := range blocks {
+		block.end = token.Pos(1 + len(oldFile.code))
+		if idx := sort.Search(len(ends), func(i int) bool { return ends[i] > block.pos }); idx < len(ends) {
+			block.end = ends[idx]
+		}
+		for _, method := range oldFile.serviceStructMap[block.owner].methods {
+			if declPos(method) < block.pos || method.End() > block.end {
+				zaplog.LOG.Debug("method outside its struct block, skip sorting structs", zap.String("struct", block.owner), zap.String("method", method.Name.Name))
+				return []byte{}
+			}
+		}
+	}
+
+	compareLess := func(i, j int) bool {
+		return blocks[i].order < blocks[j].order
+	}
+	if sort.SliceIsSorted(blocks, compareLess) {
+		return []byte{} // Skip if sorted // 已排序则跳过
+	}
+	sortedBlocks := make([]*codeBlock, len(blocks))
+	copy(sortedBlocks, blocks)
+	sortx.SortByIndex(sortedBlocks, func(i, j int) bool {
+		return sortedBlocks[i].order < sortedBlocks[j].order
+	})
+
+	// Sorted blocks take the places of original blocks one by one
+	// 排序后的代码块依次占据原代码块的位置
+	var code strings.Builder
+	cursor := token.Pos(1)
+	for idx, block := range blocks {
+		code.Write(oldFile.code[cursor-1 : block.pos-1])
+		code.WriteString(blockText(oldFile.code, sortedBlocks[idx]))
+		cursor = block.end
+	}
+	code.Write(oldFile.code[cursor-1:])
+	return []byte(code.String())
+}
+
+// declPos returns start of declaration, at doc comment if exists
+// declPos 返回声明的起始位置，有文档注释时从注释开始
+func declPos(decl ast.Decl) token.Pos {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Doc != nil {
+			checkDocPos(decl)
+			return decl.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if decl.Doc != nil {
+			return decl.Doc.Pos()
+		}
+	}
+	return decl.Pos()
+}
+
+// blockText returns code of block, ending with one blank line so moved blocks stay apart
+// blockText 返回代码块的代码，以一个空行结尾，使移动后的代码块保持分隔
+func blockText(code []byte, block *codeBlock) string {
+	return strings.TrimRight(string(code[block.pos-1:block.end-1]), "\n") + "\n\n"
+}
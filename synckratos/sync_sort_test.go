@@ -0,0 +1,217 @@
+package synckratos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestSortServiceMethods tests sorting methods of each struct in a file hosting two service structs
+// TestSortServiceMethods 测试对包含两个服务 struct 的文件中每个 struct 的方法排序
+func TestSortServiceMethods(t *testing.T) {
+	oldCode := `package service
+
+type UserService struct {
+	pb.UnimplementedUserServer
+}
+
+// DeleteUser deletes
+func (s *UserService) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserReply, error) {
+	return &pb.DeleteUserReply{}, nil
+}
+
+func (s *UserService) check() bool {
+	return true
+}
+
+func (s *UserService) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserReply, error) {
+	return &pb.GetUserReply{}, nil
+}
+
+type OrderService struct {
+	pb.UnimplementedOrderServer
+}
+
+func (s *OrderService) ListOrders(ctx context.Context, req *pb.ListOrdersRequest) (*pb.ListOrdersReply, error) {
+	return &pb.ListOrdersReply{}, nil
+}
+
+func (s *OrderService) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.GetOrderReply, error) {
+	return &pb.GetOrderReply{}, nil
+}
+
+func (s *UserService) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersReply, error) {
+	return &pb.ListUsersReply{}, nil
+}
+`
+	newCode := `package service
+
+type UserService struct {
+	pb.UnimplementedUserServer
+}
+
+func (s *UserService) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserReply, error) {
+	return nil, nil
+}
+
+func (s *UserService) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersReply, error) {
+	return nil, nil
+}
+
+func (s *UserService) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserReply, error) {
+	return nil, nil
+}
+
+type OrderService struct {
+	pb.UnimplementedOrderServer
+}
+
+func (s *OrderService) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.GetOrderReply, error) {
+	return nil, nil
+}
+
+func (s *OrderService) ListOrders(ctx context.Context, req *pb.ListOrdersRequest) (*pb.ListOrdersReply, error) {
+	return nil, nil
+}
+`
+	oldFile := rese.P1(parseServiceCode("user.go", []byte(oldCode)))
+	newFile := rese.P1(parseServiceCode("user.go", []byte(newCode)))
+	sortedCode := sortServiceMethods(oldFile, newFile)
+	require.NotEmpty(t, sortedCode)
+	t.Log(string(sortedCode))
+
+	sortedFile := rese.P1(parseServiceCode("user.go", sortedCode))
+	methodNames := func(structName string) []string {
+		var names []string
+		for _, method := range sortedFile.serviceStructMap[structName].methods {
+			names = append(names, method.Name.Name)
+		}
+		return names
+	}
+	// Helper check moves with DeleteUser, ListUsers moves back above OrderService
+	// 辅助方法 check 跟随 DeleteUser 移动，ListUsers 移回 OrderService 上方
+	require.Equal(t, []string{"GetUser", "ListUsers", "DeleteUser"}, methodNames("UserService"))
+	require.Equal(t, []string{"GetOrder", "ListOrders"}, methodNames("OrderService"))
+	code := string(sortedCode)
+	require.Less(t, strings.Index(code, ") DeleteUser("), strings.Index(code, ") check()"))
+	require.Less(t, strings.Index(code, ") check()"), strings.Index(code, "type OrderService struct"))
+	require.Contains(t, code, "// DeleteUser deletes\nfunc (s *UserService) DeleteUser(")
+
+	// Sorted code needs no more sorting
+	// 已排序的代码无需再次排序
+	require.Empty(t, sortServiceMethods(sortedFile, newFile))
+}
+
+// TestSyncServicesSortStructs tests sorting structs sharing a file to match services in proto
+// TestSyncServicesSortStructs 测试按 proto 中的服务排序共用文件的 struct
+func TestSyncServicesSortStructs(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_sort_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	protoContent := `syntax = "proto3";
+
+package shop.v1;
+
+option go_package = "demo/api/shop/v1;v1";
+
+service User {
+  rpc GetUser (GetUserRequest) returns (GetUserReply);
+  rpc ListUsers (ListUsersRequest) returns (ListUsersReply);
+}
+
+service Order {
+  rpc GetOrder (GetOrderRequest) returns (GetOrderReply);
+  rpc ListOrders (ListOrdersRequest) returns (ListOrdersReply);
+}
+`
+	oldContent := `package service
+
+import (
+	"context"
+
+	pb "demo/api/shop/v1"
+)
+
+type OrderService struct {
+	pb.UnimplementedOrderServer
+}
+
+func NewOrderService() *OrderService {
+	return &OrderService{}
+}
+
+func (s *OrderService) ListOrders(ctx context.Context, req *pb.ListOrdersRequest) (*pb.ListOrdersReply, error) {
+	return &pb.ListOrdersReply{}, nil
+}
+
+func (s *OrderService) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.GetOrderReply, error) {
+	return &pb.GetOrderReply{}, nil
+}
+
+type UserService struct {
+	pb.UnimplementedUserServer
+}
+
+func NewUserService() *UserService {
+	return &UserService{}
+}
+
+func (s *UserService) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersReply, error) {
+	return &pb.ListUsersReply{}, nil
+}
+
+func (s *UserService) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserReply, error) {
+	return &pb.GetUserReply{}, nil
+}
+`
+	protoPath := filepath.Join(tempRoot, "api/shop/v1/shop.proto")
+	servicePath := filepath.Join(tempRoot, "internal/service/shop.go")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	must.Done(os.MkdirAll(filepath.Dir(servicePath), 0755))
+	must.Done(os.WriteFile(protoPath, []byte(protoContent), 0644))
+	must.Done(os.WriteFile(servicePath, []byte(oldContent), 0644))
+
+	// Without option, methods of both structs are sorted, structs stay
+	// 不设置选项时，两个 struct 的方法都会排序，struct 保持不动
+	report, err := SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{MaskMode: true, DryRun: true})
+	require.NoError(t, err)
+	require.True(t, report.Protos[0].Files[0].Reordered)
+
+	report, err = SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{MaskMode: true})
+	require.NoError(t, err)
+	report.WriteText(os.Stdout)
+	code := string(rese.V1(os.ReadFile(servicePath)))
+	t.Log(code)
+	index := func(text string) int {
+		idx := strings.Index(code, text)
+		require.GreaterOrEqual(t, idx, 0, text)
+		return idx
+	}
+	require.Less(t, index("type OrderService struct"), index("type UserService struct"))
+	require.Less(t, index(") GetOrder("), index(") ListOrders("))
+	require.Less(t, index(") GetUser("), index(") ListUsers("))
+
+	report, err = SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{MaskMode: true, SortStructs: true})
+	require.NoError(t, err)
+	require.True(t, report.Protos[0].Files[0].Reordered)
+	code = string(rese.V1(os.ReadFile(servicePath)))
+	t.Log(code)
+	require.Less(t, index("type UserService struct"), index("func NewUserService()"))
+	require.Less(t, index("func NewUserService()"), index(") GetUser("))
+	require.Less(t, index(") GetUser("), index(") ListUsers("))
+	require.Less(t, index(") ListUsers("), index("type OrderService struct"))
+	require.Less(t, index("type OrderService struct"), index("func NewOrderService()"))
+	require.Less(t, index(") GetOrder("), index(") ListOrders("))
+
+	report, err = SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{MaskMode: true, SortStructs: true})
+	require.NoError(t, err)
+	require.False(t, report.HasChanges())
+}
@@ -0,0 +1,159 @@
+package synckratos
+
+import (
+	"go/ast"
+	"sort"
+	"strings"
+
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// rpcKind is the streaming kind of RPC, read from the Go method implementing it
+// rpcKind 是 RPC 的流式类型，从实现它的 Go 方法中读取
+type rpcKind string
+
+const (
+	rpcKindUnary        rpcKind = "unary"            // (ctx, req) (reply, error) // (ctx, req) (reply, error)
+	rpcKindServerStream rpcKind = "server-streaming" // (req, conn) error // (req, conn) error
+	rpcKindClientStream rpcKind = "client-streaming" // (conn) error, replies via SendAndClose // (conn) error，通过 SendAndClose 响应
+	rpcKindBidiStream   rpcKind = "bidi-streaming"   // (conn) error, replies via Send // (conn) error，通过 Send 响应
+	rpcKindStreamIn     rpcKind = "client-or-bidi"   // (conn) error, body tells neither // (conn) error，方法体无法区分
+)
+
+// switchMarker starts the comment placed above methods whose RPC switched kind
+// switchMarker 是放在 RPC 类型已切换的方法上方的注释开头
+const switchMarker = "// TODO(orzkratos): RPC switched from "
+
+// goMethodKind reads RPC kind from method signature
+// Client and bidi streaming share one signature, told apart via SendAndClose or Send calls in body
+//
+// goMethodKind 从方法签名读取 RPC 类型
+// 客户端流和双向流签名相同，通过方法体中的 SendAndClose 或 Send 调用区分
+func goMethodKind(method *ast.FuncDecl) rpcKind {
+	params := countFields(method.Type.Params)
+	results := countFields(method.Type.Results)
+	switch {
+	case results == 1 && params == 2:
+		return rpcKindServerStream
+	case results == 1 && params == 1:
+		switch {
+		case callsMethod(method.Body, "SendAndClose"):
+			return rpcKindClientStream
+		case callsMethod(method.Body, "Send"):
+			return rpcKindBidiStream
+		}
+		return rpcKindStreamIn
+	default:
+		return rpcKindUnary
+	}
+}
+
+// countFields counts params or results, "a, b int" counts as two
+// countFields 统计参数或返回值数量，"a, b int" 计为两个
+func countFields(fieldList *ast.FieldList) int {
+	if fieldList == nil {
+		return 0
+	}
+	count := 0
+	for _, field := range fieldList.List {
+		count += max(len(field.Names), 1)
+	}
+	return count
+}
+
+// callsMethod checks if body calls method with name, e.g. conn.Send(...)
+// callsMethod 检查方法体是否调用指定名称的方法，例如 conn.Send(...)
+func callsMethod(body *ast.BlockStmt, name string) bool {
+	if body == nil {
+		return false
+	}
+	found := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		if callExpr, ok := node.(*ast.CallExpr); ok {
+			if selectorExpr, ok := callExpr.Fun.(*ast.SelectorExpr); ok && selectorExpr.Sel.Name == name {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// sameRPCKind checks if old method still fits RPC kind of new method
+// sameRPCKind 检查旧方法是否仍符合新方法的 RPC 类型
+func sameRPCKind(oldKind rpcKind, newKind rpcKind) bool {
+	if oldKind == newKind {
+		return true
+	}
+	isStreamIn := func(kind rpcKind) bool {
+		return kind == rpcKindClientStream || kind == rpcKindBidiStream
+	}
+	return oldKind == rpcKindStreamIn && isStreamIn(newKind) || newKind == rpcKindStreamIn && isStreamIn(oldKind)
+}
+
+// flagSwitchedMethods marks methods whose RPC switched between unary and streaming kinds
+// Their signatures and bodies need manual migration, so a TODO comment is placed above instead
+// The comment is removed once the method fits its RPC kind again
+// Returns changed code, and each switched method, including ones marked in earlier runs
+//
+// flagSwitchedMethods 标记 RPC 在一元和流式类型之间切换的方法
+// 其签名和方法体需要手动迁移，因此改为在上方放置 TODO 注释
+// 方法再次符合其 RPC 类型后会删除该注释
+// 返回改动后的代码，以及每个已切换的方法，包括之前同步中已标记的方法
+func flagSwitchedMethods(oldFile *ServiceFile, newFile *ServiceFile) ([]byte, []*MethodSwitch) {
+	var edits []*textEdit
+	var switches []*MethodSwitch
+	for structName, newServiceStruct := range newFile.serviceStructMap {
+		oldServiceStruct := findOldStruct(oldFile, newFile, structName)
+		if oldServiceStruct == nil {
+			continue
+		}
+		for _, newMethod := range newServiceStruct.methods {
+			oldMethod, ok := oldServiceStruct.methodsMap[newMethod.Name.Name]
+			if !ok {
+				continue
+			}
+			oldKind := goMethodKind(oldMethod)
+			newKind := goMethodKind(newMethod)
+			marker := findSwitchMarker(oldMethod)
+			if sameRPCKind(oldKind, newKind) {
+				if marker != nil {
+					zaplog.LOG.Debug("method migrated, remove marker", zap.String("method", newMethod.Name.Name))
+					edits = append(edits, &textEdit{pos: marker.Pos(), end: marker.End() + 1, text: ""})
+				}
+				continue
+			}
+			zaplog.LOG.Debug("rpc kind switched", zap.String("method", newMethod.Name.Name), zap.String("from", string(oldKind)), zap.String("to", string(newKind)))
+			switches = append(switches, &MethodSwitch{Name: newMethod.Name.Name, From: string(oldKind), To: string(newKind)})
+			text := switchMarker + string(oldKind) + " to " + string(newKind) + ", migrate this method by hand"
+			switch {
+			case marker == nil:
+				edits = append(edits, &textEdit{pos: oldMethod.Pos(), end: oldMethod.Pos(), text: text + "\n"})
+			case marker.Text != text:
+				edits = append(edits, &textEdit{pos: marker.Pos(), end: marker.End(), text: text})
+			}
+		}
+	}
+	sort.Slice(switches, func(i, j int) bool {
+		return switches[i].Name < switches[j].Name
+	})
+	if len(edits) == 0 {
+		return []byte{}, switches
+	}
+	return applyTextEdits(oldFile.code, edits), switches
+}
+
+// findSwitchMarker returns the switch marker in method doc, nil when absent
+// findSwitchMarker 返回方法文档中的切换标记，不存在时返回 nil
+func findSwitchMarker(method *ast.FuncDecl) *ast.Comment {
+	if method.Doc == nil {
+		return nil
+	}
+	for _, comment := range method.Doc.List {
+		if strings.HasPrefix(comment.Text, switchMarker) {
+			return comment
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package synckratos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestGoMethodKind tests reading RPC kind from method signature and body
+// TestGoMethodKind 测试从方法签名和方法体读取 RPC 类型
+func TestGoMethodKind(t *testing.T) {
+	code := `package service
+
+type GreeterService struct{}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{}, nil
+}
+
+func (s *GreeterService) Watch(req *pb.HelloRequest, conn grpc.ServerStreamingServer[pb.HelloReply]) error {
+	return nil
+}
+
+func (s *GreeterService) Upload(conn pb.Greeter_UploadServer) error {
+	return conn.SendAndClose(&pb.HelloReply{})
+}
+
+func (s *GreeterService) Chat(conn pb.Greeter_ChatServer) error {
+	return conn.Send(&pb.HelloReply{})
+}
+
+func (s *GreeterService) Drain(conn pb.Greeter_DrainServer) error {
+	return nil
+}
+`
+	svcFile := rese.P1(parseServiceCode("greeter.go", []byte(code)))
+	methods := svcFile.serviceStructMap["GreeterService"].methodsMap
+	require.Equal(t, rpcKindUnary, goMethodKind(methods["SayHello"]))
+	require.Equal(t, rpcKindServerStream, goMethodKind(methods["Watch"]))
+	require.Equal(t, rpcKindClientStream, goMethodKind(methods["Upload"]))
+	require.Equal(t, rpcKindBidiStream, goMethodKind(methods["Chat"]))
+	require.Equal(t, rpcKindStreamIn, goMethodKind(methods["Drain"]))
+
+	require.True(t, sameRPCKind(rpcKindStreamIn, rpcKindBidiStream))
+	require.False(t, sameRPCKind(rpcKindClientStream, rpcKindBidiStream))
+	require.False(t, sameRPCKind(rpcKindUnary, rpcKindServerStream))
+}
+
+// TestSyncServicesStreamingSwitch tests RPCs switched between unary and streaming are flagged, not rewritten
+// TestSyncServicesStreamingSwitch 测试在一元和流式之间切换的 RPC 会被标记而非重写
+func TestSyncServicesStreamingSwitch(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_streaming_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	protoContent := `syntax = "proto3";
+
+package helloworld.v1;
+
+option go_package = "demo/api/helloworld/v1;v1";
+
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+  rpc Chat (stream HelloRequest) returns (stream HelloReply);
+  rpc Upload (stream HelloRequest) returns (stream HelloReply);
+}
+`
+	oldContent := `package service
+
+import (
+	"context"
+
+	pb "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
+}
+
+// Chat replies once
+func (s *GreeterService) Chat(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: req.Name}, nil
+}
+
+func (s *GreeterService) Upload(conn pb.Greeter_UploadServer) error {
+	return conn.SendAndClose(&pb.HelloReply{})
+}
+`
+	protoPath := filepath.Join(tempRoot, "api/helloworld/v1/greeter.proto")
+	servicePath := filepath.Join(tempRoot, "internal/service/greeter.go")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	must.Done(os.MkdirAll(filepath.Dir(servicePath), 0755))
+	must.Done(os.WriteFile(protoPath, []byte(protoContent), 0644))
+	must.Done(os.WriteFile(servicePath, []byte(oldContent), 0644))
+
+	syncOnce := func() *FileChange {
+		report, err := SyncServicesOnce(context.Background(), tempRoot, protoPath, &SyncOptions{MaskMode: true})
+		require.NoError(t, err)
+		report.WriteText(os.Stdout)
+		return report.Protos[0].Files[0]
+	}
+
+	expected := []*MethodSwitch{
+		{Name: "Chat", From: "unary", To: "bidi-streaming"},
+		{Name: "Upload", From: "client-streaming", To: "bidi-streaming"},
+	}
+	change := syncOnce()
+	require.Equal(t, expected, change.Switched)
+	require.Empty(t, change.Signatures)
+	code := string(rese.V1(os.ReadFile(servicePath)))
+	t.Log(code)
+	require.Contains(t, code, "// Chat replies once\n// TODO(orzkratos): RPC switched from unary to bidi-streaming, migrate this method by hand\nfunc (s *GreeterService) Chat(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {")
+	require.Contains(t, code, "// TODO(orzkratos): RPC switched from client-streaming to bidi-streaming, migrate this method by hand\nfunc (s *GreeterService) Upload(conn pb.Greeter_UploadServer) error {")
+
+	// Next sync keeps reporting the switch, without a second marker
+	// 下次同步继续报告切换，且不会添加第二个标记
+	change = syncOnce()
+	require.Equal(t, expected, change.Switched)
+	require.Equal(t, code, string(rese.V1(os.ReadFile(servicePath))))
+
+	// Migrated by hand, marker goes away
+	// 手动迁移后，标记被删除
+	code = strings.Replace(code, "Chat(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {\n\treturn &pb.HelloReply{Message: req.Name}, nil", "Chat(conn pb.Greeter_ChatServer) error {\n\treturn conn.Send(&pb.HelloReply{})", 1)
+	must.Done(os.WriteFile(servicePath, []byte(code), 0644))
+	change = syncOnce()
+	require.Equal(t, expected[1:], change.Switched)
+	code = string(rese.V1(os.ReadFile(servicePath)))
+	require.Contains(t, code, "// Chat replies once\nfunc (s *GreeterService) Chat(conn pb.Greeter_ChatServer) error {")
+}
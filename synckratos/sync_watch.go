@@ -0,0 +1,150 @@
+package synckratos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/orzkratos/orzkratos/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/eroticgo"
+	"github.com/yyle88/osexistpath/ossoftexist"
+	"github.com/yyle88/tern"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// WatchOptions defines options used in watch mode
+// WatchOptions 定义 watch 模式中使用的选项
+type WatchOptions struct {
+	Interval time.Duration // Polling interval, default 500ms // 轮询间隔，默认 500ms
+	Debounce time.Duration // Quiet time after last save before sync, default 300ms // 最后一次保存后等待的静默时间，默认 300ms
+	Output   io.Writer     // Receives summary of each sync, nil means stdout // 接收每次同步的摘要，为 nil 时使用 stdout
+}
+
+// protoStamp holds modification time and size of proto file, used to detect saves
+// protoStamp 保存 proto 文件的修改时间和大小，用于检测保存
+type protoStamp struct {
+	modTime int64 // Modification time in nanoseconds // 以纳秒表示的修改时间
+	size    int64 // File size // 文件大小
+}
+
+// WatchServices polls proto files in proto DIR (api/ by default) and include roots, and syncs each saved proto via SyncServicesOnce
+// Saves are debounced, sync failures such as a half-edited proto are printed and watching goes on
+// Returns nil when ctx is done
+//
+// WatchServices 轮询 proto DIR（默认为 api/）和包含的根 DIR 中的 proto 文件，通过 SyncServicesOnce 同步每个保存的 proto
+// 保存操作会去抖，同步失败（如编辑到一半的 proto）会被打印并继续监听
+// ctx 结束时返回 nil
+func WatchServices(ctx context.Context, projectRoot string, options *SyncOptions, watchOptions *WatchOptions) error {
+	if err := checkRemovedMethodPolicy(options.RemovedMethodPolicy); err != nil {
+		return err
+	}
+	if err := checkImportRewrites(options.ImportRewrites); err != nil {
+		return err
+	}
+	includeRoots, err := options.protoIncludeRoots(ctx, projectRoot)
+	if err != nil {
+		return err
+	}
+	protoVolume := options.protoRoot(projectRoot)
+	watchRoots := includeRoots
+	if ossoftexist.IsRoot(protoVolume) {
+		watchRoots = append([]string{protoVolume}, includeRoots...)
+	} else if len(includeRoots) == 0 {
+		return newSyncError(ErrorKindPathNotFound, protoVolume, erero.New("proto DIR not found"))
+	}
+	interval := watchOptions.Interval
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	debounce := watchOptions.Debounce
+	if debounce <= 0 {
+		debounce = 300 * time.Millisecond
+	}
+	w := watchOptions.Output
+	if w == nil {
+		w = os.Stdout
+	}
+
+	stamps, err := scanProtoStamps(projectRoot, protoVolume, watchRoots, options.IgnoreGlobs)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(w, eroticgo.BLUE.Sprint(fmt.Sprintf("watching %d proto files in %s", len(stamps), strings.Join(watchRoots, ", "))))
+
+	pending := make(map[string]time.Time) // Changed proto path to time of last save // 变更的 proto 路径到最后保存时间的映射
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		newStamps, err := scanProtoStamps(projectRoot, protoVolume, watchRoots, options.IgnoreGlobs)
+		if err != nil {
+			// Files may vanish during the scan, try again on next tick
+			// 扫描期间文件可能消失，下次轮询时重试
+			zaplog.LOG.Warn("scan proto files failed", zap.Error(err))
+			continue
+		}
+		now := time.Now()
+		for path, stamp := range newStamps {
+			if stamps[path] != stamp {
+				pending[path] = now
+			}
+		}
+		for path := range stamps {
+			if _, ok := newStamps[path]; !ok {
+				zaplog.LOG.Debug("proto removed, skip", zap.String("proto", path))
+				delete(pending, path)
+			}
+		}
+		stamps = newStamps
+
+		var readyPaths []string
+		for path, changeTime := range pending {
+			if now.Sub(changeTime) >= debounce {
+				readyPaths = append(readyPaths, path)
+			}
+		}
+		sort.Strings(readyPaths)
+		for _, path := range readyPaths {
+			delete(pending, path)
+			report, err := SyncServicesOnce(ctx, projectRoot, path, options)
+			if err != nil {
+				_, _ = fmt.Fprintln(w, eroticgo.RED.Sprint("sync failed: "+err.Error()))
+				continue
+			}
+			report.WriteSummary(w)
+		}
+	}
+}
+
+// scanProtoStamps returns stamps of each proto file in watched DIRs, skips ignored ones
+// Ignore globs match path relative to project root in proto DIR, and relative to include root in include roots
+//
+// scanProtoStamps 返回监听的 DIR 中每个 proto 文件的标记，跳过被忽略的文件
+// 忽略通配符在 proto DIR 中匹配相对于项目根 DIR 的路径，在包含的根 DIR 中匹配相对于该根 DIR 的路径
+func scanProtoStamps(projectRoot string, protoVolume string, watchRoots []string, ignoreGlobs []string) (map[string]protoStamp, error) {
+	stamps := make(map[string]protoStamp)
+	for _, watchRoot := range watchRoots {
+		ignoreRoot := tern.BVV(watchRoot == protoVolume, projectRoot, watchRoot)
+		if err := utils.WalkFiles(watchRoot, utils.NewSuffixPattern([]string{".proto"}), func(path string, info os.FileInfo) error {
+			if isIgnored(ignoreRoot, path, ignoreGlobs) {
+				return nil
+			}
+			stamps[path] = protoStamp{modTime: info.ModTime().UnixNano(), size: info.Size()}
+			return nil
+		}); err != nil {
+			return nil, newSyncError(ErrorKindReadFailure, watchRoot, err)
+		}
+	}
+	return stamps, nil
+}
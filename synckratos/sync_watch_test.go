@@ -0,0 +1,86 @@
+package synckratos
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// lockedBuffer is a bytes.Buffer safe to write and read across goroutines
+// lockedBuffer 是可以跨 goroutine 读写的 bytes.Buffer
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// TestWatchServices tests syncing on proto save, and going on after a half-edited proto
+// TestWatchServices 测试保存 proto 时同步，以及遇到编辑到一半的 proto 后继续监听
+func TestWatchServices(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_watch_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	protoHeader := `syntax = "proto3";
+
+package helloworld.v1;
+
+option go_package = "demo/api/helloworld/v1;v1";
+`
+	protoPath := filepath.Join(tempRoot, "api/helloworld/v1/greeter.proto")
+	servicePath := filepath.Join(tempRoot, "internal/service/greeter.go")
+	must.Done(os.MkdirAll(filepath.Dir(protoPath), 0755))
+	must.Done(os.MkdirAll(filepath.Dir(servicePath), 0755))
+	must.Done(os.WriteFile(protoPath, []byte(protoHeader+"\nservice Greeter {\n  rpc SayHello (HelloRequest) returns (HelloReply);\n}\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	output := &lockedBuffer{}
+	watchDone := make(chan error, 1)
+	go func() {
+		watchDone <- WatchServices(ctx, tempRoot, &SyncOptions{}, &WatchOptions{
+			Interval: 10 * time.Millisecond,
+			Debounce: 30 * time.Millisecond,
+			Output:   output,
+		})
+	}()
+	waitOutput := func(text string) {
+		require.Eventually(t, func() bool {
+			return strings.Contains(output.String(), text)
+		}, 5*time.Second, 10*time.Millisecond, output.String())
+	}
+	waitOutput("watching 1 proto files")
+
+	// Half-edited proto fails to sync, watching goes on
+	// 编辑到一半的 proto 同步失败，继续监听
+	must.Done(os.WriteFile(protoPath, []byte(protoHeader+"\nservice Greeter {\n  rpc SayHello (HelloRequest\n"), 0644))
+	waitOutput("sync failed: parse-failure")
+
+	must.Done(os.WriteFile(protoPath, []byte(protoHeader+"\nservice Greeter {\n  rpc SayHello (HelloRequest) returns (HelloReply);\n  rpc SayBye (HelloRequest) returns (HelloReply);\n}\n"), 0644))
+	waitOutput("internal/service/greeter.go: created")
+	require.Contains(t, string(rese.V1(os.ReadFile(servicePath))), "func (s *GreeterService) SayBye(")
+
+	cancel()
+	require.NoError(t, <-watchDone)
+	t.Log(output.String())
+}
@@ -0,0 +1,268 @@
+package synckratos
+
+import (
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// ProviderChange records constructors changed in Wire ProviderSet of service package
+// ProviderChange 记录服务包的 Wire ProviderSet 中变更的构造函数
+type ProviderChange struct {
+	Path    string   `json:"path"`    // File declaring ProviderSet, relative to project root // 声明 ProviderSet 的文件，相对于项目根 DIR
+	Added   []string `json:"added"`   // Constructors appended in this sync // 本次同步追加的构造函数
+	Removed []string `json:"removed"` // Constructors of stale services removed in this sync // 本次同步删除的过时服务的构造函数
+	Stale   []string `json:"stale"`   // Constructors of stale services kept, without pruning // 未清理而保留的过时服务的构造函数
+}
+
+// syncProviders keeps "var ProviderSet = wire.NewSet(...)" of service package in sync with service structs
+// Appends missing constructors of service structs, matched via mask type or via name of proto service
+// With checkStale, constructors which are missing or build services defined in no proto are stale
+// Stale ones are removed when PruneProviders is set, else only reported
+// Skips when service package declares no ProviderSet
+//
+// syncProviders 使服务包中的 "var ProviderSet = wire.NewSet(...)" 与服务 struct 保持同步
+// 追加服务 struct 缺失的构造函数，服务 struct 按嵌入类型或 proto 服务名匹配
+// 设置 checkStale 时，不存在的构造函数，以及构造没有 proto 定义的服务的构造函数，视为过时
+// 设置 PruneProviders 时删除过时的构造函数，否则只报告
+// 服务包中没有声明 ProviderSet 时跳过
+func (run *syncRun) syncProviders(checkStale bool) error {
+	serviceRoot := run.options.serviceRoot(run.projectRoot)
+	var setFile *ServiceFile
+	var setCall *ast.CallExpr
+	var serviceStructs []string                 // Service structs in file and declaration sequence // 按文件和声明顺序排列的服务 struct
+	serviceNames := make(map[string]string)     // Service struct name to service name // 服务 struct 名到服务名的映射
+	constructors := make(map[string]string)     // Struct name to its constructor // struct 名到其构造函数的映射
+	constructorTypes := make(map[string]string) // Constructor to struct name it returns // 构造函数到其返回的 struct 名的映射
+	for _, path := range run.store.listGoFiles(serviceRoot) {
+		if filepath.Dir(path) != serviceRoot || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		svcFile, err := run.parseStoreFile(path)
+		if err != nil {
+			return err
+		}
+		if call := findProviderSet(svcFile.astFile); call != nil && setCall == nil {
+			setFile, setCall = svcFile, call
+		}
+		maskMap := buildStructMaskMap(svcFile)
+		for _, decl := range svcFile.astFile.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				if decl.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					structName := spec.(*ast.TypeSpec).Name.Name
+					if _, ok := svcFile.serviceStructMap[structName]; !ok {
+						continue
+					}
+					serviceName := strings.TrimSuffix(structName, "Service")
+					if maskType, ok := maskMap[structName]; ok {
+						serviceName = strings.TrimSuffix(strings.TrimPrefix(maskType, "Unimplemented"), "Server")
+					} else if serviceName == structName || !run.protoServices[serviceName] {
+						continue
+					}
+					serviceNames[structName] = serviceName
+					serviceStructs = append(serviceStructs, structName)
+				}
+			case *ast.FuncDecl:
+				if decl.Recv != nil || !strings.HasPrefix(decl.Name.Name, "New") || decl.Type.Results == nil {
+					continue
+				}
+				structName := strings.TrimPrefix(getTypeName(svcFile.code, decl.Type.Results.List[0].Type), "*")
+				constructorTypes[decl.Name.Name] = structName
+				// Prefer New<Struct> when a struct has several constructors
+				// 一个 struct 有多个构造函数时优先使用 New<Struct>
+				if _, ok := constructors[structName]; !ok || decl.Name.Name == "New"+structName {
+					constructors[structName] = decl.Name.Name
+				}
+			}
+		}
+	}
+	if setCall == nil {
+		zaplog.LOG.Debug("ProviderSet not found, skip syncing providers", zap.String("root", serviceRoot))
+		return nil
+	}
+
+	isStale := func(name string) bool {
+		structName, ok := constructorTypes[name]
+		if !ok {
+			return true
+		}
+		serviceName, ok := serviceNames[structName]
+		return ok && !run.protoServices[serviceName]
+	}
+	listed := make(map[string]bool)
+	var stale []string
+	for _, arg := range setCall.Args {
+		ident, ok := arg.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		listed[ident.Name] = true
+		if checkStale && strings.HasPrefix(ident.Name, "New") && isStale(ident.Name) {
+			zaplog.LOG.Debug("stale provider", zap.String("constructor", ident.Name))
+			stale = append(stale, ident.Name)
+		}
+	}
+	added := []string{}
+	for _, structName := range serviceStructs {
+		name, ok := constructors[structName]
+		if !ok {
+			zaplog.LOG.Debug("service struct without constructor, skip", zap.String("struct", structName))
+			continue
+		}
+		if listed[name] || (checkStale && isStale(name)) {
+			continue
+		}
+		listed[name] = true
+		added = append(added, name)
+	}
+
+	change := &ProviderChange{Path: run.relPath(setFile.path), Added: added, Removed: []string{}, Stale: []string{}}
+	if run.options.PruneProviders {
+		change.Removed = append(change.Removed, stale...)
+	} else {
+		change.Stale = append(change.Stale, stale...)
+	}
+	if len(change.Added) == 0 && len(change.Removed) == 0 && len(change.Stale) == 0 {
+		return nil
+	}
+	if len(change.Added) > 0 || len(change.Removed) > 0 {
+		newCode := editProviderSet(setFile.code, setCall, change.Added, change.Removed)
+		if err := run.store.write(setFile.path, newCode); err != nil {
+			return err
+		}
+		run.report.WireGen = true
+	}
+	run.report.Providers = change
+	return nil
+}
+
+// appendProviders appends constructors missing in ProviderSet declared in Go files of root, used when scaffolding layers
+// Returns constructors appended, none when ProviderSet is not found
+//
+// appendProviders 将缺失的构造函数追加到 root 中 Go 文件声明的 ProviderSet，用于生成分层代码
+// 返回追加的构造函数，找不到 ProviderSet 时没有
+func (run *syncRun) appendProviders(root string, names []string) ([]string, error) {
+	for _, path := range run.store.listGoFiles(root) {
+		if filepath.Dir(path) != root || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		svcFile, err := run.parseStoreFile(path)
+		if err != nil {
+			return nil, err
+		}
+		call := findProviderSet(svcFile.astFile)
+		if call == nil {
+			continue
+		}
+		listed := make(map[string]bool)
+		for _, arg := range call.Args {
+			if ident, ok := arg.(*ast.Ident); ok {
+				listed[ident.Name] = true
+			}
+		}
+		var added []string
+		for _, name := range names {
+			if !listed[name] {
+				listed[name] = true
+				added = append(added, name)
+			}
+		}
+		if len(added) > 0 {
+			if err := run.store.write(path, editProviderSet(svcFile.code, call, added, nil)); err != nil {
+				return nil, err
+			}
+		}
+		return added, nil
+	}
+	zaplog.LOG.Debug("ProviderSet not found, skip appending providers", zap.String("root", root))
+	return nil, nil
+}
+
+// findProviderSet returns the wire.NewSet call assigned to package var ProviderSet, nil when absent
+// findProviderSet 返回赋值给包变量 ProviderSet 的 wire.NewSet 调用，不存在时返回 nil
+func findProviderSet(astFile *ast.File) *ast.CallExpr {
+	for _, decl := range astFile.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for idx, name := range valueSpec.Names {
+				if name.Name != "ProviderSet" || idx >= len(valueSpec.Values) {
+					continue
+				}
+				callExpr, ok := valueSpec.Values[idx].(*ast.CallExpr)
+				if !ok {
+					continue
+				}
+				if selectorExpr, ok := callExpr.Fun.(*ast.SelectorExpr); ok && selectorExpr.Sel.Name == "NewSet" {
+					return callExpr
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// editProviderSet removes and appends constructors in args of wire.NewSet call
+// Multi-line args get one constructor per line, keeping the trailing comma
+//
+// editProviderSet 在 wire.NewSet 调用的参数中删除和追加构造函数
+// 多行参数时每行一个构造函数，并保留末尾的逗号
+func editProviderSet(code []byte, call *ast.CallExpr, added []string, removed []string) []byte {
+	isRemoved := func(arg ast.Expr) bool {
+		ident, ok := arg.(*ast.Ident)
+		return ok && slices.Contains(removed, ident.Name)
+	}
+	args := call.Args
+	lastKept := -1
+	for idx, arg := range args {
+		if !isRemoved(arg) {
+			lastKept = idx
+		}
+	}
+
+	// Removed arg goes with code up to next arg, trailing removed ones go with code after last kept arg
+	// 删除的参数连同其后到下一个参数之间的代码一起删除，末尾删除的参数连同最后保留的参数之后的代码一起删除
+	var edits []*textEdit
+	for idx := 0; idx < lastKept; idx++ {
+		if isRemoved(args[idx]) {
+			edits = append(edits, &textEdit{pos: args[idx].Pos(), end: args[idx+1].Pos()})
+		}
+	}
+	if len(args) > 0 && lastKept < len(args)-1 {
+		pos := args[0].Pos()
+		if lastKept >= 0 {
+			pos = args[lastKept].End()
+		}
+		edits = append(edits, &textEdit{pos: pos, end: args[len(args)-1].End()})
+	}
+
+	if len(added) > 0 {
+		if len(args) == 0 {
+			edits = append(edits, &textEdit{pos: call.Rparen, end: call.Rparen, text: strings.Join(added, ", ")})
+		} else {
+			lastEnd := args[len(args)-1].End()
+			sep := ", "
+			if strings.Contains(string(code[lastEnd-1:call.Rparen-1]), "\n") {
+				sep = ",\n\t"
+			}
+			text := strings.Join(added, sep)
+			if lastKept >= 0 {
+				text = sep + text
+			}
+			edits = append(edits, &textEdit{pos: lastEnd, end: lastEnd, text: text})
+		}
+	}
+	return applyTextEdits(code, edits)
+}
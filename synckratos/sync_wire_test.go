@@ -0,0 +1,149 @@
+package synckratos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// TestEditProviderSet tests removing and appending constructors in single-line and multi-line wire.NewSet
+// TestEditProviderSet 测试在单行和多行 wire.NewSet 中删除和追加构造函数
+func TestEditProviderSet(t *testing.T) {
+	editCode := func(code string, added []string, removed []string) string {
+		svcFile := rese.P1(parseServiceCode("service.go", []byte(code)))
+		call := findProviderSet(svcFile.astFile)
+		require.NotNil(t, call)
+		return string(editProviderSet(svcFile.code, call, added, removed))
+	}
+
+	code := "package service\n\nvar ProviderSet = wire.NewSet(NewGreeterService, NewLegacyService)\n"
+	require.Equal(t, "package service\n\nvar ProviderSet = wire.NewSet(NewGreeterService, NewUserService)\n", editCode(code, []string{"NewUserService"}, []string{"NewLegacyService"}))
+	require.Equal(t, "package service\n\nvar ProviderSet = wire.NewSet(NewUserService)\n", editCode(code, []string{"NewUserService"}, []string{"NewGreeterService", "NewLegacyService"}))
+
+	code = "package service\n\nvar ProviderSet = wire.NewSet()\n"
+	require.Equal(t, "package service\n\nvar ProviderSet = wire.NewSet(NewUserService)\n", editCode(code, []string{"NewUserService"}, nil))
+
+	code = "package service\n\nvar ProviderSet = wire.NewSet(\n\tNewLegacyService,\n\tNewGreeterService,\n)\n"
+	require.Equal(t, "package service\n\nvar ProviderSet = wire.NewSet(\n\tNewGreeterService,\n\tNewUserService,\n\tNewOrderService,\n)\n", editCode(code, []string{"NewUserService", "NewOrderService"}, []string{"NewLegacyService"}))
+}
+
+// TestSyncServicesProviders tests appending constructors of new services to ProviderSet, reporting and pruning stale ones
+// TestSyncServicesProviders 测试将新服务的构造函数追加到 ProviderSet，报告和清理过时的构造函数
+func TestSyncServicesProviders(t *testing.T) {
+	tempRoot := rese.C1(os.MkdirTemp("", "orzkratos_wire_*"))
+	defer func() {
+		must.Done(os.RemoveAll(tempRoot))
+	}()
+
+	writeFile := func(path string, content string) {
+		path = filepath.Join(tempRoot, path)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+	}
+	writeFile("api/helloworld/v1/greeter.proto", `syntax = "proto3";
+package helloworld.v1;
+option go_package = "demo/api/helloworld/v1;v1";
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+}
+message HelloRequest {}
+message HelloReply {}
+`)
+	writeFile("api/user/v1/user.proto", `syntax = "proto3";
+package user.v1;
+option go_package = "demo/api/user/v1;v1";
+service User {
+  rpc GetUser (GetUserRequest) returns (GetUserReply);
+}
+message GetUserRequest {}
+message GetUserReply {}
+`)
+	writeFile("internal/service/service.go", `package service
+
+import "github.com/google/wire"
+
+// ProviderSet is service providers.
+var ProviderSet = wire.NewSet(NewGreeterService, NewLegacyService, NewCache)
+`)
+	writeFile("internal/service/cache.go", `package service
+
+type Cache struct{}
+
+func NewCache() *Cache {
+	return &Cache{}
+}
+`)
+	writeFile("internal/service/greeter.go", `package service
+
+import (
+	"context"
+
+	v1 "demo/api/helloworld/v1"
+)
+
+type GreeterService struct {
+	v1.UnimplementedGreeterServer
+}
+
+func NewGreeterService() *GreeterService {
+	return &GreeterService{}
+}
+
+func (s *GreeterService) SayHello(ctx context.Context, req *v1.HelloRequest) (*v1.HelloReply, error) {
+	return &v1.HelloReply{}, nil
+}
+`)
+	writeFile("internal/service/legacy.go", `package service
+
+import (
+	legacyv1 "demo/api/legacy/v1"
+)
+
+type LegacyService struct {
+	legacyv1.UnimplementedLegacyServer
+}
+
+func NewLegacyService() *LegacyService {
+	return &LegacyService{}
+}
+`)
+	servicePath := filepath.Join(tempRoot, "internal/service/service.go")
+
+	report, err := SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, SyncProviders: true})
+	require.NoError(t, err)
+	report.WriteText(os.Stdout)
+	require.Equal(t, &ProviderChange{
+		Path:    "internal/service/service.go",
+		Added:   []string{"NewUserService"},
+		Removed: []string{},
+		Stale:   []string{"NewLegacyService"},
+	}, report.Providers)
+	require.True(t, report.WireGen)
+	code := string(rese.V1(os.ReadFile(servicePath)))
+	t.Log(code)
+	require.Contains(t, code, "var ProviderSet = wire.NewSet(NewGreeterService, NewLegacyService, NewCache, NewUserService)\n")
+
+	// Stale one is kept and reported, wire gen is not needed
+	// 过时的构造函数被保留并报告，无需重新运行 wire gen
+	report, err = SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, SyncProviders: true})
+	require.NoError(t, err)
+	require.False(t, report.HasChanges())
+	require.False(t, report.WireGen)
+	require.Equal(t, []string{"NewLegacyService"}, report.Providers.Stale)
+
+	// Prune removes stale one, also once the legacy file is gone
+	// 清理会删除过时的构造函数，legacy 文件删除后也是如此
+	must.Done(os.Remove(filepath.Join(tempRoot, "internal/service/legacy.go")))
+	report, err = SyncServices(context.Background(), tempRoot, &SyncOptions{MaskMode: true, SyncProviders: true, PruneProviders: true})
+	require.NoError(t, err)
+	require.True(t, report.HasChanges())
+	require.Equal(t, []string{"NewLegacyService"}, report.Providers.Removed)
+	code = string(rese.V1(os.ReadFile(servicePath)))
+	t.Log(code)
+	require.Contains(t, code, "var ProviderSet = wire.NewSet(NewGreeterService, NewCache, NewUserService)\n")
+}